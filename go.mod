@@ -18,6 +18,7 @@ require (
 	github.com/libp2p/go-libp2p-peer v0.1.1
 	github.com/libp2p/go-libp2p-peerstore v0.0.1
 	github.com/libp2p/go-libp2p-protocol v0.0.1
+	github.com/multiformats/go-multiaddr v0.0.1
 	github.com/multiformats/go-multihash v0.0.5
 	github.com/polydawn/refmt v0.0.0-20190221155625-df39d6c2d992 // indirect
 )
@@ -2,8 +2,11 @@ package graphsync
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/ipfs/go-graphsync/requestmanager/asyncloader"
+	"github.com/ipfs/go-graphsync/requestmanager/requesterrors"
 	"github.com/ipfs/go-graphsync/requestmanager/types"
 
 	"github.com/ipfs/go-graphsync/ipldbridge"
@@ -11,8 +14,11 @@ import (
 	"github.com/ipfs/go-graphsync/messagequeue"
 	gsnet "github.com/ipfs/go-graphsync/network"
 	"github.com/ipfs/go-graphsync/peermanager"
+	"github.com/ipfs/go-graphsync/requestcontext"
 	"github.com/ipfs/go-graphsync/requestmanager"
 	"github.com/ipfs/go-graphsync/responsemanager"
+	"github.com/ipfs/go-graphsync/responsemanager/bandwidth"
+	"github.com/ipfs/go-graphsync/responsemanager/loader"
 	"github.com/ipfs/go-graphsync/responsemanager/peerresponsemanager"
 	"github.com/ipfs/go-peertaskqueue"
 	logging "github.com/ipfs/go-log"
@@ -26,13 +32,235 @@ var log = logging.Logger("graphsync")
 // Graphsync.
 type ResponseProgress = types.ResponseProgress
 
+// ErrRequestPaused is sent on a request's error channel when the responder
+// pauses its response. The request stays open until the responder unpauses it.
+var ErrRequestPaused = types.ErrRequestPaused
+
+// ErrTimedOut is sent on a request's error channel when the request does not
+// complete before the deadline set with WithTimeout.
+var ErrTimedOut = requesterrors.ErrTimedOut
+
+// ErrStalled is sent on a request's error channel when the responder makes no
+// progress within the duration set with WithStallTimeout.
+var ErrStalled = requesterrors.ErrStalled
+
+// ErrShutdown is sent on a request's error channel when the request is made
+// after, or is still in progress when, the GraphSync instance shuts down.
+var ErrShutdown = requesterrors.ErrShutdown
+
+// ErrInvalidSelector is sent on a request's error channel when the selector
+// spec for the request is not valid.
+var ErrInvalidSelector = requesterrors.ErrInvalidSelector
+
+// ErrNoPeers is sent on a request's error channel when the request is made
+// without any peers to send it to.
+var ErrNoPeers = requesterrors.ErrNoPeers
+
+// ErrPeerDisconnected is the Err of a NetworkError sent when the peer
+// disconnects while the request is in progress.
+var ErrPeerDisconnected = requesterrors.ErrPeerDisconnected
+
+// SelectorSpecError is sent on a request's error channel when the selector
+// spec for the request cannot be encoded or decoded.
+type SelectorSpecError = requesterrors.SelectorSpecError
+
+// RequestFailedError is sent on a request's error channel when the responder
+// terminates the request with a failure status. Its Status field tells why.
+type RequestFailedError = requesterrors.RequestFailedError
+
+// MissingBlockError is sent on a request's error channel for each link the
+// responder does not have a block for.
+type MissingBlockError = requesterrors.MissingBlockError
+
+// BlockStorageError is sent on a request's error channel when a block received
+// for the request cannot be read back after it was received, or cannot be
+// stored once verified.
+type BlockStorageError = requesterrors.BlockStorageError
+
+// NoActiveRequestError is sent on a request's error channel when a link
+// cannot be loaded after the responder has finished responding.
+type NoActiveRequestError = requesterrors.NoActiveRequestError
+
+// NetworkError is sent on a request's error channel when the request fails
+// because the peer could not be reached.
+type NetworkError = requesterrors.NetworkError
+
+// ExtensionName is a name for a GraphSync extension
+type ExtensionName = gsmsg.GraphSyncExtensionName
+
+// ExtensionData is a name/data pair for a GraphSync extension
+type ExtensionData = gsmsg.GraphSyncExtension
+
+// RequestOption customizes a single outgoing GraphSync request.
+type RequestOption = requestmanager.RequestOption
+
+// WithExtensions sends the given extension data along with a request.
+func WithExtensions(extensions ...ExtensionData) RequestOption {
+	return requestmanager.WithExtensions(extensions...)
+}
+
+// Priority is the priority of a GraphSync request. Higher values are served first.
+type Priority = gsmsg.GraphSyncPriority
+
+// WithPriority sets the priority of a request, which defaults to the maximum.
+// Responders work on a peer's higher priority requests first.
+func WithPriority(priority Priority) RequestOption {
+	return requestmanager.WithPriority(priority)
+}
+
+// WithRequestIDCallback calls the given function with the ID of a request
+// before it is sent, so the request can later be paused, unpaused or updated.
+func WithRequestIDCallback(callback func(gsmsg.GraphSyncRequestID)) RequestOption {
+	return requestmanager.WithRequestIDCallback(callback)
+}
+
+// WithTimeout cancels a request that has not completed within the given
+// duration, terminating it with ErrTimedOut.
+func WithTimeout(timeout time.Duration) RequestOption {
+	return requestmanager.WithTimeout(timeout)
+}
+
+// WithStallTimeout cancels a request when the responder sends nothing for it
+// within the given duration, terminating it with ErrStalled.
+func WithStallTimeout(stallTimeout time.Duration) RequestOption {
+	return requestmanager.WithStallTimeout(stallTimeout)
+}
+
+// RequestResult is the outcome of a request as reported by the responder: its
+// terminal status, the links it was missing and the extension data it sent.
+type RequestResult = requestmanager.RequestResult
+
+// WithResultCallback calls the given function with the result of a request
+// once it finishes, before its response and error channels close.
+func WithResultCallback(callback func(RequestResult)) RequestOption {
+	return requestmanager.WithResultCallback(callback)
+}
+
+// WithFailoverPeers gives peers to send a request to, in order, when the peers
+// responding to it are busy, do not have the content, complete it only
+// partially or cannot be reached.
+func WithFailoverPeers(peers ...peer.ID) RequestOption {
+	return requestmanager.WithFailoverPeers(peers...)
+}
+
+// WithBusyRetries sends a request again, up to the given number of times, when
+// the responder is too busy to take it, waiting for the backoff it asks for.
+func WithBusyRetries(busyRetries int) RequestOption {
+	return requestmanager.WithBusyRetries(busyRetries)
+}
+
+// WithFollowAdditionalPeers fails over to the peers a responder points a
+// request at when the responder cannot satisfy the request itself. The peers
+// are also listed in the request's RequestResult.
+func WithFollowAdditionalPeers() RequestOption {
+	return requestmanager.WithFollowAdditionalPeers()
+}
+
+// WithLoader loads a request's links that are not in responses from the given
+// loader instead of the loader passed to New, for example to fetch a DAG into
+// a staging store.
+func WithLoader(loader ipldbridge.Loader) RequestOption {
+	return requestmanager.WithLoader(loader)
+}
+
+// WithStorer stores the blocks received for a request with the given storer
+// instead of the storer passed to New. It is usually given together with
+// WithLoader for the same store.
+func WithStorer(storer ipldbridge.Storer) RequestOption {
+	return requestmanager.WithStorer(storer)
+}
+
+// RequestReceivedHookActions are actions that a request hook can take to
+// change the response to an incoming request.
+type RequestReceivedHookActions = responsemanager.RequestReceivedHookActions
+
+// RequestReceivedHook is run on the responder when a new request is received,
+// before it is queued for processing.
+type RequestReceivedHook = responsemanager.RequestReceivedHook
+
+// RequestUpdatedHookActions are actions that an update hook can take in
+// response to new extension data for an in progress request.
+type RequestUpdatedHookActions = responsemanager.RequestUpdatedHookActions
+
+// RequestUpdatedHook is run on the responder when a requester sends an update
+// for an in progress request.
+type RequestUpdatedHook = responsemanager.RequestUpdatedHook
+
+// OutgoingBlockHookActions are actions that an outgoing block hook can take
+// to change the course of a response.
+type OutgoingBlockHookActions = responsemanager.OutgoingBlockHookActions
+
+// OutgoingBlockHook is run on the responder each time a block is sent for a
+// request.
+type OutgoingBlockHook = responsemanager.OutgoingBlockHook
+
+// TraversalBudget limits how many blocks and bytes the responder sends for a
+// request, how deep it follows links and how long it traverses for. A zero
+// field means no limit. A response that goes over budget completes with
+// RequestCompletedPartial, and the name of the limit hit is sent with the
+// graphsync/budget-exceeded extension.
+type TraversalBudget = loader.Budget
+
+// BudgetLimit names the limit in a TraversalBudget that a response hit
+type BudgetLimit = loader.BudgetLimit
+
+const (
+	// BlocksLimit is hit when a response reaches TraversalBudget.MaxBlocks
+	BlocksLimit = loader.BlocksLimit
+	// BytesLimit is hit when a response would go over TraversalBudget.MaxBytes
+	BytesLimit = loader.BytesLimit
+	// LinkDepthLimit is hit when links deeper than TraversalBudget.MaxLinkDepth
+	// are skipped
+	LinkDepthLimit = loader.LinkDepthLimit
+	// DurationLimit is hit when a traversal runs past TraversalBudget.MaxDuration
+	DurationLimit = loader.DurationLimit
+	// PeerBlocksLimit is hit when a peer's responses together reach MaxBlocks
+	// in the peer's shared budget
+	PeerBlocksLimit = loader.PeerBlocksLimit
+	// PeerBytesLimit is hit when a peer's responses together would go over
+	// MaxBytes in the peer's shared budget
+	PeerBytesLimit = loader.PeerBytesLimit
+)
+
+// BandwidthLimiter decides how fast the responder sends block data to each
+// peer, for example to give peers different service levels.
+type BandwidthLimiter = bandwidth.Limiter
+
+// BandwidthRate is a sustained rate in bytes per second, and a burst of bytes
+// that can be sent at once. A zero rate means no limit.
+type BandwidthRate = bandwidth.Rate
+
+// ContextLoader loads blocks like an ipld Loader, and is also passed a context
+// for the request the block is loaded for. The peer and ID of the request can
+// be read from the context with RequestPeerFromContext and
+// RequestIDFromContext, so blocks can be kept apart per peer or per request.
+type ContextLoader = ipldbridge.ContextLoader
+
+// ContextStorer stores blocks like an ipld Storer, and is also passed a
+// context for the request the block is stored for, as ContextLoader is.
+type ContextStorer = ipldbridge.ContextStorer
+
+// RequestPeerFromContext returns the peer of the request a ContextLoader or
+// ContextStorer is called for. For outgoing requests sent to several peers, it
+// is the first peer the request was sent to.
+func RequestPeerFromContext(ctx context.Context) (peer.ID, bool) {
+	return requestcontext.Peer(ctx)
+}
+
+// RequestIDFromContext returns the ID of the request a ContextLoader or
+// ContextStorer is called for. Incoming and outgoing requests are numbered
+// separately, so the ID is only unique together with the peer.
+func RequestIDFromContext(ctx context.Context) (gsmsg.GraphSyncRequestID, bool) {
+	return requestcontext.RequestID(ctx)
+}
+
 // GraphSync is an instance of a GraphSync exchange that implements
 // the graphsync protocol.
 type GraphSync struct {
 	ipldBridge          ipldbridge.IPLDBridge
 	network             gsnet.GraphSyncNetwork
-	loader              ipldbridge.Loader
-	storer              ipldbridge.Storer
+	loader              ipldbridge.ContextLoader
+	storer              ipldbridge.ContextStorer
 	requestManager      *requestmanager.RequestManager
 	responseManager     *responsemanager.ResponseManager
 	asyncLoader         *asyncloader.AsyncLoader
@@ -41,32 +269,205 @@ type GraphSync struct {
 	peerManager         *peermanager.PeerMessageManager
 	ctx                 context.Context
 	cancel              context.CancelFunc
+	// libp2p reports each connection to a peer separately
+	connectionsLk sync.Mutex
+	connections   map[peer.ID]int
+}
+
+type graphSyncConfigs struct {
+	loader                    ipldbridge.ContextLoader
+	storer                    ipldbridge.ContextStorer
+	asyncLoaderOptions        []asyncloader.Option
+	requestManagerOptions     []requestmanager.Option
+	responseManagerOptions    []responsemanager.Option
+	messageQueueOptions       []messagequeue.Option
+	peerResponseSenderOptions []peerresponsemanager.Option
+}
+
+// Option configures a GraphSync exchange when it is created with New.
+type Option func(*graphSyncConfigs)
+
+// MaxInProcessRequests sets how many incoming requests the responder works on
+// at once. The default is 6.
+func MaxInProcessRequests(maxInProcessRequests int) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.responseManagerOptions = append(gsc.responseManagerOptions, responsemanager.MaxInProcessRequests(maxInProcessRequests))
+	}
+}
+
+// ThawSpeed sets how often peers that have received their share of the
+// responder's work are allowed more. The default is 100 milliseconds.
+func ThawSpeed(thawSpeed time.Duration) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.responseManagerOptions = append(gsc.responseManagerOptions, responsemanager.ThawSpeed(thawSpeed))
+	}
+}
+
+// MaxQueuedResponses limits how many incoming requests can wait for a worker,
+// as SetMaxQueuedResponses does. There is no limit by default.
+func MaxQueuedResponses(maxQueuedResponses int, retryAfter time.Duration) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.responseManagerOptions = append(gsc.responseManagerOptions, responsemanager.MaxQueuedResponses(maxQueuedResponses, retryAfter))
+	}
+}
+
+// MaxSendRetries sets how many times a message is sent to a peer before its
+// requests fail with a NetworkError. The default is 10.
+func MaxSendRetries(maxRetries int) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.messageQueueOptions = append(gsc.messageQueueOptions, messagequeue.MaxRetries(maxRetries))
+	}
+}
+
+// SendRetryDelay sets how long to wait after a failed send before trying
+// again. The default is 100 milliseconds.
+func SendRetryDelay(retryDelay time.Duration) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.messageQueueOptions = append(gsc.messageQueueOptions, messagequeue.RetryDelay(retryDelay))
+	}
+}
+
+// SendMessageTimeout sets how long a single attempt to send a message to a
+// peer may take. By default the network's own timeout applies.
+func SendMessageTimeout(sendMessageTimeout time.Duration) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.messageQueueOptions = append(gsc.messageQueueOptions, messagequeue.SendMessageTimeout(sendMessageTimeout))
+	}
+}
+
+// ConnectTimeout sets how long to allow for connecting to a peer before
+// sending it messages. The default is 10 minutes.
+func ConnectTimeout(connectTimeout time.Duration) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.messageQueueOptions = append(gsc.messageQueueOptions, messagequeue.ConnectTimeout(connectTimeout))
+	}
+}
+
+// MessageBufferSize sets how many messages the request and response managers
+// buffer before callers block. The default is 16.
+func MessageBufferSize(messageBufferSize int) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.requestManagerOptions = append(gsc.requestManagerOptions, requestmanager.MessageBufferSize(messageBufferSize))
+		gsc.responseManagerOptions = append(gsc.responseManagerOptions, responsemanager.MessageBufferSize(messageBufferSize))
+	}
+}
+
+// DefaultTraversalBudget sets the budget for each response to peers that have
+// no default set with SetPeerDefaultTraversalBudget. There is no budget by
+// default.
+func DefaultTraversalBudget(budget TraversalBudget) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.responseManagerOptions = append(gsc.responseManagerOptions, responsemanager.DefaultBudget(budget))
+	}
+}
+
+// DefaultPeerTraversalBudget sets the budget shared by all the responses in
+// progress to each peer that has none set with SetPeerTraversalBudget. Only
+// MaxBlocks and MaxBytes are shared. There is no shared budget by default.
+func DefaultPeerTraversalBudget(budget TraversalBudget) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.responseManagerOptions = append(gsc.responseManagerOptions, responsemanager.DefaultPeerBudget(budget))
+	}
+}
+
+// MaxMessageSize sets the size in bytes at which outgoing messages are split.
+// Blocks are never split, and each response is kept in the same message as
+// its blocks. The default is 1 MiB.
+func MaxMessageSize(maxMessageSize int) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.messageQueueOptions = append(gsc.messageQueueOptions, messagequeue.MaxMessageSize(maxMessageSize))
+		gsc.peerResponseSenderOptions = append(gsc.peerResponseSenderOptions, peerresponsemanager.MaxMessageSize(maxMessageSize))
+	}
+}
+
+// MaxUnverifiedBlockMemory limits how many bytes of blocks received from each
+// responder are held in memory waiting for a request's traversal to reach
+// them. Once a responder reaches the limit, messages from it are not read
+// from the network until traversals catch up, which slows that responder down
+// without holding up others. Copies of blocks a traversal already loaded from
+// the local store are dropped as they arrive. There is no limit by default.
+func MaxUnverifiedBlockMemory(maxUnverifiedBlockMemory uint64) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.asyncLoaderOptions = append(gsc.asyncLoaderOptions, asyncloader.MaxUnverifiedBlockMemory(maxUnverifiedBlockMemory))
+	}
+}
+
+// SpillUnverifiedBlocksToDisk writes blocks received from responders that do
+// not fit in the memory set with MaxUnverifiedBlockMemory to a temporary file
+// in the given directory, rather than holding up the network. An empty
+// directory means the system temporary directory. The file is removed on
+// Shutdown.
+func SpillUnverifiedBlocksToDisk(dir string) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.asyncLoaderOptions = append(gsc.asyncLoaderOptions, asyncloader.SpillUnverifiedBlocksToDisk(dir))
+	}
+}
+
+// MaxBandwidth limits how fast the responder sends block data, to all peers
+// together and to each peer. There is no limit by default.
+func MaxBandwidth(global BandwidthRate, perPeer BandwidthRate) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.peerResponseSenderOptions = append(gsc.peerResponseSenderOptions, peerresponsemanager.BandwidthLimiter(bandwidth.NewTokenBucketLimiter(global, perPeer)))
+	}
+}
+
+// UseBandwidthLimiter has the responder send block data as fast as the given
+// limiter allows, in place of MaxBandwidth.
+func UseBandwidthLimiter(limiter BandwidthLimiter) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.peerResponseSenderOptions = append(gsc.peerResponseSenderOptions, peerresponsemanager.BandwidthLimiter(limiter))
+	}
+}
+
+// UseContextLoader loads blocks with the given loader in place of the loader
+// passed to New.
+func UseContextLoader(loader ContextLoader) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.loader = loader
+	}
+}
+
+// UseContextStorer stores blocks with the given storer in place of the storer
+// passed to New.
+func UseContextStorer(storer ContextStorer) Option {
+	return func(gsc *graphSyncConfigs) {
+		gsc.storer = storer
+	}
 }
 
 // New creates a new GraphSync Exchange on the given network,
 // using the given bridge to IPLD and the given link loader.
 func New(parent context.Context, network gsnet.GraphSyncNetwork,
 	ipldBridge ipldbridge.IPLDBridge, loader ipldbridge.Loader,
-	storer ipldbridge.Storer) *GraphSync {
+	storer ipldbridge.Storer, options ...Option) *GraphSync {
 	ctx, cancel := context.WithCancel(parent)
 
+	gsConfigs := graphSyncConfigs{
+		loader: ipldbridge.LoaderWithContext(loader),
+		storer: ipldbridge.StorerWithContext(storer),
+	}
+	for _, option := range options {
+		option(&gsConfigs)
+	}
+
+	asyncLoader := asyncloader.New(ctx, gsConfigs.loader, gsConfigs.storer, gsConfigs.asyncLoaderOptions...)
+	gsConfigs.requestManagerOptions = append(gsConfigs.requestManagerOptions, requestmanager.UseAddressBook(network))
+	requestManager := requestmanager.New(ctx, asyncLoader, ipldBridge, gsConfigs.requestManagerOptions...)
 	createMessageQueue := func(ctx context.Context, p peer.ID) peermanager.PeerQueue {
-		return messagequeue.New(ctx, p, network)
+		return messagequeue.New(ctx, p, network, requestManager.ProcessDeliveryFailure, gsConfigs.messageQueueOptions...)
 	}
 	peerManager := peermanager.NewMessageManager(ctx, createMessageQueue)
-	asyncLoader := asyncloader.New(ctx, loader, storer)
-	requestManager := requestmanager.New(ctx, asyncLoader, ipldBridge)
 	peerTaskQueue := peertaskqueue.New()
 	createdResponseQueue := func(ctx context.Context, p peer.ID) peerresponsemanager.PeerResponseSender {
-		return peerresponsemanager.NewResponseSender(ctx, p, peerManager, ipldBridge)
+		return peerresponsemanager.NewResponseSender(ctx, p, peerManager, ipldBridge, gsConfigs.peerResponseSenderOptions...)
 	}
 	peerResponseManager := peerresponsemanager.New(ctx, createdResponseQueue)
-	responseManager := responsemanager.New(ctx, loader, ipldBridge, peerResponseManager, peerTaskQueue)
+	responseManager := responsemanager.New(ctx, gsConfigs.loader, ipldBridge, peerResponseManager, peerTaskQueue, gsConfigs.responseManagerOptions...)
 	graphSync := &GraphSync{
 		ipldBridge:          ipldBridge,
 		network:             network,
-		loader:              loader,
-		storer:              storer,
+		loader:              gsConfigs.loader,
+		storer:              gsConfigs.storer,
 		asyncLoader:         asyncLoader,
 		requestManager:      requestManager,
 		peerManager:         peerManager,
@@ -75,6 +476,7 @@ func New(parent context.Context, network gsnet.GraphSyncNetwork,
 		responseManager:     responseManager,
 		ctx:                 ctx,
 		cancel:              cancel,
+		connections:         make(map[peer.ID]int),
 	}
 
 	asyncLoader.Startup()
@@ -86,8 +488,129 @@ func New(parent context.Context, network gsnet.GraphSyncNetwork,
 }
 
 // Request initiates a new GraphSync request to the given peer using the given selector spec.
-func (gs *GraphSync) Request(ctx context.Context, p peer.ID, rootedSelector ipld.Node) (<-chan ResponseProgress, <-chan error) {
-	return gs.requestManager.SendRequest(ctx, p, rootedSelector)
+func (gs *GraphSync) Request(ctx context.Context, p peer.ID, rootedSelector ipld.Node, options ...RequestOption) (<-chan ResponseProgress, <-chan error) {
+	return gs.requestManager.SendRequest(ctx, p, rootedSelector, options...)
+}
+
+// RequestFromPeers initiates a new GraphSync request to several peers at once
+// using the given selector spec. Blocks are taken from whichever peer sends
+// them first, and the request fails only when every peer has failed.
+func (gs *GraphSync) RequestFromPeers(ctx context.Context, peers []peer.ID, rootedSelector ipld.Node, options ...RequestOption) (<-chan ResponseProgress, <-chan error) {
+	return gs.requestManager.RequestFromPeers(ctx, peers, rootedSelector, options...)
+}
+
+// PauseRequest asks the peer responding to the given request to pause its
+// response. The responder acknowledges the pause with ErrRequestPaused on the
+// request's error channel.
+func (gs *GraphSync) PauseRequest(requestID gsmsg.GraphSyncRequestID) error {
+	return gs.requestManager.PauseRequest(requestID)
+}
+
+// UnpauseRequest asks the peer responding to the given request to resume a
+// response paused with PauseRequest.
+func (gs *GraphSync) UnpauseRequest(requestID gsmsg.GraphSyncRequestID) error {
+	return gs.requestManager.UnpauseRequest(requestID)
+}
+
+// UpdateRequest sends new extension data to the peer responding to the given
+// request, which is passed to the responder's request updated hooks.
+func (gs *GraphSync) UpdateRequest(requestID gsmsg.GraphSyncRequestID, extensions ...ExtensionData) error {
+	return gs.requestManager.UpdateRequest(requestID, extensions...)
+}
+
+// UnverifiedBlockMemory returns how many bytes of blocks received from
+// responders are held in memory waiting for a request's traversal to reach
+// them.
+func (gs *GraphSync) UnverifiedBlockMemory() uint64 {
+	return gs.asyncLoader.UnverifiedBlockMemory()
+}
+
+// SetMaxQueuedResponses limits how many incoming requests can wait for a
+// worker. Requests beyond the limit are refused with RequestFailedBusy and a
+// hint to retry after the given duration. Zero means no limit.
+func (gs *GraphSync) SetMaxQueuedResponses(maxQueuedResponses int, retryAfter time.Duration) {
+	gs.responseManager.SetMaxQueuedResponses(maxQueuedResponses, retryAfter)
+}
+
+// SetPeerDefaultTraversalBudget sets the budget for each response to requests
+// the given peer makes from now on, in place of the default. The budget is
+// per request, so a peer making several requests can be sent several budgets'
+// worth of blocks, up to its budget set with SetPeerTraversalBudget. A request
+// received hook can still set the budget for a single request.
+func (gs *GraphSync) SetPeerDefaultTraversalBudget(p peer.ID, budget TraversalBudget) {
+	gs.responseManager.SetPeerDefaultBudget(p, budget)
+}
+
+// SetPeerTraversalBudget sets the budget shared by all the responses in
+// progress to the given peer, in place of the default peer budget. Only
+// MaxBlocks and MaxBytes are shared, and what a response spent is given back
+// when it finishes.
+func (gs *GraphSync) SetPeerTraversalBudget(p peer.ID, budget TraversalBudget) {
+	gs.responseManager.SetPeerBudget(p, budget)
+}
+
+// RegisterRequestReceivedHook adds a hook that runs when a request is received
+// from a peer. Hooks can inspect the request, reject it, or attach extension
+// data to the response.
+func (gs *GraphSync) RegisterRequestReceivedHook(hook RequestReceivedHook) {
+	gs.responseManager.RegisterRequestHook(hook)
+}
+
+// RegisterRequestUpdatedHook adds a hook that runs when a requester sends an
+// update for an in progress request. Hooks can attach extension data to the
+// response, or pause and unpause it.
+func (gs *GraphSync) RegisterRequestUpdatedHook(hook RequestUpdatedHook) {
+	gs.responseManager.RegisterUpdateHook(hook)
+}
+
+// RegisterOutgoingBlockHook adds a hook that runs each time a block is sent
+// in response to a request. Hooks can record the block, pause the response,
+// or terminate it with a status code.
+func (gs *GraphSync) RegisterOutgoingBlockHook(hook OutgoingBlockHook) {
+	gs.responseManager.RegisterBlockHook(hook)
+}
+
+// PauseResponse pauses an in progress response to the given peer. The peer
+// is notified, and no more blocks are sent until the response is unpaused.
+func (gs *GraphSync) PauseResponse(p peer.ID, requestID gsmsg.GraphSyncRequestID) error {
+	return gs.responseManager.PauseResponse(p, requestID)
+}
+
+// UnpauseResponse resumes a response to the given peer that was paused with
+// PauseResponse or by an outgoing block hook.
+func (gs *GraphSync) UnpauseResponse(p peer.ID, requestID gsmsg.GraphSyncRequestID) error {
+	return gs.responseManager.UnpauseResponse(p, requestID)
+}
+
+// Shutdown stops the GraphSync instance. It stops taking requests from the
+// network, cancels in progress requests with their peers, fails the responses
+// it is sending with RequestFailedUnknown, sends the messages still queued for
+// each peer, and then waits for its goroutines to exit. It returns the
+// context's error if the context ends before shutdown completes, in which case
+// any remaining work is abandoned.
+func (gs *GraphSync) Shutdown(ctx context.Context) error {
+	gs.network.Stop()
+	defer gs.cancel()
+	return gs.shutdown(ctx)
+}
+
+func (gs *GraphSync) shutdown(ctx context.Context) error {
+	if err := gs.requestManager.Shutdown(ctx); err != nil {
+		return err
+	}
+	if err := gs.responseManager.Shutdown(ctx); err != nil {
+		return err
+	}
+	// response senders hand their last responses to the message queues, so
+	// they are drained first
+	if err := gs.peerResponseManager.Shutdown(ctx); err != nil {
+		return err
+	}
+	if err := gs.peerManager.Shutdown(ctx); err != nil {
+		return err
+	}
+	gs.asyncLoader.Shutdown()
+	return nil
 }
 
 // ReceiveMessage is part of the networks Receiver interface and receives
@@ -97,9 +620,49 @@ func (gs *GraphSync) ReceiveMessage(
 	sender peer.ID,
 	incoming gsmsg.GraphSyncMessage) {
 	gs.responseManager.ProcessRequests(ctx, sender, incoming.Requests())
+	// holding up the network until there is room for the blocks slows the
+	// responder down to the pace of local traversals
+	var blocksSize uint64
+	for _, block := range incoming.Blocks() {
+		blocksSize += uint64(len(block.RawData()))
+	}
+	if blocksSize > 0 {
+		if err := gs.asyncLoader.ReserveUnverifiedBlockSpace(sender, blocksSize); err != nil {
+			return
+		}
+	}
 	gs.requestManager.ProcessResponses(sender, incoming.Responses(), incoming.Blocks())
 }
 
+// Connected is part of the network's Receiver interface and sets up message
+// queues and response senders for a newly connected peer
+func (gs *GraphSync) Connected(p peer.ID) {
+	gs.connectionsLk.Lock()
+	gs.connections[p]++
+	gs.connectionsLk.Unlock()
+	gs.peerManager.Connected(p)
+	gs.peerResponseManager.Connected(p)
+}
+
+// Disconnected is part of the network's Receiver interface and, once no
+// connections to a peer remain, terminates requests and responses for it and
+// shuts down its message queue and response sender
+func (gs *GraphSync) Disconnected(p peer.ID) {
+	gs.connectionsLk.Lock()
+	gs.connections[p]--
+	lastConnection := gs.connections[p] <= 0
+	if lastConnection {
+		delete(gs.connections, p)
+	}
+	gs.connectionsLk.Unlock()
+	if lastConnection {
+		gs.requestManager.Disconnected(p)
+		gs.responseManager.Disconnected(p)
+	}
+	gs.peerResponseManager.Disconnected(p)
+	gs.peerManager.Disconnected(p)
+}
+
 // ReceiveError is part of the network's Receiver interface and handles incoming
 // errors from the network.
 func (gs *GraphSync) ReceiveError(err error) {
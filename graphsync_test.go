@@ -3,9 +3,11 @@ package graphsync
 import (
 	"context"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,12 +16,15 @@ import (
 	"github.com/ipfs/go-block-format"
 	cid "github.com/ipfs/go-cid"
 
+	"github.com/ipfs/go-graphsync/ipldbridge"
 	gsmsg "github.com/ipfs/go-graphsync/message"
 	gsnet "github.com/ipfs/go-graphsync/network"
 	"github.com/ipfs/go-graphsync/testbridge"
 	"github.com/ipfs/go-graphsync/testutil"
 	ipld "github.com/ipld/go-ipld-prime"
+	host "github.com/libp2p/go-libp2p-host"
 	"github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
 	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
 )
 
@@ -47,6 +52,12 @@ func (r *receiver) ReceiveMessage(
 func (r *receiver) ReceiveError(err error) {
 }
 
+func (r *receiver) Connected(p peer.ID) {
+}
+
+func (r *receiver) Disconnected(p peer.ID) {
+}
+
 func TestMakeRequestToNetwork(t *testing.T) {
 	// create network
 	ctx := context.Background()
@@ -84,9 +95,14 @@ func TestMakeRequestToNetwork(t *testing.T) {
 
 	cids := testutil.GenerateCids(5)
 	spec := testbridge.NewMockSelectorSpec(cids)
+	extensionName := ExtensionName("graphsync/awesome")
+	extension := ExtensionData{
+		Name: extensionName,
+		Data: testutil.RandomBytes(100),
+	}
 	requestCtx, requestCancel := context.WithCancel(ctx)
 	defer requestCancel()
-	graphSync.Request(requestCtx, host2.ID(), spec)
+	graphSync.Request(requestCtx, host2.ID(), spec, WithExtensions(extension))
 
 	var message receivedMessage
 	select {
@@ -113,6 +129,60 @@ func TestMakeRequestToNetwork(t *testing.T) {
 	if !reflect.DeepEqual(spec, receivedSpec) {
 		t.Fatal("did not transmit selector spec correctly")
 	}
+	returnedData, found := receivedRequest.Extension(extensionName)
+	if !found || !reflect.DeepEqual(extension.Data, returnedData) {
+		t.Fatal("did not transmit extension data correctly")
+	}
+}
+
+func TestRequestOutlivesOneOfSeveralConnections(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	td := newGsTestData(ctx, t, 2)
+
+	// setup receiving peer to just record message coming in
+	r := &receiver{
+		messageReceived: make(chan receivedMessage),
+	}
+	td.gsnets[1].SetDelegate(r)
+
+	graphSync := td.graphSync(0)
+
+	requestCtx, requestCancel := context.WithCancel(ctx)
+	defer requestCancel()
+	_, errChan := graphSync.Request(requestCtx, td.hosts[1].ID(), td.spec)
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("did not receive message sent")
+	case <-r.messageReceived:
+	}
+
+	// a second connection to the same peer stays open after the first closes
+	graphSync.Connected(td.hosts[1].ID())
+	err := td.mn.DisconnectPeers(td.hosts[0].ID(), td.hosts[1].ID())
+	if err != nil {
+		t.Fatal("error disconnecting hosts")
+	}
+	timer := time.NewTimer(100 * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case err := <-errChan:
+		t.Fatalf("request failed while a connection remained: %v", err)
+	}
+
+	graphSync.Disconnected(td.hosts[1].ID())
+	select {
+	case <-ctx.Done():
+		t.Fatal("request did not fail when the last connection closed")
+	case err := <-errChan:
+		if err == nil {
+			t.Fatal("request did not fail when the last connection closed")
+		}
+	}
 }
 
 func TestSendResponseToIncomingRequest(t *testing.T) {
@@ -274,7 +344,11 @@ func TestGraphsyncRoundTrip(t *testing.T) {
 
 	spec := testbridge.NewMockSelectorSpec(cids)
 
-	progressChan, errChan := requestor.Request(ctx, host2.ID(), spec)
+	resultChan := make(chan RequestResult, 1)
+	progressChan, errChan := requestor.Request(ctx, host2.ID(), spec,
+		WithResultCallback(func(result RequestResult) {
+			resultChan <- result
+		}))
 
 	responses := testutil.CollectResponses(ctx, t, progressChan)
 	errs := testutil.CollectErrors(ctx, t, errChan)
@@ -283,6 +357,23 @@ func TestGraphsyncRoundTrip(t *testing.T) {
 	if len(errs) != 1 || errs[0].Error() != expectedErr {
 		t.Fatal("did not transmit error for missing CID")
 	}
+	missingBlockError, ok := errs[0].(MissingBlockError)
+	if !ok || missingBlockError.Link != (cidlink.Link{Cid: unknownCid}) ||
+		missingBlockError.Peer != host2.ID() {
+		t.Fatal("did not transmit typed error for missing CID")
+	}
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("did not receive request result")
+	case result := <-resultChan:
+		if result.Status != gsmsg.RequestCompletedPartial {
+			t.Fatal("did not report partial completion")
+		}
+		if len(result.MissingLinks) != 1 || result.MissingLinks[0] != (cidlink.Link{Cid: unknownCid}) {
+			t.Fatal("did not report missing CID")
+		}
+	}
 
 	if len(responses) != 6 {
 		t.Fatal("did not traverse all nodes")
@@ -311,3 +402,557 @@ func TestGraphsyncRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+func TestGraphsyncRoundTripWithOptions(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	td := newGsTestData(ctx, t, 2)
+
+	// replace the requestor's network with one that has options of its own
+	td.gsnets[0] = gsnet.NewFromLibp2pHost(td.hosts[0], gsnet.SendMessageTimeout(time.Second))
+	requestor := td.graphSync(0,
+		MessageBufferSize(1), MaxSendRetries(1), SendRetryDelay(time.Millisecond),
+		SendMessageTimeout(time.Second), ConnectTimeout(time.Second),
+		MaxUnverifiedBlockMemory(150))
+
+	td.storeBlocks(1)
+	td.graphSync(1,
+		MaxInProcessRequests(1), ThawSpeed(time.Millisecond), MaxQueuedResponses(1, time.Second),
+		MaxMessageSize(150))
+
+	progressChan, errChan := requestor.Request(ctx, td.hosts[1].ID(), td.spec)
+	responses := testutil.CollectResponses(ctx, t, progressChan)
+	errs := testutil.CollectErrors(ctx, t, errChan)
+	if len(errs) != 0 {
+		t.Fatal("errors during traverse")
+	}
+	if len(responses) != 5 || len(td.blockStores[0]) != 5 {
+		t.Fatal("did not traverse all nodes")
+	}
+}
+
+func TestGraphsyncRoundTripTraversalBudget(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	td := newGsTestData(ctx, t, 2)
+
+	requestor := td.graphSync(0)
+
+	td.storeBlocks(1)
+	td.graphSync(1, DefaultTraversalBudget(TraversalBudget{MaxBlocks: 2}))
+
+	resultChan := make(chan RequestResult, 1)
+	progressChan, errChan := requestor.Request(ctx, td.hosts[1].ID(), td.spec,
+		WithResultCallback(func(result RequestResult) {
+			resultChan <- result
+		}))
+	responses := testutil.CollectResponses(ctx, t, progressChan)
+	testutil.CollectErrors(ctx, t, errChan)
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("did not receive request result")
+	case result := <-resultChan:
+		if result.Status != gsmsg.RequestCompletedPartial {
+			t.Fatal("did not report partial completion")
+		}
+		if len(result.Extensions) != 1 ||
+			!reflect.DeepEqual(result.Extensions[0], gsmsg.BudgetExceededExtension(string(BlocksLimit))) {
+			t.Fatal("did not report exceeded budget limit")
+		}
+	}
+	if len(responses) != 2 || len(td.blockStores[0]) != 2 {
+		t.Fatal("traversed more nodes than the budget allows")
+	}
+}
+
+func TestGraphsyncRoundTripBandwidthLimit(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	td := newGsTestData(ctx, t, 2)
+
+	requestor := td.graphSync(0)
+
+	td.storeBlocks(1)
+	td.graphSync(1, MaxBandwidth(BandwidthRate{}, BandwidthRate{BytesPerSecond: 5000, Burst: 100}))
+
+	start := time.Now()
+	progressChan, errChan := requestor.Request(ctx, td.hosts[1].ID(), td.spec)
+	responses := testutil.CollectResponses(ctx, t, progressChan)
+	errs := testutil.CollectErrors(ctx, t, errChan)
+	if len(errs) != 0 {
+		t.Fatal("errors during traverse")
+	}
+	if len(responses) != 5 || len(td.blockStores[0]) != 5 {
+		t.Fatal("did not traverse all nodes")
+	}
+	// after the first block's burst, each block waits 20 milliseconds
+	if time.Since(start) < 60*time.Millisecond {
+		t.Fatal("did not limit bandwidth")
+	}
+}
+
+func TestGraphsyncRoundTripRequestLoaderAndStorer(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	td := newGsTestData(ctx, t, 2)
+
+	requestor := td.graphSync(0)
+
+	td.storeBlocks(1)
+	td.graphSync(1)
+
+	stagingStore := make(map[ipld.Link][]byte)
+	stagingLoader, stagingStorer := testbridge.NewMockStore(stagingStore)
+	progressChan, errChan := requestor.Request(ctx, td.hosts[1].ID(), td.spec,
+		WithLoader(stagingLoader), WithStorer(stagingStorer))
+	responses := testutil.CollectResponses(ctx, t, progressChan)
+	errs := testutil.CollectErrors(ctx, t, errChan)
+	if len(errs) != 0 {
+		t.Fatal("errors during traverse")
+	}
+	if len(responses) != 5 || len(stagingStore) != 5 {
+		t.Fatal("did not traverse all nodes into request's store")
+	}
+	if len(td.blockStores[0]) != 0 {
+		t.Fatal("should not store blocks for request in local store")
+	}
+}
+
+func TestGraphsyncRoundTripRequestContext(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	td := newGsTestData(ctx, t, 2)
+
+	type requestInfo struct {
+		p         peer.ID
+		requestID gsmsg.GraphSyncRequestID
+	}
+	var requestsLk sync.Mutex
+	var storedFor, loadedFor []requestInfo
+	recordRequest := func(ctx context.Context, requests *[]requestInfo) {
+		p, _ := RequestPeerFromContext(ctx)
+		requestID, _ := RequestIDFromContext(ctx)
+		requestsLk.Lock()
+		*requests = append(*requests, requestInfo{p, requestID})
+		requestsLk.Unlock()
+	}
+
+	contextStorer := func(ctx context.Context, lnkCtx ipldbridge.LinkContext) (io.Writer, ipldbridge.StoreCommitter, error) {
+		recordRequest(ctx, &storedFor)
+		return td.storers[0](lnkCtx)
+	}
+	requestor := td.graphSync(0, UseContextStorer(contextStorer))
+
+	td.storeBlocks(1)
+	contextLoader := func(ctx context.Context, lnk ipld.Link, lnkCtx ipldbridge.LinkContext) (io.Reader, error) {
+		recordRequest(ctx, &loadedFor)
+		return td.loaders[1](lnk, lnkCtx)
+	}
+	td.graphSync(1, UseContextLoader(contextLoader))
+
+	var requestID gsmsg.GraphSyncRequestID
+	progressChan, errChan := requestor.Request(ctx, td.hosts[1].ID(), td.spec,
+		WithRequestIDCallback(func(id gsmsg.GraphSyncRequestID) { requestID = id }))
+	responses := testutil.CollectResponses(ctx, t, progressChan)
+	errs := testutil.CollectErrors(ctx, t, errChan)
+	if len(errs) != 0 {
+		t.Fatal("errors during traverse")
+	}
+	if len(responses) != 5 || len(td.blockStores[0]) != 5 {
+		t.Fatal("did not traverse all nodes")
+	}
+
+	requestsLk.Lock()
+	defer requestsLk.Unlock()
+	if len(storedFor) != 5 || len(loadedFor) != 5 {
+		t.Fatal("should load and store blocks with context loader and storer")
+	}
+	for _, stored := range storedFor {
+		if stored.p != td.hosts[1].ID() || stored.requestID != requestID {
+			t.Fatal("should store blocks in context of outgoing request")
+		}
+	}
+	for _, loaded := range loadedFor {
+		if loaded.p != td.hosts[0].ID() || loaded.requestID != requestID {
+			t.Fatal("should load blocks in context of incoming request")
+		}
+	}
+}
+
+func TestGraphsyncRoundTripMultiplePeers(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	td := newGsTestData(ctx, t, 3)
+
+	requestor := td.graphSync(0)
+
+	// initialize graphsync on second node with none of the blocks
+	td.graphSync(1)
+
+	// initialize graphsync on third node with all of the blocks
+	td.storeBlocks(2)
+	td.graphSync(2)
+
+	progressChan, errChan := requestor.RequestFromPeers(ctx, []peer.ID{td.hosts[1].ID(), td.hosts[2].ID()}, td.spec)
+
+	responses := testutil.CollectResponses(ctx, t, progressChan)
+	testutil.VerifyEmptyErrors(ctx, t, errChan)
+
+	if len(responses) != 5 {
+		t.Fatal("did not traverse all nodes")
+	}
+	if len(td.blockStores[0]) != 5 {
+		t.Fatal("did not store all blocks")
+	}
+}
+
+func TestGraphsyncRoundTripFailover(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	td := newGsTestData(ctx, t, 3)
+
+	requestor := td.graphSync(0)
+
+	// initialize graphsync on second node with none of the blocks
+	td.graphSync(1)
+
+	// initialize graphsync on third node with all of the blocks
+	td.storeBlocks(2)
+	td.graphSync(2)
+
+	progressChan, errChan := requestor.Request(ctx, td.hosts[1].ID(), td.spec, WithFailoverPeers(td.hosts[2].ID()))
+
+	responses := testutil.CollectResponses(ctx, t, progressChan)
+	testutil.VerifyEmptyErrors(ctx, t, errChan)
+
+	if len(responses) != 5 {
+		t.Fatal("did not traverse all nodes")
+	}
+	if len(td.blockStores[0]) != 5 {
+		t.Fatal("did not store all blocks")
+	}
+}
+
+func TestGraphsyncRoundTripAdditionalPeers(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	td := newGsTestData(ctx, t, 3)
+
+	requestor := td.graphSync(0)
+
+	// initialize graphsync on second node to turn requests away, pointing
+	// to the third node
+	redirector := td.graphSync(1)
+	redirector.RegisterRequestReceivedHook(func(p peer.ID, request gsmsg.GraphSyncRequest, selectorSpec ipld.Node, hookActions RequestReceivedHookActions) {
+		hookActions.SendAdditionalPeers(pstore.PeerInfo{ID: td.hosts[2].ID(), Addrs: td.hosts[2].Addrs()})
+		hookActions.RejectRequest(gsmsg.RequestRejected)
+	})
+
+	// initialize graphsync on third node with all of the blocks
+	td.storeBlocks(2)
+	td.graphSync(2)
+
+	progressChan, errChan := requestor.Request(ctx, td.hosts[1].ID(), td.spec, WithFollowAdditionalPeers())
+
+	responses := testutil.CollectResponses(ctx, t, progressChan)
+	testutil.VerifyEmptyErrors(ctx, t, errChan)
+
+	if len(responses) != 5 {
+		t.Fatal("did not traverse all nodes")
+	}
+	if len(td.blockStores[0]) != 5 {
+		t.Fatal("did not store all blocks")
+	}
+}
+
+func TestGraphsyncRequestRejectedByHook(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	td := newGsTestData(ctx, t, 2)
+
+	requestor := td.graphSync(0)
+
+	// initialize graphsync on second node to reject requests from unknown peers
+	td.storeBlocks(1)
+	responder := td.graphSync(1)
+	responder.RegisterRequestReceivedHook(func(p peer.ID, request gsmsg.GraphSyncRequest, selectorSpec ipld.Node, hookActions RequestReceivedHookActions) {
+		if p == td.hosts[0].ID() {
+			hookActions.RejectRequest(gsmsg.RequestRejected)
+		}
+	})
+
+	progressChan, errChan := requestor.Request(ctx, td.hosts[1].ID(), td.spec)
+
+	responses := testutil.CollectResponses(ctx, t, progressChan)
+	errs := testutil.CollectErrors(ctx, t, errChan)
+
+	if len(responses) != 0 {
+		t.Fatal("should not have sent responses for rejected request")
+	}
+	if len(errs) == 0 || errs[len(errs)-1].Error() != "Request Failed - Rejected By Peer" {
+		t.Fatal("did not transmit error for rejected request")
+	}
+	requestFailedError, ok := errs[len(errs)-1].(RequestFailedError)
+	if !ok || requestFailedError.Status != gsmsg.RequestRejected || requestFailedError.Peer != td.hosts[1].ID() {
+		t.Fatal("did not transmit typed error for rejected request")
+	}
+	if len(td.blockStores[0]) != 0 {
+		t.Fatal("should not have stored blocks for rejected request")
+	}
+}
+
+func TestGraphsyncRoundTripPauseAndUnpause(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	td := newGsTestData(ctx, t, 2)
+
+	requestor := td.graphSync(0)
+
+	// initialize graphsync on second node to pause after the second block
+	td.storeBlocks(1)
+	responder := td.graphSync(1)
+	pausedRequests := make(chan gsmsg.GraphSyncRequestID, 1)
+	blocksSent := 0
+	responder.RegisterOutgoingBlockHook(func(p peer.ID, requestID gsmsg.GraphSyncRequestID, link ipld.Link, blockSize uint64, hookActions OutgoingBlockHookActions) {
+		blocksSent++
+		if blocksSent == 2 {
+			hookActions.PauseResponse()
+			pausedRequests <- requestID
+		}
+	})
+
+	progressChan, errChan := requestor.Request(ctx, td.hosts[1].ID(), td.spec)
+
+	responses := testutil.ReadNResponses(ctx, t, progressChan, 2)
+	select {
+	case <-ctx.Done():
+		t.Fatal("should have been notified request was paused")
+	case err := <-errChan:
+		if err != ErrRequestPaused {
+			t.Fatal("should have sent paused notice")
+		}
+	}
+
+	var requestID gsmsg.GraphSyncRequestID
+	select {
+	case <-ctx.Done():
+		t.Fatal("responder should have paused request")
+	case requestID = <-pausedRequests:
+	}
+	err := responder.UnpauseResponse(td.hosts[0].ID(), requestID)
+	if err != nil {
+		t.Fatal("should be able to unpause response")
+	}
+
+	responses = append(responses, testutil.CollectResponses(ctx, t, progressChan)...)
+	testutil.VerifyEmptyErrors(ctx, t, errChan)
+	if len(responses) != 5 {
+		t.Fatal("did not traverse all nodes")
+	}
+	if len(td.blockStores[0]) != 5 {
+		t.Fatal("did not store all blocks")
+	}
+}
+
+func TestGraphsyncRoundTripRequesterUpdateAndUnpause(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	td := newGsTestData(ctx, t, 2)
+
+	requestor := td.graphSync(0)
+
+	// initialize graphsync on second node to pause after the second block,
+	// and to record updates from the requestor
+	td.storeBlocks(1)
+	responder := td.graphSync(1)
+	blocksSent := 0
+	responder.RegisterOutgoingBlockHook(func(p peer.ID, requestID gsmsg.GraphSyncRequestID, link ipld.Link, blockSize uint64, hookActions OutgoingBlockHookActions) {
+		blocksSent++
+		if blocksSent == 2 {
+			hookActions.PauseResponse()
+		}
+	})
+	extensionName := ExtensionName("graphsync/awesome")
+	extensionData := testutil.RandomBytes(100)
+	receivedUpdates := make(chan []byte, 1)
+	responder.RegisterRequestUpdatedHook(func(p peer.ID, request gsmsg.GraphSyncRequest, update gsmsg.GraphSyncRequest, hookActions RequestUpdatedHookActions) {
+		data, has := update.Extension(extensionName)
+		if has {
+			receivedUpdates <- data
+		}
+	})
+
+	var requestID gsmsg.GraphSyncRequestID
+	progressChan, errChan := requestor.Request(ctx, td.hosts[1].ID(), td.spec,
+		WithRequestIDCallback(func(id gsmsg.GraphSyncRequestID) { requestID = id }))
+
+	responses := testutil.ReadNResponses(ctx, t, progressChan, 2)
+	select {
+	case <-ctx.Done():
+		t.Fatal("should have been notified request was paused")
+	case err := <-errChan:
+		if err != ErrRequestPaused {
+			t.Fatal("should have sent paused notice")
+		}
+	}
+
+	err := requestor.UpdateRequest(requestID, ExtensionData{Name: extensionName, Data: extensionData})
+	if err != nil {
+		t.Fatal("should be able to update request")
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("responder should have received update")
+	case data := <-receivedUpdates:
+		if !reflect.DeepEqual(data, extensionData) {
+			t.Fatal("responder received incorrect update data")
+		}
+	}
+
+	err = requestor.UnpauseRequest(requestID)
+	if err != nil {
+		t.Fatal("should be able to unpause request")
+	}
+
+	responses = append(responses, testutil.CollectResponses(ctx, t, progressChan)...)
+	testutil.VerifyEmptyErrors(ctx, t, errChan)
+	if len(responses) != 5 {
+		t.Fatal("did not traverse all nodes")
+	}
+	if len(td.blockStores[0]) != 5 {
+		t.Fatal("did not store all blocks")
+	}
+}
+
+func TestGraphsyncShutdown(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	td := newGsTestData(ctx, t, 3)
+
+	requestor := td.graphSync(0)
+
+	td.storeBlocks(1)
+	responder := td.graphSync(1)
+
+	lateRequestor := td.graphSync(2, MaxSendRetries(1), SendRetryDelay(time.Millisecond))
+
+	progressChan, errChan := requestor.Request(ctx, td.hosts[1].ID(), td.spec)
+	responses := testutil.CollectResponses(ctx, t, progressChan)
+	testutil.VerifyEmptyErrors(ctx, t, errChan)
+	if len(responses) != 5 {
+		t.Fatal("did not traverse all nodes")
+	}
+
+	if err := requestor.Shutdown(ctx); err != nil {
+		t.Fatal("requestor did not shut down cleanly")
+	}
+	if err := responder.Shutdown(ctx); err != nil {
+		t.Fatal("responder did not shut down cleanly")
+	}
+	if requestor.ctx.Err() == nil || responder.ctx.Err() == nil {
+		t.Fatal("should cancel remaining work after shutting down cleanly")
+	}
+
+	progressChan, errChan = requestor.Request(ctx, td.hosts[1].ID(), td.spec)
+	testutil.CollectResponses(ctx, t, progressChan)
+	errs := testutil.CollectErrors(ctx, t, errChan)
+	if len(errs) != 1 || errs[0] != ErrShutdown {
+		t.Fatal("should not accept requests after shutting down")
+	}
+
+	// a responder that has shut down no longer handles graphsync streams
+	progressChan, errChan = lateRequestor.Request(ctx, td.hosts[1].ID(), td.spec)
+	testutil.CollectResponses(ctx, t, progressChan)
+	errs = testutil.CollectErrors(ctx, t, errChan)
+	if len(errs) != 1 {
+		t.Fatal("should have failed request to shut down responder")
+	}
+	if _, ok := errs[0].(NetworkError); !ok {
+		t.Fatal("should have failed request with network error")
+	}
+}
+
+// gsTestData is a mock network of linked hosts, each with a GraphSync network
+// and an empty block store, along with blocks to traverse and a selector spec
+// that visits them in order
+type gsTestData struct {
+	ctx         context.Context
+	mn          mocknet.Mocknet
+	hosts       []host.Host
+	gsnets      []gsnet.GraphSyncNetwork
+	blockStores []map[ipld.Link][]byte
+	loaders     []ipldbridge.Loader
+	storers     []ipldbridge.Storer
+	bridge      ipldbridge.IPLDBridge
+	blks        []blocks.Block
+	spec        ipld.Node
+}
+
+func newGsTestData(ctx context.Context, t *testing.T, numHosts int) *gsTestData {
+	td := &gsTestData{
+		ctx:    ctx,
+		mn:     mocknet.New(ctx),
+		bridge: testbridge.NewMockIPLDBridge(),
+		blks:   testutil.GenerateBlocksOfSize(5, 100),
+	}
+	for i := 0; i < numHosts; i++ {
+		peerHost, err := td.mn.GenPeer()
+		if err != nil {
+			t.Fatal("error generating host")
+		}
+		td.hosts = append(td.hosts, peerHost)
+		td.gsnets = append(td.gsnets, gsnet.NewFromLibp2pHost(peerHost))
+		blockStore := make(map[ipld.Link][]byte)
+		loader, storer := testbridge.NewMockStore(blockStore)
+		td.blockStores = append(td.blockStores, blockStore)
+		td.loaders = append(td.loaders, loader)
+		td.storers = append(td.storers, storer)
+	}
+	err := td.mn.LinkAll()
+	if err != nil {
+		t.Fatal("error linking hosts")
+	}
+	cids := make([]cid.Cid, 0, len(td.blks))
+	for _, block := range td.blks {
+		cids = append(cids, block.Cid())
+	}
+	td.spec = testbridge.NewMockSelectorSpec(cids)
+	return td
+}
+
+// storeBlocks puts all of the blocks to traverse in the given host's store
+func (td *gsTestData) storeBlocks(i int) {
+	for _, block := range td.blks {
+		td.blockStores[i][cidlink.Link{Cid: block.Cid()}] = block.RawData()
+	}
+}
+
+// graphSync initializes graphsync on the given host, using its block store
+func (td *gsTestData) graphSync(i int, options ...Option) *GraphSync {
+	return New(td.ctx, td.gsnets[i], td.bridge, td.loaders[i], td.storers[i], options...)
+}
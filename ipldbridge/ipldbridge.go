@@ -3,6 +3,7 @@ package ipldbridge
 import (
 	"context"
 	"errors"
+	"io"
 
 	"github.com/ipld/go-ipld-prime/fluent"
 
@@ -27,6 +28,31 @@ type Storer = ipld.Storer
 // StoreCommitter is an alias from ipld, in case it's renamed/moved.
 type StoreCommitter = ipld.StoreCommitter
 
+// ContextLoader is a Loader that is also passed a context scoped to the
+// request the link is loaded for. The LinkContext from ipld does not carry a
+// context yet, so it is passed alongside.
+type ContextLoader func(ctx context.Context, lnk ipld.Link, lnkCtx LinkContext) (io.Reader, error)
+
+// ContextStorer is a Storer that is also passed a context scoped to the
+// request the block is stored for.
+type ContextStorer func(ctx context.Context, lnkCtx LinkContext) (io.Writer, StoreCommitter, error)
+
+// LoaderWithContext makes a ContextLoader from a Loader that does not use the
+// request context.
+func LoaderWithContext(loader Loader) ContextLoader {
+	return func(ctx context.Context, lnk ipld.Link, lnkCtx LinkContext) (io.Reader, error) {
+		return loader(lnk, lnkCtx)
+	}
+}
+
+// StorerWithContext makes a ContextStorer from a Storer that does not use the
+// request context.
+func StorerWithContext(storer Storer) ContextStorer {
+	return func(ctx context.Context, lnkCtx LinkContext) (io.Writer, StoreCommitter, error) {
+		return storer(lnkCtx)
+	}
+}
+
 // AdvVisitFn is an alias from ipld, in case it's renamed/moved.
 type AdvVisitFn = ipldtraversal.AdvVisitFn
 
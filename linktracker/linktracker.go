@@ -14,6 +14,7 @@ type LinkTracker struct {
 	missingBlocks                     map[gsmsg.GraphSyncRequestID]map[ipld.Link]struct{}
 	linksWithBlocksTraversedByRequest map[gsmsg.GraphSyncRequestID][]ipld.Link
 	traversalsWithBlocksInProgress    map[ipld.Link]int
+	verifiedLinks                     map[gsmsg.GraphSyncRequestID]map[ipld.Link]struct{}
 }
 
 // New makes a new link tracker
@@ -22,6 +23,7 @@ func New() *LinkTracker {
 		missingBlocks:                     make(map[gsmsg.GraphSyncRequestID]map[ipld.Link]struct{}),
 		linksWithBlocksTraversedByRequest: make(map[gsmsg.GraphSyncRequestID][]ipld.Link),
 		traversalsWithBlocksInProgress:    make(map[ipld.Link]int),
+		verifiedLinks:                     make(map[gsmsg.GraphSyncRequestID]map[ipld.Link]struct{}),
 	}
 }
 
@@ -57,23 +59,64 @@ func (lt *LinkTracker) RecordLinkTraversal(requestID gsmsg.GraphSyncRequestID, l
 	}
 }
 
+// IsVerifiedLink returns whether the given request already verified the block
+// for the given link
+func (lt *LinkTracker) IsVerifiedLink(requestID gsmsg.GraphSyncRequestID, link ipld.Link) bool {
+	verifiedLinks, ok := lt.verifiedLinks[requestID]
+	if !ok {
+		return false
+	}
+	_, ok = verifiedLinks[link]
+	return ok
+}
+
+// RecordLinkVerification records that a request verified the block for a link,
+// so the request no longer holds references to other copies of the block
+func (lt *LinkTracker) RecordLinkVerification(requestID gsmsg.GraphSyncRequestID, link ipld.Link) {
+	verifiedLinks, ok := lt.verifiedLinks[requestID]
+	if !ok {
+		verifiedLinks = make(map[ipld.Link]struct{})
+		lt.verifiedLinks[requestID] = verifiedLinks
+	}
+	verifiedLinks[link] = struct{}{}
+	links := lt.linksWithBlocksTraversedByRequest[requestID]
+	remainingLinks := links[:0]
+	for _, traversedLink := range links {
+		if traversedLink != link {
+			remainingLinks = append(remainingLinks, traversedLink)
+			continue
+		}
+		lt.releaseBlock(link)
+	}
+	if len(remainingLinks) == 0 {
+		delete(lt.linksWithBlocksTraversedByRequest, requestID)
+	} else {
+		lt.linksWithBlocksTraversedByRequest[requestID] = remainingLinks
+	}
+}
+
 // FinishRequest records that we have completed the given request, and returns
 // true if all links traversed had blocks present.
 func (lt *LinkTracker) FinishRequest(requestID gsmsg.GraphSyncRequestID) (hasAllBlocks bool) {
 	_, ok := lt.missingBlocks[requestID]
 	hasAllBlocks = !ok
 	delete(lt.missingBlocks, requestID)
+	delete(lt.verifiedLinks, requestID)
 	links, ok := lt.linksWithBlocksTraversedByRequest[requestID]
 	if !ok {
 		return
 	}
 	for _, link := range links {
-		lt.traversalsWithBlocksInProgress[link]--
-		if lt.traversalsWithBlocksInProgress[link] <= 0 {
-			delete(lt.traversalsWithBlocksInProgress, link)
-		}
+		lt.releaseBlock(link)
 	}
 	delete(lt.linksWithBlocksTraversedByRequest, requestID)
 
 	return
 }
+
+func (lt *LinkTracker) releaseBlock(link ipld.Link) {
+	lt.traversalsWithBlocksInProgress[link]--
+	if lt.traversalsWithBlocksInProgress[link] <= 0 {
+		delete(lt.traversalsWithBlocksInProgress, link)
+	}
+}
@@ -99,3 +99,34 @@ func TestMissingLink(t *testing.T) {
 		t.Fatal("Did not record which links are known missing correctly")
 	}
 }
+
+func TestVerifiedLink(t *testing.T) {
+	linkTracker := New()
+	link1 := testbridge.NewMockLink()
+	link2 := testbridge.NewMockLink()
+	requestID1 := gsmsg.GraphSyncRequestID(rand.Int31())
+	requestID2 := gsmsg.GraphSyncRequestID(rand.Int31())
+
+	linkTracker.RecordLinkTraversal(requestID1, link1, true)
+	linkTracker.RecordLinkTraversal(requestID1, link1, true)
+	linkTracker.RecordLinkTraversal(requestID1, link2, true)
+	linkTracker.RecordLinkTraversal(requestID2, link1, true)
+
+	linkTracker.RecordLinkVerification(requestID1, link1)
+	if !linkTracker.IsVerifiedLink(requestID1, link1) ||
+		linkTracker.IsVerifiedLink(requestID1, link2) ||
+		linkTracker.IsVerifiedLink(requestID2, link1) {
+		t.Fatal("Did not record which links are verified correctly")
+	}
+	if linkTracker.BlockRefCount(link1) != 1 || linkTracker.BlockRefCount(link2) != 1 {
+		t.Fatal("Verifying a link should release only the verifying request's references")
+	}
+
+	linkTracker.FinishRequest(requestID1)
+	if linkTracker.IsVerifiedLink(requestID1, link1) {
+		t.Fatal("Finishing request should forget verified links")
+	}
+	if linkTracker.BlockRefCount(link1) != 1 || linkTracker.BlockRefCount(link2) != 0 {
+		t.Fatal("Finishing request should not release verified links twice")
+	}
+}
@@ -1,8 +1,11 @@
 package message
 
 import (
+	"encoding/binary"
 	"fmt"
 	"io"
+	"sort"
+	"time"
 
 	"github.com/ipfs/go-block-format"
 
@@ -10,8 +13,16 @@ import (
 	cid "github.com/ipfs/go-cid"
 	pb "github.com/ipfs/go-graphsync/message/pb"
 	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
+// DefaultMaxMessageSize is the size in bytes at which outgoing messages are
+// split by default. It is well under inet.MessageSizeMax, the most a peer
+// reads, so that messages stay under it once encoded.
+const DefaultMaxMessageSize = 1 << 20
+
 // GraphSyncRequestID is a unique identifier for a GraphSync request.
 type GraphSyncRequestID int32
 
@@ -21,6 +32,43 @@ type GraphSyncPriority int32
 // GraphSyncResponseStatusCode is a status returned for a GraphSync Request.
 type GraphSyncResponseStatusCode int32
 
+// GraphSyncExtensionName is a name for a GraphSync extension
+type GraphSyncExtensionName string
+
+// GraphSyncExtension is a named piece of extension data carried on a
+// GraphSync request or response
+type GraphSyncExtension struct {
+	Name GraphSyncExtensionName
+	Data []byte
+}
+
+// ExtensionPause is a built-in extension a requester sends on a request update
+// to ask the responder to pause (data 1) or resume (data 0) its response
+const ExtensionPause = GraphSyncExtensionName("graphsync/pause")
+
+// ExtensionRetryAfter is a built-in extension a responder sends with
+// RequestFailedBusy to say how long the requester should wait before trying
+// again, as a varint number of milliseconds
+const ExtensionRetryAfter = GraphSyncExtensionName("graphsync/retry-after")
+
+// ExtensionAdditionalPeers is a built-in extension a responder sends to point
+// the requester at other peers that may be able to satisfy the request. Each
+// peer is encoded as its varint length prefixed ID, a varint count of
+// addresses, and each varint length prefixed address.
+const ExtensionAdditionalPeers = GraphSyncExtensionName("graphsync/additional-peers")
+
+// ExtensionBudgetExceeded is a built-in extension a responder sends with
+// RequestCompletedPartial when it stopped a response because the traversal
+// went over its budget. The data is the name of the limit that was hit.
+const ExtensionBudgetExceeded = GraphSyncExtensionName("graphsync/budget-exceeded")
+
+// RetryAfterExtension encodes the given backoff as ExtensionRetryAfter data
+func RetryAfterExtension(retryAfter time.Duration) GraphSyncExtension {
+	data := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(data, uint64(retryAfter/time.Millisecond))
+	return GraphSyncExtension{Name: ExtensionRetryAfter, Data: data[:n]}
+}
+
 const (
 
 	// GraphSync Response Status Codes
@@ -40,6 +88,9 @@ const (
 	// PartialResponse may include blocks and metadata about the in progress response
 	// in extra.
 	PartialResponse = GraphSyncResponseStatusCode(14)
+	// RequestPaused means the responder has paused sending data for the request,
+	// and will resume when the response is unpaused.
+	RequestPaused = GraphSyncResponseStatusCode(15)
 
 	// Success Response Codes (request terminated)
 
@@ -76,7 +127,8 @@ func IsTerminalSuccessCode(status GraphSyncResponseStatusCode) bool {
 // IsTerminalFailureCode returns true if the response code indicates the
 // request terminated in failure.
 func IsTerminalFailureCode(status GraphSyncResponseStatusCode) bool {
-	return status == RequestFailedBusy ||
+	return status == RequestRejected ||
+		status == RequestFailedBusy ||
 		status == RequestFailedContentNotFound ||
 		status == RequestFailedLegal ||
 		status == RequestFailedUnknown
@@ -91,6 +143,7 @@ func IsTerminalResponseCode(status GraphSyncResponseStatusCode) bool {
 // GraphSyncMessage is interface that can be serialized and deserialized to send
 // over the GraphSync network
 type GraphSyncMessage interface {
+	// Requests returns the requests in the message, highest priority first
 	Requests() []GraphSyncRequest
 
 	Responses() []GraphSyncResponse
@@ -119,18 +172,21 @@ type Exportable interface {
 // GraphSyncRequest is a struct to capture data on a request contained in a
 // GraphSyncMessage.
 type GraphSyncRequest struct {
-	selector []byte
-	priority GraphSyncPriority
-	id       GraphSyncRequestID
-	isCancel bool
+	selector   []byte
+	priority   GraphSyncPriority
+	id         GraphSyncRequestID
+	extensions map[string][]byte
+	isCancel   bool
+	isUpdate   bool
 }
 
 // GraphSyncResponse is an struct to capture data on a response sent back
 // in a GraphSyncMessage.
 type GraphSyncResponse struct {
-	requestID GraphSyncRequestID
-	status    GraphSyncResponseStatusCode
-	extra     []byte
+	requestID  GraphSyncRequestID
+	status     GraphSyncResponseStatusCode
+	extra      []byte
+	extensions map[string][]byte
 }
 
 type graphSyncMessage struct {
@@ -155,46 +211,77 @@ func newMsg() *graphSyncMessage {
 // NewRequest builds a new Graphsync request
 func NewRequest(id GraphSyncRequestID,
 	selector []byte,
-	priority GraphSyncPriority) GraphSyncRequest {
-	return newRequest(id, selector, priority, false)
+	priority GraphSyncPriority,
+	extensions ...GraphSyncExtension) GraphSyncRequest {
+	return newRequest(id, selector, priority, false, false, toExtensionsMap(extensions))
 }
 
 // CancelRequest request generates a request to cancel an in progress request
 func CancelRequest(id GraphSyncRequestID) GraphSyncRequest {
-	return newRequest(id, nil, 0, true)
+	return newRequest(id, nil, 0, true, false, nil)
+}
+
+// UpdateRequest generates a new request to update an in progress request
+// with the given extension data
+func UpdateRequest(id GraphSyncRequestID, extensions ...GraphSyncExtension) GraphSyncRequest {
+	return newRequest(id, nil, 0, false, true, toExtensionsMap(extensions))
+}
+
+func toExtensionsMap(extensions []GraphSyncExtension) map[string][]byte {
+	if len(extensions) == 0 {
+		return nil
+	}
+	extensionsMap := make(map[string][]byte, len(extensions))
+	for _, extension := range extensions {
+		extensionsMap[string(extension.Name)] = extension.Data
+	}
+	return extensionsMap
 }
 
 func newRequest(id GraphSyncRequestID,
 	selector []byte,
 	priority GraphSyncPriority,
-	isCancel bool) GraphSyncRequest {
+	isCancel bool,
+	isUpdate bool,
+	extensions map[string][]byte) GraphSyncRequest {
 	return GraphSyncRequest{
-		id:       id,
-		selector: selector,
-		priority: priority,
-		isCancel: isCancel,
+		id:         id,
+		selector:   selector,
+		priority:   priority,
+		isCancel:   isCancel,
+		isUpdate:   isUpdate,
+		extensions: extensions,
 	}
 }
 
 // NewResponse builds a new Graphsync response
 func NewResponse(requestID GraphSyncRequestID,
 	status GraphSyncResponseStatusCode,
-	extra []byte) GraphSyncResponse {
+	extra []byte,
+	extensions ...GraphSyncExtension) GraphSyncResponse {
+	return newResponse(requestID, status, extra, toExtensionsMap(extensions))
+}
+
+func newResponse(requestID GraphSyncRequestID,
+	status GraphSyncResponseStatusCode,
+	extra []byte,
+	extensions map[string][]byte) GraphSyncResponse {
 	return GraphSyncResponse{
-		requestID: requestID,
-		status:    status,
-		extra:     extra,
+		requestID:  requestID,
+		status:     status,
+		extra:      extra,
+		extensions: extensions,
 	}
 }
 
 func newMessageFromProto(pbm pb.Message) (GraphSyncMessage, error) {
 	gsm := newMsg()
 	for _, req := range pbm.Requests {
-		gsm.AddRequest(newRequest(GraphSyncRequestID(req.Id), req.Selector, GraphSyncPriority(req.Priority), req.Cancel))
+		gsm.AddRequest(newRequest(GraphSyncRequestID(req.Id), req.Selector, GraphSyncPriority(req.Priority), req.Cancel, req.Update, req.GetExtensions()))
 	}
 
 	for _, res := range pbm.Responses {
-		gsm.AddResponse(NewResponse(GraphSyncRequestID(res.Id), GraphSyncResponseStatusCode(res.Status), res.Extra))
+		gsm.AddResponse(newResponse(GraphSyncRequestID(res.Id), GraphSyncResponseStatusCode(res.Status), res.Extra, res.GetExtensions()))
 	}
 
 	for _, b := range pbm.GetData() {
@@ -228,6 +315,12 @@ func (gsm *graphSyncMessage) Requests() []GraphSyncRequest {
 	for _, request := range gsm.requests {
 		requests = append(requests, request)
 	}
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].priority != requests[j].priority {
+			return requests[i].priority > requests[j].priority
+		}
+		return requests[i].id < requests[j].id
+	})
 	return requests
 }
 
@@ -248,9 +341,26 @@ func (gsm *graphSyncMessage) Blocks() []blocks.Block {
 }
 
 func (gsm *graphSyncMessage) AddRequest(graphSyncRequest GraphSyncRequest) {
+	existingRequest, ok := gsm.requests[graphSyncRequest.id]
+	// an update should not replace a request that has not been sent yet
+	if ok && graphSyncRequest.isUpdate && !existingRequest.isCancel {
+		graphSyncRequest = existingRequest.mergeExtensions(graphSyncRequest)
+	}
 	gsm.requests[graphSyncRequest.id] = graphSyncRequest
 }
 
+func (gsr GraphSyncRequest) mergeExtensions(update GraphSyncRequest) GraphSyncRequest {
+	extensions := make(map[string][]byte, len(gsr.extensions)+len(update.extensions))
+	for name, data := range gsr.extensions {
+		extensions[name] = data
+	}
+	for name, data := range update.extensions {
+		extensions[name] = data
+	}
+	gsr.extensions = extensions
+	return gsr
+}
+
 func (gsm *graphSyncMessage) AddResponse(graphSyncResponse GraphSyncResponse) {
 	gsm.responses[graphSyncResponse.requestID] = graphSyncResponse
 }
@@ -278,21 +388,24 @@ func FromPBReader(pbr ggio.Reader) (GraphSyncMessage, error) {
 func (gsm *graphSyncMessage) ToProto() *pb.Message {
 	pbm := new(pb.Message)
 	pbm.Requests = make([]pb.Message_Request, 0, len(gsm.requests))
-	for _, request := range gsm.requests {
+	for _, request := range gsm.Requests() {
 		pbm.Requests = append(pbm.Requests, pb.Message_Request{
-			Id:       int32(request.id),
-			Selector: request.selector,
-			Priority: int32(request.priority),
-			Cancel:   request.isCancel,
+			Id:         int32(request.id),
+			Selector:   request.selector,
+			Priority:   int32(request.priority),
+			Cancel:     request.isCancel,
+			Update:     request.isUpdate,
+			Extensions: request.extensions,
 		})
 	}
 
 	pbm.Responses = make([]pb.Message_Response, 0, len(gsm.responses))
 	for _, response := range gsm.responses {
 		pbm.Responses = append(pbm.Responses, pb.Message_Response{
-			Id:     int32(response.requestID),
-			Status: int32(response.status),
-			Extra:  response.extra,
+			Id:         int32(response.requestID),
+			Status:     int32(response.status),
+			Extra:      response.extra,
+			Extensions: response.extensions,
 		})
 	}
 
@@ -340,6 +453,21 @@ func (gsr GraphSyncRequest) Priority() GraphSyncPriority { return gsr.priority }
 // IsCancel returns true if this particular request is being cancelled
 func (gsr GraphSyncRequest) IsCancel() bool { return gsr.isCancel }
 
+// IsUpdate returns true if this particular request is an update to an in
+// progress request
+func (gsr GraphSyncRequest) IsUpdate() bool { return gsr.isUpdate }
+
+// Extension returns the data for the named extension on this request, and
+// whether the extension was present
+func (gsr GraphSyncRequest) Extension(name GraphSyncExtensionName) ([]byte, bool) {
+	return extension(gsr.extensions, name)
+}
+
+// Extensions returns all extension data on this request
+func (gsr GraphSyncRequest) Extensions() []GraphSyncExtension {
+	return extensionsList(gsr.extensions)
+}
+
 // RequestID returns the request ID for this response
 func (gsr GraphSyncResponse) RequestID() GraphSyncRequestID { return gsr.requestID }
 
@@ -348,3 +476,130 @@ func (gsr GraphSyncResponse) Status() GraphSyncResponseStatusCode { return gsr.s
 
 // Extra returns any metadata on a response
 func (gsr GraphSyncResponse) Extra() []byte { return gsr.extra }
+
+// Extension returns the data for the named extension on this response, and
+// whether the extension was present
+func (gsr GraphSyncResponse) Extension(name GraphSyncExtensionName) ([]byte, bool) {
+	return extension(gsr.extensions, name)
+}
+
+// Extensions returns all extension data on this response
+func (gsr GraphSyncResponse) Extensions() []GraphSyncExtension {
+	return extensionsList(gsr.extensions)
+}
+
+// RetryAfter returns the backoff the responder sent with ExtensionRetryAfter,
+// and whether it sent one
+func (gsr GraphSyncResponse) RetryAfter() (time.Duration, bool) {
+	data, ok := gsr.Extension(ExtensionRetryAfter)
+	if !ok {
+		return 0, false
+	}
+	millis, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, false
+	}
+	return time.Duration(millis) * time.Millisecond, true
+}
+
+// AdditionalPeersExtension encodes the given peers as ExtensionAdditionalPeers
+// data
+func AdditionalPeersExtension(peers []pstore.PeerInfo) GraphSyncExtension {
+	var data []byte
+	for _, pi := range peers {
+		data = appendLengthPrefixed(data, []byte(pi.ID))
+		data = appendUvarint(data, uint64(len(pi.Addrs)))
+		for _, addr := range pi.Addrs {
+			data = appendLengthPrefixed(data, addr.Bytes())
+		}
+	}
+	return GraphSyncExtension{Name: ExtensionAdditionalPeers, Data: data}
+}
+
+// AdditionalPeers returns the peers the responder sent with
+// ExtensionAdditionalPeers, and whether it sent any that could be decoded
+func (gsr GraphSyncResponse) AdditionalPeers() ([]pstore.PeerInfo, bool) {
+	data, ok := gsr.Extension(ExtensionAdditionalPeers)
+	if !ok {
+		return nil, false
+	}
+	var peers []pstore.PeerInfo
+	for len(data) > 0 {
+		var idBytes []byte
+		idBytes, data, ok = readLengthPrefixed(data)
+		if !ok {
+			return nil, false
+		}
+		addrCount, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, false
+		}
+		data = data[n:]
+		pi := pstore.PeerInfo{ID: peer.ID(idBytes)}
+		for i := uint64(0); i < addrCount; i++ {
+			var addrBytes []byte
+			addrBytes, data, ok = readLengthPrefixed(data)
+			if !ok {
+				return nil, false
+			}
+			addr, err := ma.NewMultiaddrBytes(addrBytes)
+			if err != nil {
+				return nil, false
+			}
+			pi.Addrs = append(pi.Addrs, addr)
+		}
+		peers = append(peers, pi)
+	}
+	return peers, len(peers) > 0
+}
+
+// BudgetExceededExtension encodes the name of the traversal limit that was hit
+// as ExtensionBudgetExceeded data
+func BudgetExceededExtension(limit string) GraphSyncExtension {
+	return GraphSyncExtension{Name: ExtensionBudgetExceeded, Data: []byte(limit)}
+}
+
+// BudgetExceeded returns the name of the traversal limit the responder sent
+// with ExtensionBudgetExceeded, and whether it sent one
+func (gsr GraphSyncResponse) BudgetExceeded() (string, bool) {
+	data, ok := gsr.Extension(ExtensionBudgetExceeded)
+	if !ok {
+		return "", false
+	}
+	return string(data), true
+}
+
+func appendUvarint(data []byte, x uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, x)
+	return append(data, buf[:n]...)
+}
+
+func appendLengthPrefixed(data []byte, b []byte) []byte {
+	return append(appendUvarint(data, uint64(len(b))), b...)
+}
+
+func readLengthPrefixed(data []byte) ([]byte, []byte, bool) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return nil, nil, false
+	}
+	data = data[n:]
+	return data[:length], data[length:], true
+}
+
+func extension(extensions map[string][]byte, name GraphSyncExtensionName) ([]byte, bool) {
+	if extensions == nil {
+		return nil, false
+	}
+	data, ok := extensions[string(name)]
+	return data, ok
+}
+
+func extensionsList(extensions map[string][]byte) []GraphSyncExtension {
+	extensionsList := make([]GraphSyncExtension, 0, len(extensions))
+	for name, data := range extensions {
+		extensionsList = append(extensionsList, GraphSyncExtension{GraphSyncExtensionName(name), data})
+	}
+	return extensionsList
+}
@@ -5,29 +5,40 @@ import (
 	"math/rand"
 	"reflect"
 	"testing"
+	"time"
 
 	blocks "github.com/ipfs/go-block-format"
 
 	cid "github.com/ipfs/go-cid"
 	"github.com/ipfs/go-graphsync/testutil"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 func TestAppendingRequests(t *testing.T) {
 	selector := testutil.RandomBytes(100)
 	id := GraphSyncRequestID(rand.Int31())
 	priority := GraphSyncPriority(rand.Int31())
+	extensionName := GraphSyncExtensionName("graphsync/awesome")
+	extension := GraphSyncExtension{
+		Name: extensionName,
+		Data: testutil.RandomBytes(100),
+	}
 
 	gsm := New()
-	gsm.AddRequest(NewRequest(id, selector, priority))
+	gsm.AddRequest(NewRequest(id, selector, priority, extension))
 	requests := gsm.Requests()
 	if len(requests) != 1 {
 		t.Fatal("Did not add request to message")
 	}
 	request := requests[0]
+	extensionData, found := request.Extension(extensionName)
 	if request.ID() != id ||
 		request.IsCancel() != false ||
 		request.Priority() != priority ||
-		!reflect.DeepEqual(request.Selector(), selector) {
+		!reflect.DeepEqual(request.Selector(), selector) ||
+		!found ||
+		!reflect.DeepEqual(extensionData, extension.Data) {
 		t.Fatal("Did not properly add request to message")
 	}
 
@@ -36,7 +47,8 @@ func TestAppendingRequests(t *testing.T) {
 	if pbRequest.Id != int32(id) ||
 		pbRequest.Priority != int32(priority) ||
 		pbRequest.Cancel != false ||
-		!reflect.DeepEqual(pbRequest.Selector, selector) {
+		!reflect.DeepEqual(pbRequest.Selector, selector) ||
+		!reflect.DeepEqual(pbRequest.Extensions, map[string][]byte{"graphsync/awesome": extension.Data}) {
 		t.Fatal("Did not properly serialize message to protobuf")
 	}
 
@@ -49,10 +61,13 @@ func TestAppendingRequests(t *testing.T) {
 		t.Fatal("Did not add request to deserialized message")
 	}
 	deserializedRequest := deserializedRequests[0]
+	extensionData, found = deserializedRequest.Extension(extensionName)
 	if deserializedRequest.ID() != id ||
 		deserializedRequest.IsCancel() != false ||
 		deserializedRequest.Priority() != priority ||
-		!reflect.DeepEqual(deserializedRequest.Selector(), selector) {
+		!reflect.DeepEqual(deserializedRequest.Selector(), selector) ||
+		!found ||
+		!reflect.DeepEqual(extensionData, extension.Data) {
 		t.Fatal("Did not properly deserialize protobuf messages so requests are equal")
 	}
 }
@@ -61,17 +76,25 @@ func TestAppendingResponses(t *testing.T) {
 	extra := testutil.RandomBytes(100)
 	requestID := GraphSyncRequestID(rand.Int31())
 	status := RequestAcknowledged
+	extensionName := GraphSyncExtensionName("graphsync/awesome")
+	extension := GraphSyncExtension{
+		Name: extensionName,
+		Data: testutil.RandomBytes(100),
+	}
 
 	gsm := New()
-	gsm.AddResponse(NewResponse(requestID, status, extra))
+	gsm.AddResponse(NewResponse(requestID, status, extra, extension))
 	responses := gsm.Responses()
 	if len(responses) != 1 {
 		t.Fatal("Did not add response to message")
 	}
 	response := responses[0]
+	extensionData, found := response.Extension(extensionName)
 	if response.RequestID() != requestID ||
 		response.Status() != status ||
-		!reflect.DeepEqual(response.Extra(), extra) {
+		!reflect.DeepEqual(response.Extra(), extra) ||
+		!found ||
+		!reflect.DeepEqual(extensionData, extension.Data) {
 		t.Fatal("Did not properly add response to message")
 	}
 
@@ -79,7 +102,8 @@ func TestAppendingResponses(t *testing.T) {
 	pbResponse := pbMessage.Responses[0]
 	if pbResponse.Id != int32(requestID) ||
 		pbResponse.Status != int32(status) ||
-		!reflect.DeepEqual(pbResponse.Extra, extra) {
+		!reflect.DeepEqual(pbResponse.Extra, extra) ||
+		!reflect.DeepEqual(pbResponse.Extensions, map[string][]byte{"graphsync/awesome": extension.Data}) {
 		t.Fatal("Did not properly serialize message to protobuf")
 	}
 
@@ -92,9 +116,12 @@ func TestAppendingResponses(t *testing.T) {
 		t.Fatal("Did not add response to message")
 	}
 	deserializedResponse := deserializedResponses[0]
+	extensionData, found = deserializedResponse.Extension(extensionName)
 	if deserializedResponse.RequestID() != requestID ||
 		deserializedResponse.Status() != status ||
-		!reflect.DeepEqual(deserializedResponse.Extra(), extra) {
+		!reflect.DeepEqual(deserializedResponse.Extra(), extra) ||
+		!found ||
+		!reflect.DeepEqual(extensionData, extension.Data) {
 		t.Fatal("Did not properly deserialize protobuf messages so responses are equal")
 	}
 }
@@ -150,16 +177,181 @@ func TestRequestCancel(t *testing.T) {
 	}
 }
 
+func TestRequestUpdate(t *testing.T) {
+	selector := testutil.RandomBytes(100)
+	id := GraphSyncRequestID(rand.Int31())
+	priority := GraphSyncPriority(rand.Int31())
+	extension1 := GraphSyncExtension{
+		Name: GraphSyncExtensionName("graphsync/awesome"),
+		Data: testutil.RandomBytes(100),
+	}
+	extension2 := GraphSyncExtension{
+		Name: GraphSyncExtensionName("graphsync/even-more-awesome"),
+		Data: testutil.RandomBytes(100),
+	}
+
+	gsm := New()
+	gsm.AddRequest(UpdateRequest(id, extension1))
+
+	requests := gsm.Requests()
+	if len(requests) != 1 {
+		t.Fatal("Did not add update request to message")
+	}
+	request := requests[0]
+	extensionData, found := request.Extension(extension1.Name)
+	if request.ID() != id ||
+		request.IsUpdate() != true ||
+		request.IsCancel() != false ||
+		!found ||
+		!reflect.DeepEqual(extensionData, extension1.Data) {
+		t.Fatal("Did not properly add update request to message")
+	}
+
+	pbMessage := gsm.ToProto()
+	deserialized, err := newMessageFromProto(*pbMessage)
+	if err != nil {
+		t.Fatal("Error deserializing protobuf message")
+	}
+	deserializedRequest := deserialized.Requests()[0]
+	if deserializedRequest.ID() != id ||
+		deserializedRequest.IsUpdate() != true ||
+		!reflect.DeepEqual(deserializedRequest.Extensions(), request.Extensions()) {
+		t.Fatal("Did not properly deserialize update request")
+	}
+
+	// an update merges into a request that has not been sent
+	gsm = New()
+	gsm.AddRequest(NewRequest(id, selector, priority, extension1))
+	gsm.AddRequest(UpdateRequest(id, extension2))
+
+	requests = gsm.Requests()
+	if len(requests) != 1 {
+		t.Fatal("Did not merge update request")
+	}
+	request = requests[0]
+	extensionData1, found1 := request.Extension(extension1.Name)
+	extensionData2, found2 := request.Extension(extension2.Name)
+	if request.IsUpdate() != false ||
+		!reflect.DeepEqual(request.Selector(), selector) ||
+		!found1 || !reflect.DeepEqual(extensionData1, extension1.Data) ||
+		!found2 || !reflect.DeepEqual(extensionData2, extension2.Data) {
+		t.Fatal("Did not properly merge update into request")
+	}
+}
+
+func TestRequestsOrderedByPriority(t *testing.T) {
+	gsm := New()
+	gsm.AddRequest(NewRequest(GraphSyncRequestID(1), testutil.RandomBytes(100), GraphSyncPriority(5)))
+	gsm.AddRequest(NewRequest(GraphSyncRequestID(2), testutil.RandomBytes(100), GraphSyncPriority(20)))
+	gsm.AddRequest(NewRequest(GraphSyncRequestID(3), testutil.RandomBytes(100), GraphSyncPriority(10)))
+
+	expectedOrder := []GraphSyncRequestID{2, 3, 1}
+	requests := gsm.Requests()
+	pbMessage := gsm.ToProto()
+	if len(requests) != len(expectedOrder) || len(pbMessage.Requests) != len(expectedOrder) {
+		t.Fatal("Did not add requests to message")
+	}
+	for i, id := range expectedOrder {
+		if requests[i].ID() != id {
+			t.Fatal("Did not order requests by priority")
+		}
+		if pbMessage.Requests[i].Id != int32(id) {
+			t.Fatal("Did not serialize requests in priority order")
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	id := GraphSyncRequestID(rand.Int31())
+	retryAfter := 1500 * time.Millisecond
+
+	gsm := New()
+	gsm.AddResponse(NewResponse(id, RequestFailedBusy, nil, RetryAfterExtension(retryAfter)))
+	gsm.AddResponse(NewResponse(id+1, RequestFailedBusy, nil))
+
+	pbMessage := gsm.ToProto()
+	deserialized, err := newMessageFromProto(*pbMessage)
+	if err != nil {
+		t.Fatal("Error deserializing protobuf message")
+	}
+	for _, response := range deserialized.Responses() {
+		decoded, found := response.RetryAfter()
+		if response.RequestID() == id && (!found || decoded != retryAfter) {
+			t.Fatal("Did not decode retry after hint")
+		}
+		if response.RequestID() != id && found {
+			t.Fatal("Decoded retry after hint that was not sent")
+		}
+	}
+}
+
+func TestAdditionalPeers(t *testing.T) {
+	id := GraphSyncRequestID(rand.Int31())
+	peers := testutil.GeneratePeers(2)
+	addr, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/4001")
+	if err != nil {
+		t.Fatal("error creating multiaddr")
+	}
+	additionalPeers := []pstore.PeerInfo{
+		{ID: peers[0], Addrs: []ma.Multiaddr{addr}},
+		{ID: peers[1]},
+	}
+
+	gsm := New()
+	gsm.AddResponse(NewResponse(id, AdditionalPeers, nil, AdditionalPeersExtension(additionalPeers)))
+
+	pbMessage := gsm.ToProto()
+	deserialized, err := newMessageFromProto(*pbMessage)
+	if err != nil {
+		t.Fatal("Error deserializing protobuf message")
+	}
+	decoded, found := deserialized.Responses()[0].AdditionalPeers()
+	if !found || len(decoded) != len(additionalPeers) {
+		t.Fatal("Did not decode additional peers")
+	}
+	if decoded[0].ID != peers[0] || len(decoded[0].Addrs) != 1 || !decoded[0].Addrs[0].Equal(addr) ||
+		decoded[1].ID != peers[1] || len(decoded[1].Addrs) != 0 {
+		t.Fatal("Decoded incorrect additional peers")
+	}
+}
+
+func TestBudgetExceeded(t *testing.T) {
+	id := GraphSyncRequestID(rand.Int31())
+
+	gsm := New()
+	gsm.AddResponse(NewResponse(id, RequestCompletedPartial, nil, BudgetExceededExtension("blocks")))
+	gsm.AddResponse(NewResponse(id+1, RequestCompletedPartial, nil))
+
+	pbMessage := gsm.ToProto()
+	deserialized, err := newMessageFromProto(*pbMessage)
+	if err != nil {
+		t.Fatal("Error deserializing protobuf message")
+	}
+	for _, response := range deserialized.Responses() {
+		limit, found := response.BudgetExceeded()
+		if response.RequestID() == id && (!found || limit != "blocks") {
+			t.Fatal("Did not decode exceeded budget limit")
+		}
+		if response.RequestID() != id && found {
+			t.Fatal("Decoded exceeded budget limit that was not sent")
+		}
+	}
+}
+
 func TestToNetFromNetEquivalency(t *testing.T) {
 	selector := testutil.RandomBytes(100)
 	extra := testutil.RandomBytes(100)
 	id := GraphSyncRequestID(rand.Int31())
 	priority := GraphSyncPriority(rand.Int31())
 	status := RequestAcknowledged
+	extension := GraphSyncExtension{
+		Name: GraphSyncExtensionName("graphsync/awesome"),
+		Data: testutil.RandomBytes(100),
+	}
 
 	gsm := New()
-	gsm.AddRequest(NewRequest(id, selector, priority))
-	gsm.AddResponse(NewResponse(id, status, extra))
+	gsm.AddRequest(NewRequest(id, selector, priority, extension))
+	gsm.AddResponse(NewResponse(id, status, extra, extension))
 
 	gsm.AddBlock(blocks.NewBlock([]byte("W")))
 	gsm.AddBlock(blocks.NewBlock([]byte("E")))
@@ -189,7 +381,8 @@ func TestToNetFromNetEquivalency(t *testing.T) {
 	if deserializedRequest.ID() != request.ID() ||
 		deserializedRequest.IsCancel() != request.IsCancel() ||
 		deserializedRequest.Priority() != request.Priority() ||
-		!reflect.DeepEqual(deserializedRequest.Selector(), request.Selector()) {
+		!reflect.DeepEqual(deserializedRequest.Selector(), request.Selector()) ||
+		!reflect.DeepEqual(deserializedRequest.Extensions(), request.Extensions()) {
 		t.Fatal("Did not keep requests when writing to stream and back")
 	}
 
@@ -205,7 +398,8 @@ func TestToNetFromNetEquivalency(t *testing.T) {
 	deserializedResponse := deserializedResponses[0]
 	if deserializedResponse.RequestID() != response.RequestID() ||
 		deserializedResponse.Status() != response.Status() ||
-		!reflect.DeepEqual(deserializedResponse.Extra(), response.Extra()) {
+		!reflect.DeepEqual(deserializedResponse.Extra(), response.Extra()) ||
+		!reflect.DeepEqual(deserializedResponse.Extensions(), response.Extensions()) {
 		t.Fatal("Did not keep responses when writing to stream and back")
 	}
 
@@ -91,11 +91,13 @@ func (m *Message) GetData() []Message_Block {
 }
 
 type Message_Request struct {
-	Id       int32  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
-	Selector []byte `protobuf:"bytes,2,opt,name=selector,proto3" json:"selector,omitempty"`
-	Extra    []byte `protobuf:"bytes,3,opt,name=extra,proto3" json:"extra,omitempty"`
-	Priority int32  `protobuf:"varint,4,opt,name=priority,proto3" json:"priority,omitempty"`
-	Cancel   bool   `protobuf:"varint,5,opt,name=cancel,proto3" json:"cancel,omitempty"`
+	Id         int32             `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Selector   []byte            `protobuf:"bytes,2,opt,name=selector,proto3" json:"selector,omitempty"`
+	Extra      []byte            `protobuf:"bytes,3,opt,name=extra,proto3" json:"extra,omitempty"`
+	Priority   int32             `protobuf:"varint,4,opt,name=priority,proto3" json:"priority,omitempty"`
+	Cancel     bool              `protobuf:"varint,5,opt,name=cancel,proto3" json:"cancel,omitempty"`
+	Extensions map[string][]byte `protobuf:"bytes,6,rep,name=extensions" json:"extensions,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Update     bool              `protobuf:"varint,7,opt,name=update,proto3" json:"update,omitempty"`
 }
 
 func (m *Message_Request) Reset()         { *m = Message_Request{} }
@@ -166,10 +168,25 @@ func (m *Message_Request) GetCancel() bool {
 	return false
 }
 
+func (m *Message_Request) GetExtensions() map[string][]byte {
+	if m != nil {
+		return m.Extensions
+	}
+	return nil
+}
+
+func (m *Message_Request) GetUpdate() bool {
+	if m != nil {
+		return m.Update
+	}
+	return false
+}
+
 type Message_Response struct {
-	Id     int32  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
-	Status int32  `protobuf:"varint,2,opt,name=status,proto3" json:"status,omitempty"`
-	Extra  []byte `protobuf:"bytes,3,opt,name=extra,proto3" json:"extra,omitempty"`
+	Id         int32             `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Status     int32             `protobuf:"varint,2,opt,name=status,proto3" json:"status,omitempty"`
+	Extra      []byte            `protobuf:"bytes,3,opt,name=extra,proto3" json:"extra,omitempty"`
+	Extensions map[string][]byte `protobuf:"bytes,4,rep,name=extensions" json:"extensions,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 }
 
 func (m *Message_Response) Reset()         { *m = Message_Response{} }
@@ -226,6 +243,13 @@ func (m *Message_Response) GetExtra() []byte {
 	return nil
 }
 
+func (m *Message_Response) GetExtensions() map[string][]byte {
+	if m != nil {
+		return m.Extensions
+	}
+	return nil
+}
+
 type Message_Block struct {
 	Prefix []byte `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
 	Data   []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
@@ -281,7 +305,9 @@ func (m *Message_Block) GetData() []byte {
 func init() {
 	proto.RegisterType((*Message)(nil), "graphsync.message.pb.Message")
 	proto.RegisterType((*Message_Request)(nil), "graphsync.message.pb.Message.Request")
+	proto.RegisterMapType((map[string][]byte)(nil), "graphsync.message.pb.Message.Request.ExtensionsEntry")
 	proto.RegisterType((*Message_Response)(nil), "graphsync.message.pb.Message.Response")
+	proto.RegisterMapType((map[string][]byte)(nil), "graphsync.message.pb.Message.Response.ExtensionsEntry")
 	proto.RegisterType((*Message_Block)(nil), "graphsync.message.pb.Message.Block")
 }
 func (m *Message) Marshal() (dAtA []byte, err error) {
@@ -395,6 +421,39 @@ func (m *Message_Request) MarshalTo(dAtA []byte) (int, error) {
 		}
 		i++
 	}
+	if len(m.Extensions) > 0 {
+		for k, _ := range m.Extensions {
+			dAtA[i] = 0x32
+			i++
+			v := m.Extensions[k]
+			byteSize := 0
+			if len(v) > 0 {
+				byteSize = 1 + len(v) + sovMessage(uint64(len(v)))
+			}
+			mapSize := 1 + len(k) + sovMessage(uint64(len(k))) + byteSize
+			i = encodeVarintMessage(dAtA, i, uint64(mapSize))
+			dAtA[i] = 0xa
+			i++
+			i = encodeVarintMessage(dAtA, i, uint64(len(k)))
+			i += copy(dAtA[i:], k)
+			if len(v) > 0 {
+				dAtA[i] = 0x12
+				i++
+				i = encodeVarintMessage(dAtA, i, uint64(len(v)))
+				i += copy(dAtA[i:], v)
+			}
+		}
+	}
+	if m.Update {
+		dAtA[i] = 0x38
+		i++
+		if m.Update {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i++
+	}
 	return i, nil
 }
 
@@ -429,6 +488,29 @@ func (m *Message_Response) MarshalTo(dAtA []byte) (int, error) {
 		i = encodeVarintMessage(dAtA, i, uint64(len(m.Extra)))
 		i += copy(dAtA[i:], m.Extra)
 	}
+	if len(m.Extensions) > 0 {
+		for k, _ := range m.Extensions {
+			dAtA[i] = 0x22
+			i++
+			v := m.Extensions[k]
+			byteSize := 0
+			if len(v) > 0 {
+				byteSize = 1 + len(v) + sovMessage(uint64(len(v)))
+			}
+			mapSize := 1 + len(k) + sovMessage(uint64(len(k))) + byteSize
+			i = encodeVarintMessage(dAtA, i, uint64(mapSize))
+			dAtA[i] = 0xa
+			i++
+			i = encodeVarintMessage(dAtA, i, uint64(len(k)))
+			i += copy(dAtA[i:], k)
+			if len(v) > 0 {
+				dAtA[i] = 0x12
+				i++
+				i = encodeVarintMessage(dAtA, i, uint64(len(v)))
+				i += copy(dAtA[i:], v)
+			}
+		}
+	}
 	return i, nil
 }
 
@@ -524,6 +606,21 @@ func (m *Message_Request) Size() (n int) {
 	if m.Cancel {
 		n += 2
 	}
+	if len(m.Extensions) > 0 {
+		for k, v := range m.Extensions {
+			_ = k
+			_ = v
+			l = 0
+			if len(v) > 0 {
+				l = 1 + len(v) + sovMessage(uint64(len(v)))
+			}
+			mapEntrySize := 1 + len(k) + sovMessage(uint64(len(k))) + l
+			n += mapEntrySize + 1 + sovMessage(uint64(mapEntrySize))
+		}
+	}
+	if m.Update {
+		n += 2
+	}
 	return n
 }
 
@@ -543,6 +640,18 @@ func (m *Message_Response) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovMessage(uint64(l))
 	}
+	if len(m.Extensions) > 0 {
+		for k, v := range m.Extensions {
+			_ = k
+			_ = v
+			l = 0
+			if len(v) > 0 {
+				l = 1 + len(v) + sovMessage(uint64(len(v)))
+			}
+			mapEntrySize := 1 + len(k) + sovMessage(uint64(len(k))) + l
+			n += mapEntrySize + 1 + sovMessage(uint64(mapEntrySize))
+		}
+	}
 	return n
 }
 
@@ -888,6 +997,145 @@ func (m *Message_Request) Unmarshal(dAtA []byte) error {
 				}
 			}
 			m.Cancel = bool(v != 0)
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Extensions", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthMessage
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Extensions == nil {
+				m.Extensions = make(map[string][]byte)
+			}
+			var mapkey string
+			mapvalue := []byte{}
+			for iNdEx < postIndex {
+				entryPreIndex := iNdEx
+				var wire uint64
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowMessage
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					wire |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				fieldNum := int32(wire >> 3)
+				if fieldNum == 1 {
+					var stringLenmapkey uint64
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowMessage
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						stringLenmapkey |= (uint64(b) & 0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					intStringLenmapkey := int(stringLenmapkey)
+					if intStringLenmapkey < 0 {
+						return ErrInvalidLengthMessage
+					}
+					postStringIndexmapkey := iNdEx + intStringLenmapkey
+					if postStringIndexmapkey > l {
+						return io.ErrUnexpectedEOF
+					}
+					mapkey = string(dAtA[iNdEx:postStringIndexmapkey])
+					iNdEx = postStringIndexmapkey
+				} else if fieldNum == 2 {
+					var mapbyteLen uint64
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowMessage
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						mapbyteLen |= (uint64(b) & 0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					intMapbyteLen := int(mapbyteLen)
+					if intMapbyteLen < 0 {
+						return ErrInvalidLengthMessage
+					}
+					postbytesIndex := iNdEx + intMapbyteLen
+					if postbytesIndex > l {
+						return io.ErrUnexpectedEOF
+					}
+					mapvalue = make([]byte, mapbyteLen)
+					copy(mapvalue, dAtA[iNdEx:postbytesIndex])
+					iNdEx = postbytesIndex
+				} else {
+					iNdEx = entryPreIndex
+					skippy, err := skipMessage(dAtA[iNdEx:])
+					if err != nil {
+						return err
+					}
+					if skippy < 0 {
+						return ErrInvalidLengthMessage
+					}
+					if (iNdEx + skippy) > postIndex {
+						return io.ErrUnexpectedEOF
+					}
+					iNdEx += skippy
+				}
+			}
+			m.Extensions[mapkey] = mapvalue
+			iNdEx = postIndex
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Update", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Update = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipMessage(dAtA[iNdEx:])
@@ -1007,6 +1255,125 @@ func (m *Message_Response) Unmarshal(dAtA []byte) error {
 				m.Extra = []byte{}
 			}
 			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Extensions", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthMessage
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Extensions == nil {
+				m.Extensions = make(map[string][]byte)
+			}
+			var mapkey string
+			mapvalue := []byte{}
+			for iNdEx < postIndex {
+				entryPreIndex := iNdEx
+				var wire uint64
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowMessage
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					wire |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				fieldNum := int32(wire >> 3)
+				if fieldNum == 1 {
+					var stringLenmapkey uint64
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowMessage
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						stringLenmapkey |= (uint64(b) & 0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					intStringLenmapkey := int(stringLenmapkey)
+					if intStringLenmapkey < 0 {
+						return ErrInvalidLengthMessage
+					}
+					postStringIndexmapkey := iNdEx + intStringLenmapkey
+					if postStringIndexmapkey > l {
+						return io.ErrUnexpectedEOF
+					}
+					mapkey = string(dAtA[iNdEx:postStringIndexmapkey])
+					iNdEx = postStringIndexmapkey
+				} else if fieldNum == 2 {
+					var mapbyteLen uint64
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowMessage
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						mapbyteLen |= (uint64(b) & 0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					intMapbyteLen := int(mapbyteLen)
+					if intMapbyteLen < 0 {
+						return ErrInvalidLengthMessage
+					}
+					postbytesIndex := iNdEx + intMapbyteLen
+					if postbytesIndex > l {
+						return io.ErrUnexpectedEOF
+					}
+					mapvalue = make([]byte, mapbyteLen)
+					copy(mapvalue, dAtA[iNdEx:postbytesIndex])
+					iNdEx = postbytesIndex
+				} else {
+					iNdEx = entryPreIndex
+					skippy, err := skipMessage(dAtA[iNdEx:])
+					if err != nil {
+						return err
+					}
+					if skippy < 0 {
+						return ErrInvalidLengthMessage
+					}
+					if (iNdEx + skippy) > postIndex {
+						return io.ErrUnexpectedEOF
+					}
+					iNdEx += skippy
+				}
+			}
+			m.Extensions[mapkey] = mapvalue
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipMessage(dAtA[iNdEx:])
@@ -1248,28 +1615,34 @@ var (
 func init() { proto.RegisterFile("message.proto", fileDescriptor_message_cc444caec1a63741) }
 
 var fileDescriptor_message_cc444caec1a63741 = []byte{
-	// 364 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x92, 0xb1, 0x4e, 0xf3, 0x30,
-	0x10, 0xc7, 0x93, 0x34, 0x69, 0xf3, 0xdd, 0x57, 0x18, 0x4c, 0x55, 0x59, 0x19, 0x42, 0x05, 0x02,
-	0x75, 0x21, 0x45, 0x74, 0x66, 0xe9, 0x02, 0x42, 0xb0, 0xe4, 0x0d, 0x92, 0xd4, 0x4d, 0x23, 0xd2,
-	0x3a, 0xd8, 0x8e, 0xd4, 0x4e, 0x3c, 0x02, 0x3c, 0x56, 0xc7, 0x8e, 0x4c, 0x08, 0xb5, 0x2f, 0x82,
-	0x7a, 0x31, 0x61, 0xa0, 0x82, 0xcd, 0x3f, 0x9d, 0xff, 0xbf, 0xbb, 0xb3, 0x0c, 0x07, 0x33, 0x26,
-	0x65, 0x94, 0xb2, 0xa0, 0x10, 0x5c, 0x71, 0xd2, 0x49, 0x45, 0x54, 0x4c, 0xe5, 0x72, 0x9e, 0x04,
-	0x75, 0x21, 0xf6, 0x2e, 0xd2, 0x4c, 0x4d, 0xcb, 0x38, 0x48, 0xf8, 0x6c, 0x90, 0xf2, 0x94, 0x0f,
-	0xf0, 0x72, 0x5c, 0x4e, 0x90, 0x10, 0xf0, 0x54, 0x49, 0x4e, 0x5e, 0x6c, 0x68, 0x3d, 0x54, 0x69,
-	0x72, 0x09, 0x47, 0x09, 0x9f, 0x15, 0x39, 0x53, 0x2c, 0x64, 0x4f, 0x25, 0x93, 0xea, 0x3e, 0x93,
-	0x8a, 0x9a, 0x3d, 0xb3, 0xef, 0x86, 0xfb, 0x4a, 0xe4, 0x06, 0x5c, 0x51, 0xa1, 0xa4, 0x56, 0xaf,
-	0xd1, 0xff, 0x7f, 0x75, 0x16, 0xec, 0x9b, 0x2a, 0xd0, 0x2d, 0x02, 0x1d, 0x1e, 0xd9, 0xab, 0xf7,
-	0x63, 0x23, 0xac, 0xc3, 0xe4, 0x0e, 0xfe, 0x09, 0x26, 0x0b, 0x3e, 0x97, 0x4c, 0xd2, 0x06, 0x9a,
-	0xce, 0xff, 0x32, 0x55, 0xd7, 0xb5, 0xea, 0x3b, 0x4e, 0xae, 0xc1, 0x1e, 0x47, 0x2a, 0xa2, 0x36,
-	0x6a, 0x4e, 0x7f, 0xd7, 0x8c, 0x72, 0x9e, 0x3c, 0x6a, 0x07, 0xc6, 0xbc, 0x67, 0x68, 0xe9, 0x29,
-	0xc9, 0x21, 0x58, 0xd9, 0x18, 0xf7, 0x77, 0x42, 0x2b, 0x1b, 0x13, 0x0f, 0x5c, 0xc9, 0x72, 0x96,
-	0x28, 0x2e, 0xa8, 0xd5, 0x33, 0xfb, 0xed, 0xb0, 0x66, 0xd2, 0x01, 0x87, 0x2d, 0x94, 0x88, 0x68,
-	0x03, 0x0b, 0x15, 0xec, 0x12, 0x85, 0xc8, 0xb8, 0xc8, 0xd4, 0x92, 0xda, 0xe8, 0xa9, 0x99, 0x74,
-	0xa1, 0x99, 0x44, 0xf3, 0x84, 0xe5, 0xd4, 0xc1, 0x17, 0xd6, 0xe4, 0xdd, 0x82, 0xfb, 0xb5, 0xdc,
-	0x8f, 0x09, 0xba, 0xd0, 0x94, 0x2a, 0x52, 0xa5, 0xc4, 0xfe, 0x4e, 0xa8, 0x69, 0x7f, 0x77, 0x6f,
-	0x08, 0x0e, 0xee, 0xb7, 0x8b, 0x15, 0x82, 0x4d, 0xb2, 0x05, 0xaa, 0xda, 0xa1, 0x26, 0x42, 0xf4,
-	0x53, 0x55, 0xcb, 0xe0, 0x79, 0x44, 0x57, 0x1b, 0xdf, 0x5c, 0x6f, 0x7c, 0xf3, 0x63, 0xe3, 0x9b,
-	0xaf, 0x5b, 0xdf, 0x58, 0x6f, 0x7d, 0xe3, 0x6d, 0xeb, 0x1b, 0x71, 0x13, 0xbf, 0xcc, 0xf0, 0x33,
-	0x00, 0x00, 0xff, 0xff, 0x72, 0xf9, 0x52, 0xdc, 0x88, 0x02, 0x00, 0x00,
+	// 457 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x93, 0xcf, 0x6e, 0xd3, 0x40,
+	0x10, 0xc6, 0x63, 0x27, 0x76, 0xd2, 0xa1, 0xfc, 0xd1, 0x52, 0x55, 0x2b, 0x1f, 0x4c, 0x04, 0x02,
+	0xe5, 0x82, 0x8b, 0xa8, 0x40, 0x08, 0xa9, 0x97, 0x48, 0x15, 0x12, 0x82, 0x8b, 0x25, 0xb8, 0x6f,
+	0x9c, 0xa9, 0x6b, 0xd5, 0xf1, 0x9a, 0xdd, 0x35, 0x4a, 0xde, 0x82, 0x17, 0xe1, 0x3d, 0x7a, 0xec,
+	0x09, 0x71, 0x02, 0x94, 0xbc, 0x08, 0xf2, 0xec, 0x62, 0xfe, 0x95, 0x52, 0xa9, 0xb7, 0xfd, 0x34,
+	0xfe, 0x7d, 0xb3, 0xdf, 0xec, 0x18, 0xae, 0x2f, 0x50, 0x6b, 0x91, 0x63, 0x52, 0x2b, 0x69, 0x24,
+	0xdb, 0xc9, 0x95, 0xa8, 0x8f, 0xf5, 0xaa, 0xca, 0x92, 0xae, 0x30, 0x8b, 0x1e, 0xe6, 0x85, 0x39,
+	0x6e, 0x66, 0x49, 0x26, 0x17, 0x7b, 0xb9, 0xcc, 0xe5, 0x1e, 0x7d, 0x3c, 0x6b, 0x8e, 0x48, 0x91,
+	0xa0, 0x93, 0x35, 0xb9, 0xfb, 0x29, 0x84, 0xe1, 0x6b, 0x4b, 0xb3, 0x47, 0x70, 0x3b, 0x93, 0x8b,
+	0xba, 0x44, 0x83, 0x29, 0xbe, 0x6b, 0x50, 0x9b, 0x57, 0x85, 0x36, 0xdc, 0x1b, 0x7b, 0x93, 0x51,
+	0x7a, 0x5e, 0x89, 0xbd, 0x80, 0x91, 0xb2, 0x52, 0x73, 0x7f, 0xdc, 0x9f, 0x5c, 0x7b, 0x7c, 0x3f,
+	0x39, 0xef, 0x56, 0x89, 0x6b, 0x91, 0x38, 0x78, 0x3a, 0x38, 0xfd, 0x72, 0xa7, 0x97, 0x76, 0x30,
+	0x7b, 0x09, 0x5b, 0x0a, 0x75, 0x2d, 0x2b, 0x8d, 0x9a, 0xf7, 0xc9, 0xe9, 0xc1, 0xff, 0x9c, 0xec,
+	0xe7, 0xce, 0xea, 0x27, 0xce, 0x0e, 0x60, 0x30, 0x17, 0x46, 0xf0, 0x01, 0xd9, 0xdc, 0xbb, 0xd8,
+	0x66, 0x5a, 0xca, 0xec, 0xc4, 0x79, 0x10, 0x16, 0x7d, 0xf4, 0x61, 0xe8, 0xae, 0xc9, 0x6e, 0x80,
+	0x5f, 0xcc, 0x69, 0x00, 0x41, 0xea, 0x17, 0x73, 0x16, 0xc1, 0x48, 0x63, 0x89, 0x99, 0x91, 0x8a,
+	0xfb, 0x63, 0x6f, 0xb2, 0x9d, 0x76, 0x9a, 0xed, 0x40, 0x80, 0x4b, 0xa3, 0x04, 0xef, 0x53, 0xc1,
+	0x8a, 0x96, 0xa8, 0x55, 0x21, 0x55, 0x61, 0x56, 0x7c, 0x40, 0x3e, 0x9d, 0x66, 0xbb, 0x10, 0x66,
+	0xa2, 0xca, 0xb0, 0xe4, 0x01, 0x8d, 0xd8, 0x29, 0xf6, 0x06, 0x00, 0x97, 0x06, 0x2b, 0x5d, 0xc8,
+	0x4a, 0xf3, 0x90, 0x62, 0x3c, 0xb9, 0xd4, 0x5c, 0x93, 0xc3, 0x8e, 0x3b, 0xac, 0x8c, 0x5a, 0xa5,
+	0xbf, 0x18, 0xb5, 0xed, 0x9a, 0x7a, 0x2e, 0x0c, 0xf2, 0xa1, 0x6d, 0x67, 0x55, 0x74, 0x00, 0x37,
+	0xff, 0xc0, 0xd8, 0x2d, 0xe8, 0x9f, 0xe0, 0x8a, 0x82, 0x6f, 0xa5, 0xed, 0xb1, 0x4d, 0xf7, 0x5e,
+	0x94, 0x0d, 0xba, 0xd8, 0x56, 0x3c, 0xf7, 0x9f, 0x79, 0xd1, 0x57, 0x0f, 0x46, 0x3f, 0x1e, 0xe3,
+	0xaf, 0x81, 0xed, 0x42, 0xa8, 0x8d, 0x30, 0x8d, 0x26, 0x2e, 0x48, 0x9d, 0xfa, 0xc7, 0xb0, 0xde,
+	0xfe, 0x16, 0xdc, 0xbe, 0xdf, 0xd3, 0xcb, 0xad, 0xc1, 0x45, 0xc9, 0xaf, 0x9a, 0x70, 0x1f, 0x02,
+	0x5a, 0x93, 0x36, 0x4d, 0xad, 0xf0, 0xa8, 0x58, 0x12, 0xb7, 0x9d, 0x3a, 0xc5, 0x98, 0xdb, 0x38,
+	0x4b, 0xd2, 0x79, 0xca, 0x4f, 0xd7, 0xb1, 0x77, 0xb6, 0x8e, 0xbd, 0x6f, 0xeb, 0xd8, 0xfb, 0xb0,
+	0x89, 0x7b, 0x67, 0x9b, 0xb8, 0xf7, 0x79, 0x13, 0xf7, 0x66, 0x21, 0xfd, 0x79, 0xfb, 0xdf, 0x07,
+	0x00, 0x60, 0x19, 0xe3, 0x44, 0xcf, 0x03, 0x00, 0x00,
 }
@@ -15,7 +15,11 @@ import (
 
 var log = logging.Logger("graphsync")
 
-const maxRetries = 10
+const (
+	defaultMaxRetries     = 10
+	defaultRetryDelay     = time.Millisecond * 100
+	defaultConnectTimeout = time.Minute * 10
+)
 
 // MessageNetwork is any network that can connect peers and generate a message
 // sender.
@@ -24,37 +28,108 @@ type MessageNetwork interface {
 	ConnectTo(context.Context, peer.ID) error
 }
 
+// DeliveryFailureHandler is notified with the IDs of the requests in a message
+// that could not be delivered to a peer, along with the reason why.
+type DeliveryFailureHandler func(p peer.ID, requestIDs []gsmsg.GraphSyncRequestID, err error)
+
 // MessageQueue implements queue of want messages to send to peers.
 type MessageQueue struct {
-	p       peer.ID
-	network MessageNetwork
-	ctx     context.Context
+	p              peer.ID
+	network        MessageNetwork
+	ctx            context.Context
+	failureHandler DeliveryFailureHandler
+
+	maxRetries         int
+	retryDelay         time.Duration
+	connectTimeout     time.Duration
+	sendMessageTimeout time.Duration
+	maxMessageSize     int
 
 	outgoingWork chan struct{}
 	done         chan struct{}
+	draining     chan struct{}
+	stopped      chan struct{}
 
 	// internal do not touch outside go routines
-	nextMessage        gsmsg.GraphSyncMessage
+	nextMessages       []gsmsg.GraphSyncMessage
+	nextMessageSize    int
 	nextMessageLk      sync.RWMutex
 	processedNotifiers []chan struct{}
 	sender             gsnet.MessageSender
 }
 
-// New creats a new MessageQueue.
-func New(ctx context.Context, p peer.ID, network MessageNetwork) *MessageQueue {
-	return &MessageQueue{
-		ctx:          ctx,
-		network:      network,
-		p:            p,
-		outgoingWork: make(chan struct{}, 1),
-		done:         make(chan struct{}),
+// Option configures a MessageQueue
+type Option func(*MessageQueue)
+
+// MaxRetries sets how many times the queue tries to send a message before
+// reporting it as undeliverable.
+func MaxRetries(maxRetries int) Option {
+	return func(mq *MessageQueue) {
+		mq.maxRetries = maxRetries
+	}
+}
+
+// RetryDelay sets how long the queue waits after a failed send before opening
+// a new sender and trying again.
+func RetryDelay(retryDelay time.Duration) Option {
+	return func(mq *MessageQueue) {
+		mq.retryDelay = retryDelay
+	}
+}
+
+// ConnectTimeout sets how long the queue allows for connecting to the peer,
+// including looking it up, dialing it and handshaking.
+func ConnectTimeout(connectTimeout time.Duration) Option {
+	return func(mq *MessageQueue) {
+		mq.connectTimeout = connectTimeout
+	}
+}
+
+// SendMessageTimeout sets how long a single attempt to write a message to the
+// peer may take. Zero leaves the deadline to the network.
+func SendMessageTimeout(sendMessageTimeout time.Duration) Option {
+	return func(mq *MessageQueue) {
+		mq.sendMessageTimeout = sendMessageTimeout
+	}
+}
+
+// MaxMessageSize sets the size in bytes at which the queue starts a new
+// message rather than adding to the one waiting to go out. The responses and
+// blocks added together are kept in the same message, so a message can be
+// larger when they are.
+func MaxMessageSize(maxMessageSize int) Option {
+	return func(mq *MessageQueue) {
+		mq.maxMessageSize = maxMessageSize
 	}
 }
 
+// New creats a new MessageQueue. The given failure handler, if not nil, is
+// called when a message cannot be delivered.
+func New(ctx context.Context, p peer.ID, network MessageNetwork, failureHandler DeliveryFailureHandler, options ...Option) *MessageQueue {
+	mq := &MessageQueue{
+		ctx:            ctx,
+		network:        network,
+		p:              p,
+		failureHandler: failureHandler,
+		maxRetries:     defaultMaxRetries,
+		retryDelay:     defaultRetryDelay,
+		connectTimeout: defaultConnectTimeout,
+		maxMessageSize: gsmsg.DefaultMaxMessageSize,
+		outgoingWork:   make(chan struct{}, 1),
+		done:           make(chan struct{}),
+		draining:       make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+	for _, option := range options {
+		option(mq)
+	}
+	return mq
+}
+
 // AddRequest adds an outgoing request to the message queue.
 func (mq *MessageQueue) AddRequest(graphSyncRequest gsmsg.GraphSyncRequest) {
 
-	if mq.mutateNextMessage(func(nextMessage gsmsg.GraphSyncMessage) {
+	if mq.mutateNextMessage(requestSize(graphSyncRequest), func(nextMessage gsmsg.GraphSyncMessage) {
 		nextMessage.AddRequest(graphSyncRequest)
 	}, nil) {
 		mq.signalWork()
@@ -66,7 +141,7 @@ func (mq *MessageQueue) AddRequest(graphSyncRequest gsmsg.GraphSyncRequest) {
 // sending will not block.
 func (mq *MessageQueue) AddResponses(responses []gsmsg.GraphSyncResponse, blks []blocks.Block) <-chan struct{} {
 	notificationChannel := make(chan struct{}, 1)
-	if mq.mutateNextMessage(func(nextMessage gsmsg.GraphSyncMessage) {
+	if mq.mutateNextMessage(responsesSize(responses, blks), func(nextMessage gsmsg.GraphSyncMessage) {
 		for _, response := range responses {
 			nextMessage.AddResponse(response)
 		}
@@ -90,11 +165,31 @@ func (mq *MessageQueue) Shutdown() {
 	close(mq.done)
 }
 
+// Drain sends the message that is waiting to go out, if any, and then stops
+// the processing of messages for a message queue. It returns once the queue
+// has stopped or the context ends.
+func (mq *MessageQueue) Drain(ctx context.Context) error {
+	close(mq.draining)
+	select {
+	case <-mq.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (mq *MessageQueue) runQueue() {
+	defer close(mq.stopped)
 	for {
 		select {
 		case <-mq.outgoingWork:
-			mq.sendMessage()
+			mq.sendMessages()
+		case <-mq.draining:
+			mq.sendMessages()
+			if mq.sender != nil {
+				mq.sender.Close()
+			}
+			return
 		case <-mq.done:
 			if mq.sender != nil {
 				mq.sender.Close()
@@ -109,17 +204,50 @@ func (mq *MessageQueue) runQueue() {
 	}
 }
 
-func (mq *MessageQueue) mutateNextMessage(mutator func(gsmsg.GraphSyncMessage), processedNotifier chan struct{}) bool {
+// mutateNextMessage applies the mutator to the last message waiting to go out,
+// first starting a new message if adding the given number of bytes would take
+// the last one over the maximum message size
+func (mq *MessageQueue) mutateNextMessage(size int, mutator func(gsmsg.GraphSyncMessage), processedNotifier chan struct{}) bool {
 	mq.nextMessageLk.Lock()
 	defer mq.nextMessageLk.Unlock()
-	if mq.nextMessage == nil {
-		mq.nextMessage = gsmsg.New()
+	if len(mq.nextMessages) == 0 ||
+		(mq.nextMessageSize > 0 && mq.nextMessageSize+size > mq.maxMessageSize) {
+		mq.nextMessages = append(mq.nextMessages, gsmsg.New())
+		mq.nextMessageSize = 0
 	}
-	mutator(mq.nextMessage)
+	nextMessage := mq.nextMessages[len(mq.nextMessages)-1]
+	mutator(nextMessage)
+	mq.nextMessageSize += size
 	if processedNotifier != nil {
 		mq.processedNotifiers = append(mq.processedNotifiers, processedNotifier)
 	}
-	return !mq.nextMessage.Empty()
+	return !nextMessage.Empty()
+}
+
+// requestSize estimates how many bytes a request adds to a message
+func requestSize(request gsmsg.GraphSyncRequest) int {
+	return len(request.Selector()) + extensionsSize(request.Extensions())
+}
+
+// responsesSize estimates how many bytes responses and their blocks add to a
+// message
+func responsesSize(responses []gsmsg.GraphSyncResponse, blks []blocks.Block) int {
+	size := 0
+	for _, response := range responses {
+		size += len(response.Extra()) + extensionsSize(response.Extensions())
+	}
+	for _, block := range blks {
+		size += len(block.RawData())
+	}
+	return size
+}
+
+func extensionsSize(extensions []gsmsg.GraphSyncExtension) int {
+	size := 0
+	for _, extension := range extensions {
+		size += len(extension.Name) + len(extension.Data)
+	}
+	return size
 }
 
 func (mq *MessageQueue) signalWork() {
@@ -129,11 +257,12 @@ func (mq *MessageQueue) signalWork() {
 	}
 }
 
-func (mq *MessageQueue) extractOutgoingMessage() gsmsg.GraphSyncMessage {
-	// grab outgoing message
+func (mq *MessageQueue) extractOutgoingMessages() []gsmsg.GraphSyncMessage {
+	// grab outgoing messages
 	mq.nextMessageLk.Lock()
-	message := mq.nextMessage
-	mq.nextMessage = nil
+	messages := mq.nextMessages
+	mq.nextMessages = nil
+	mq.nextMessageSize = 0
 	for _, processedNotifier := range mq.processedNotifiers {
 		select {
 		case processedNotifier <- struct{}{}:
@@ -143,34 +272,62 @@ func (mq *MessageQueue) extractOutgoingMessage() gsmsg.GraphSyncMessage {
 	}
 	mq.processedNotifiers = nil
 	mq.nextMessageLk.Unlock()
-	return message
+	return messages
 }
 
-func (mq *MessageQueue) sendMessage() {
-	message := mq.extractOutgoingMessage()
-	if message == nil || message.Empty() {
+func (mq *MessageQueue) sendMessages() {
+	for _, message := range mq.extractOutgoingMessages() {
+		mq.sendMessage(message)
+	}
+}
+
+func (mq *MessageQueue) sendMessage(message gsmsg.GraphSyncMessage) {
+	if message.Empty() {
 		return
 	}
 
 	err := mq.initializeSender()
 	if err != nil {
 		log.Infof("cant open message sender to peer %s: %s", mq.p, err)
-		// TODO: cant connect, what now?
+		mq.failMessage(message, err)
 		return
 	}
 
-	for i := 0; i < maxRetries; i++ { // try to send this message until we fail.
-		if mq.attemptSendAndRecovery(message) {
-			return
+	for i := 0; i < mq.maxRetries; i++ { // try to send this message until we fail.
+		var done bool
+		done, err = mq.attemptSendAndRecovery(message)
+		if done {
+			break
 		}
 	}
+	if err != nil {
+		mq.failMessage(message, err)
+	}
+}
+
+// failMessage reports the requests in a message that could not be sent
+func (mq *MessageQueue) failMessage(message gsmsg.GraphSyncMessage, err error) {
+	if mq.failureHandler == nil {
+		return
+	}
+	requests := message.Requests()
+	requestIDs := make([]gsmsg.GraphSyncRequestID, 0, len(requests))
+	for _, request := range requests {
+		if !request.IsCancel() {
+			requestIDs = append(requestIDs, request.ID())
+		}
+	}
+	if len(requestIDs) == 0 {
+		return
+	}
+	mq.failureHandler(mq.p, requestIDs, err)
 }
 
 func (mq *MessageQueue) initializeSender() error {
 	if mq.sender != nil {
 		return nil
 	}
-	nsender, err := openSender(mq.ctx, mq.network, mq.p)
+	nsender, err := openSender(mq.ctx, mq.network, mq.p, mq.connectTimeout)
 	if err != nil {
 		return err
 	}
@@ -178,10 +335,12 @@ func (mq *MessageQueue) initializeSender() error {
 	return nil
 }
 
-func (mq *MessageQueue) attemptSendAndRecovery(message gsmsg.GraphSyncMessage) bool {
-	err := mq.sender.SendMsg(mq.ctx, message)
+// attemptSendAndRecovery tries to send a message, returning whether to stop
+// trying and the error that kept the message from sending, if any
+func (mq *MessageQueue) attemptSendAndRecovery(message gsmsg.GraphSyncMessage) (bool, error) {
+	err := mq.sendMsg(message)
 	if err == nil {
-		return true
+		return true, nil
 	}
 
 	log.Infof("graphsync send error: %s", err)
@@ -190,29 +349,35 @@ func (mq *MessageQueue) attemptSendAndRecovery(message gsmsg.GraphSyncMessage) b
 
 	select {
 	case <-mq.ctx.Done():
-		return true
-	case <-time.After(time.Millisecond * 100):
-		// wait 100ms in case disconnect notifications are still propogating
+		return true, nil
+	case <-time.After(mq.retryDelay):
+		// wait in case disconnect notifications are still propogating
 		log.Warning("SendMsg errored but neither 'done' nor context.Done() were set")
 	}
 
+	sendErr := err
 	err = mq.initializeSender()
 	if err != nil {
 		log.Infof("couldnt open sender again after SendMsg(%s) failed: %s", mq.p, err)
-		// TODO(why): what do we do now?
-		// I think the *right* answer is to probably put the message we're
-		// trying to send back, and then return to waiting for new work or
-		// a disconnect.
-		return true
+		return true, err
 	}
 
-	return false
+	return false, sendErr
+}
+
+func (mq *MessageQueue) sendMsg(message gsmsg.GraphSyncMessage) error {
+	if mq.sendMessageTimeout <= 0 {
+		return mq.sender.SendMsg(mq.ctx, message)
+	}
+	ctx, cancel := context.WithTimeout(mq.ctx, mq.sendMessageTimeout)
+	defer cancel()
+	return mq.sender.SendMsg(ctx, message)
 }
 
-func openSender(ctx context.Context, network MessageNetwork, p peer.ID) (gsnet.MessageSender, error) {
-	// allow ten minutes for connections this includes looking them up in the
+func openSender(ctx context.Context, network MessageNetwork, p peer.ID, connectTimeout time.Duration) (gsnet.MessageSender, error) {
+	// allow time for connections this includes looking them up in the
 	// dht dialing them, and handshaking
-	conctx, cancel := context.WithTimeout(ctx, time.Minute*10)
+	conctx, cancel := context.WithTimeout(ctx, connectTimeout)
 	defer cancel()
 
 	err := network.ConnectTo(conctx, p)
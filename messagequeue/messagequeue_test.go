@@ -2,12 +2,14 @@ package messagequeue
 
 import (
 	"context"
+	"errors"
 	"math/rand"
 	"reflect"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-graphsync/testutil"
 
 	gsmsg "github.com/ipfs/go-graphsync/message"
@@ -62,7 +64,7 @@ func TestStartupAndShutdown(t *testing.T) {
 	var waitGroup sync.WaitGroup
 	messageNetwork := &fakeMessageNetwork{nil, nil, messageSender, &waitGroup}
 
-	messageQueue := New(ctx, peer, messageNetwork)
+	messageQueue := New(ctx, peer, messageNetwork, nil)
 	messageQueue.Startup()
 	id := gsmsg.GraphSyncRequestID(rand.Int31())
 	priority := gsmsg.GraphSyncPriority(rand.Int31())
@@ -101,7 +103,7 @@ func TestProcessingNotification(t *testing.T) {
 	var waitGroup sync.WaitGroup
 	messageNetwork := &fakeMessageNetwork{nil, nil, messageSender, &waitGroup}
 
-	messageQueue := New(ctx, peer, messageNetwork)
+	messageQueue := New(ctx, peer, messageNetwork, nil)
 	waitGroup.Add(1)
 	blks := testutil.GenerateBlocksOfSize(3, 128)
 
@@ -158,7 +160,7 @@ func TestDedupingMessages(t *testing.T) {
 	var waitGroup sync.WaitGroup
 	messageNetwork := &fakeMessageNetwork{nil, nil, messageSender, &waitGroup}
 
-	messageQueue := New(ctx, peer, messageNetwork)
+	messageQueue := New(ctx, peer, messageNetwork, nil)
 	messageQueue.Startup()
 	waitGroup.Add(1)
 	id := gsmsg.GraphSyncRequestID(rand.Int31())
@@ -220,3 +222,174 @@ func TestDedupingMessages(t *testing.T) {
 		}
 	}
 }
+
+func TestDeliveryFailureReportsRequests(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	p := testutil.GeneratePeers(1)[0]
+	messagesSent := make(chan gsmsg.GraphSyncMessage)
+	resetChan := make(chan struct{}, 1)
+	fullClosedChan := make(chan struct{}, 1)
+	messageSender := &fakeMessageSender{nil, fullClosedChan, resetChan, messagesSent}
+	var waitGroup sync.WaitGroup
+	connectError := errors.New("unable to connect")
+	messageNetwork := &fakeMessageNetwork{connectError, nil, messageSender, &waitGroup}
+
+	type deliveryFailure struct {
+		p          peer.ID
+		requestIDs []gsmsg.GraphSyncRequestID
+		err        error
+	}
+	failures := make(chan deliveryFailure, 1)
+	failureHandler := func(p peer.ID, requestIDs []gsmsg.GraphSyncRequestID, err error) {
+		failures <- deliveryFailure{p, requestIDs, err}
+	}
+
+	messageQueue := New(ctx, p, messageNetwork, failureHandler)
+	id := gsmsg.GraphSyncRequestID(rand.Int31())
+	cancelledID := gsmsg.GraphSyncRequestID(rand.Int31())
+	priority := gsmsg.GraphSyncPriority(rand.Int31())
+	selector := testutil.RandomBytes(100)
+	messageQueue.AddRequest(gsmsg.NewRequest(id, selector, priority))
+	messageQueue.AddRequest(gsmsg.CancelRequest(cancelledID))
+	messageQueue.Startup()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("delivery failure was not reported")
+	case failure := <-failures:
+		if failure.p != p ||
+			!reflect.DeepEqual(failure.requestIDs, []gsmsg.GraphSyncRequestID{id}) ||
+			failure.err != connectError {
+			t.Fatal("reported incorrect delivery failure")
+		}
+	}
+}
+
+func TestConfiguredSendRetries(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	p := testutil.GeneratePeers(1)[0]
+	maxRetries := 3
+	messagesSent := make(chan gsmsg.GraphSyncMessage, maxRetries)
+	resetChan := make(chan struct{}, maxRetries)
+	fullClosedChan := make(chan struct{}, 1)
+	sendError := errors.New("unable to send")
+	messageSender := &fakeMessageSender{sendError, fullClosedChan, resetChan, messagesSent}
+	var waitGroup sync.WaitGroup
+	messageNetwork := &fakeMessageNetwork{nil, nil, messageSender, &waitGroup}
+
+	failures := make(chan error, 1)
+	failureHandler := func(p peer.ID, requestIDs []gsmsg.GraphSyncRequestID, err error) {
+		failures <- err
+	}
+
+	messageQueue := New(ctx, p, messageNetwork, failureHandler,
+		MaxRetries(maxRetries), RetryDelay(time.Millisecond))
+	id := gsmsg.GraphSyncRequestID(rand.Int31())
+	priority := gsmsg.GraphSyncPriority(rand.Int31())
+	selector := testutil.RandomBytes(100)
+	// one sender is opened up front and another after each failed send
+	waitGroup.Add(maxRetries + 1)
+	messageQueue.AddRequest(gsmsg.NewRequest(id, selector, priority))
+	messageQueue.Startup()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("delivery failure was not reported")
+	case err := <-failures:
+		if err != sendError {
+			t.Fatal("reported incorrect delivery failure")
+		}
+	}
+	if len(messagesSent) != maxRetries {
+		t.Fatal("did not attempt to send the configured number of times")
+	}
+}
+
+func TestDrainSendsPendingMessage(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	p := testutil.GeneratePeers(1)[0]
+	messagesSent := make(chan gsmsg.GraphSyncMessage, 1)
+	resetChan := make(chan struct{}, 1)
+	fullClosedChan := make(chan struct{}, 1)
+	messageSender := &fakeMessageSender{nil, fullClosedChan, resetChan, messagesSent}
+	var waitGroup sync.WaitGroup
+	messageNetwork := &fakeMessageNetwork{nil, nil, messageSender, &waitGroup}
+
+	messageQueue := New(ctx, p, messageNetwork, nil)
+	id := gsmsg.GraphSyncRequestID(rand.Int31())
+	priority := gsmsg.GraphSyncPriority(rand.Int31())
+	selector := testutil.RandomBytes(100)
+	waitGroup.Add(1)
+	messageQueue.AddRequest(gsmsg.NewRequest(id, selector, priority))
+	messageQueue.Startup()
+
+	err := messageQueue.Drain(ctx)
+	if err != nil {
+		t.Fatal("drain should have completed without error")
+	}
+	select {
+	case message := <-messagesSent:
+		requests := message.Requests()
+		if len(requests) != 1 || requests[0].ID() != id {
+			t.Fatal("did not send pending request")
+		}
+	default:
+		t.Fatal("did not send pending message before stopping")
+	}
+	select {
+	case <-fullClosedChan:
+	default:
+		t.Fatal("did not close message sender")
+	}
+}
+
+func TestSplitsLargeMessages(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	p := testutil.GeneratePeers(1)[0]
+	messagesSent := make(chan gsmsg.GraphSyncMessage, 3)
+	resetChan := make(chan struct{}, 1)
+	fullClosedChan := make(chan struct{}, 1)
+	messageSender := &fakeMessageSender{nil, fullClosedChan, resetChan, messagesSent}
+	var waitGroup sync.WaitGroup
+	messageNetwork := &fakeMessageNetwork{nil, nil, messageSender, &waitGroup}
+
+	messageQueue := New(ctx, p, messageNetwork, nil, MaxMessageSize(250))
+	blks := testutil.GenerateBlocksOfSize(3, 100)
+	responseIDs := make([]gsmsg.GraphSyncRequestID, 0, len(blks))
+	for _, block := range blks {
+		responseID := gsmsg.GraphSyncRequestID(rand.Int31())
+		responseIDs = append(responseIDs, responseID)
+		response := gsmsg.NewResponse(responseID, gsmsg.PartialResponse, testutil.RandomBytes(100))
+		messageQueue.AddResponses([]gsmsg.GraphSyncResponse{response}, []blocks.Block{block})
+	}
+	waitGroup.Add(1)
+	messageQueue.Startup()
+
+	for i, block := range blks {
+		select {
+		case <-ctx.Done():
+			t.Fatal("did not send message for each response")
+		case message := <-messagesSent:
+			responses := message.Responses()
+			if len(responses) != 1 || responses[0].RequestID() != responseIDs[i] {
+				t.Fatal("did not send one response per message")
+			}
+			receivedBlocks := message.Blocks()
+			if len(receivedBlocks) != 1 || receivedBlocks[0].Cid() != block.Cid() {
+				t.Fatal("did not send block in same message as its response")
+			}
+		}
+	}
+}
@@ -33,3 +33,18 @@ func TestDecodeEncodeMetadata(t *testing.T) {
 		t.Fatal("Metadata changed during encoding and decoding")
 	}
 }
+
+func TestDecodeEncodeEmptyMetadata(t *testing.T) {
+	bridge := testbridge.NewMockIPLDBridge()
+	encoded, err := EncodeMetadata(Metadata{}, bridge)
+	if err != nil {
+		t.Fatal("Error encoding")
+	}
+	decodedMetadata, err := DecodeMetadata(encoded, bridge)
+	if err != nil {
+		t.Fatal("Error decoding")
+	}
+	if len(decodedMetadata) != 0 {
+		t.Fatal("Metadata changed during encoding and decoding")
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	peer "github.com/libp2p/go-libp2p-peer"
 	protocol "github.com/libp2p/go-libp2p-protocol"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 var (
@@ -27,9 +28,17 @@ type GraphSyncNetwork interface {
 	// network.
 	SetDelegate(Receiver)
 
+	// Stop stops handling new streams from the network and stops sending
+	// connection events to the Receiver
+	Stop()
+
 	// ConnectTo establishes a connection to the given peer
 	ConnectTo(context.Context, peer.ID) error
 
+	// AddAddrs records addresses the given peer can be reached at, for
+	// connecting to it later
+	AddAddrs(peer.ID, []ma.Multiaddr)
+
 	NewMessageSender(context.Context, peer.ID) (MessageSender, error)
 }
 
@@ -48,4 +57,10 @@ type Receiver interface {
 		incoming gsmsg.GraphSyncMessage)
 
 	ReceiveError(error)
+
+	// Connected is called when a connection is opened to a peer
+	Connected(p peer.ID)
+
+	// Disconnected is called when a connection to a peer is closed
+	Disconnected(p peer.ID)
 }
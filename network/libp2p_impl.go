@@ -14,16 +14,32 @@ import (
 	inet "github.com/libp2p/go-libp2p-net"
 	peer "github.com/libp2p/go-libp2p-peer"
 	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 var log = logging.Logger("graphsync_network")
 
-var sendMessageTimeout = time.Minute * 10
+const defaultSendMessageTimeout = time.Minute * 10
+
+// Option configures a GraphSyncNetwork created from a libp2p host
+type Option func(*libp2pGraphSyncNetwork)
+
+// SendMessageTimeout sets how long writing a message to a stream may take when
+// the context it is sent with has no deadline.
+func SendMessageTimeout(sendMessageTimeout time.Duration) Option {
+	return func(gsnet *libp2pGraphSyncNetwork) {
+		gsnet.sendMessageTimeout = sendMessageTimeout
+	}
+}
 
 // NewFromLibp2pHost returns a GraphSyncNetwork supported by underlying Libp2p host.
-func NewFromLibp2pHost(host host.Host) GraphSyncNetwork {
+func NewFromLibp2pHost(host host.Host, options ...Option) GraphSyncNetwork {
 	graphSyncNetwork := libp2pGraphSyncNetwork{
-		host: host,
+		host:               host,
+		sendMessageTimeout: defaultSendMessageTimeout,
+	}
+	for _, option := range options {
+		option(&graphSyncNetwork)
 	}
 	host.SetStreamHandler(ProtocolGraphsync, graphSyncNetwork.handleNewStream)
 
@@ -33,13 +49,15 @@ func NewFromLibp2pHost(host host.Host) GraphSyncNetwork {
 // libp2pGraphSyncNetwork transforms the libp2p host interface, which sends and receives
 // NetMessage objects, into the graphsync network interface.
 type libp2pGraphSyncNetwork struct {
-	host host.Host
+	host               host.Host
+	sendMessageTimeout time.Duration
 	// inbound messages from the network are forwarded to the receiver
 	receiver Receiver
 }
 
 type streamMessageSender struct {
-	s inet.Stream
+	s                  inet.Stream
+	sendMessageTimeout time.Duration
 }
 
 func (s *streamMessageSender) Close() error {
@@ -51,10 +69,10 @@ func (s *streamMessageSender) Reset() error {
 }
 
 func (s *streamMessageSender) SendMsg(ctx context.Context, msg gsmsg.GraphSyncMessage) error {
-	return msgToStream(ctx, s.s, msg)
+	return msgToStream(ctx, s.s, msg, s.sendMessageTimeout)
 }
 
-func msgToStream(ctx context.Context, s inet.Stream, msg gsmsg.GraphSyncMessage) error {
+func msgToStream(ctx context.Context, s inet.Stream, msg gsmsg.GraphSyncMessage, sendMessageTimeout time.Duration) error {
 	log.Debugf("Outgoing message with %d requests, %d responses, and %d blocks",
 		len(msg.Requests()), len(msg.Responses()), len(msg.Blocks()))
 
@@ -88,7 +106,7 @@ func (gsnet *libp2pGraphSyncNetwork) NewMessageSender(ctx context.Context, p pee
 		return nil, err
 	}
 
-	return &streamMessageSender{s: s}, nil
+	return &streamMessageSender{s: s, sendMessageTimeout: gsnet.sendMessageTimeout}, nil
 }
 
 func (gsnet *libp2pGraphSyncNetwork) newStreamToPeer(ctx context.Context, p peer.ID) (inet.Stream, error) {
@@ -105,7 +123,7 @@ func (gsnet *libp2pGraphSyncNetwork) SendMessage(
 		return err
 	}
 
-	if err = msgToStream(ctx, s, outgoing); err != nil {
+	if err = msgToStream(ctx, s, outgoing, gsnet.sendMessageTimeout); err != nil {
 		s.Reset()
 		return err
 	}
@@ -118,12 +136,22 @@ func (gsnet *libp2pGraphSyncNetwork) SendMessage(
 
 func (gsnet *libp2pGraphSyncNetwork) SetDelegate(r Receiver) {
 	gsnet.receiver = r
+	gsnet.host.Network().Notify((*libp2pGraphSyncNotifee)(gsnet))
+}
+
+func (gsnet *libp2pGraphSyncNetwork) Stop() {
+	gsnet.host.RemoveStreamHandler(ProtocolGraphsync)
+	gsnet.host.Network().StopNotify((*libp2pGraphSyncNotifee)(gsnet))
 }
 
 func (gsnet *libp2pGraphSyncNetwork) ConnectTo(ctx context.Context, p peer.ID) error {
 	return gsnet.host.Connect(ctx, pstore.PeerInfo{ID: p})
 }
 
+func (gsnet *libp2pGraphSyncNetwork) AddAddrs(p peer.ID, addrs []ma.Multiaddr) {
+	gsnet.host.Peerstore().AddAddrs(p, addrs, pstore.ProviderAddrTTL)
+}
+
 // handleNewStream receives a new stream from the network.
 func (gsnet *libp2pGraphSyncNetwork) handleNewStream(s inet.Stream) {
 	defer s.Close()
@@ -151,3 +179,24 @@ func (gsnet *libp2pGraphSyncNetwork) handleNewStream(s inet.Stream) {
 		gsnet.receiver.ReceiveMessage(ctx, p, received)
 	}
 }
+
+// libp2pGraphSyncNotifee forwards connection events from the libp2p network
+// to the receiver
+type libp2pGraphSyncNotifee libp2pGraphSyncNetwork
+
+func (nn *libp2pGraphSyncNotifee) libp2pGraphSyncNetwork() *libp2pGraphSyncNetwork {
+	return (*libp2pGraphSyncNetwork)(nn)
+}
+
+func (nn *libp2pGraphSyncNotifee) Connected(n inet.Network, v inet.Conn) {
+	nn.libp2pGraphSyncNetwork().receiver.Connected(v.RemotePeer())
+}
+
+func (nn *libp2pGraphSyncNotifee) Disconnected(n inet.Network, v inet.Conn) {
+	nn.libp2pGraphSyncNetwork().receiver.Disconnected(v.RemotePeer())
+}
+
+func (nn *libp2pGraphSyncNotifee) OpenedStream(n inet.Network, v inet.Stream) {}
+func (nn *libp2pGraphSyncNotifee) ClosedStream(n inet.Network, v inet.Stream) {}
+func (nn *libp2pGraphSyncNotifee) Listen(n inet.Network, a ma.Multiaddr)      {}
+func (nn *libp2pGraphSyncNotifee) ListenClose(n inet.Network, a ma.Multiaddr) {}
@@ -15,9 +15,11 @@ import (
 
 // Receiver is an interface for receiving messages from the GraphSyncNetwork.
 type receiver struct {
-	messageReceived chan struct{}
-	lastMessage     gsmsg.GraphSyncMessage
-	lastSender      peer.ID
+	messageReceived   chan struct{}
+	lastMessage       gsmsg.GraphSyncMessage
+	lastSender        peer.ID
+	connectedPeers    chan peer.ID
+	disconnectedPeers chan peer.ID
 }
 
 func (r *receiver) ReceiveMessage(
@@ -35,6 +37,18 @@ func (r *receiver) ReceiveMessage(
 func (r *receiver) ReceiveError(err error) {
 }
 
+func (r *receiver) Connected(p peer.ID) {
+	if r.connectedPeers != nil {
+		r.connectedPeers <- p
+	}
+}
+
+func (r *receiver) Disconnected(p peer.ID) {
+	if r.disconnectedPeers != nil {
+		r.disconnectedPeers <- p
+	}
+}
+
 func TestMessageSendAndReceive(t *testing.T) {
 	// create network
 	ctx := context.Background()
@@ -124,3 +138,57 @@ func TestMessageSendAndReceive(t *testing.T) {
 		t.Fatal("Sent message responses did not match received message responses")
 	}
 }
+
+func TestConnectionNotifications(t *testing.T) {
+	// create network
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	mn := mocknet.New(ctx)
+
+	host1, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal("error generating host")
+	}
+	host2, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal("error generating host")
+	}
+	err = mn.LinkAll()
+	if err != nil {
+		t.Fatal("error linking hosts")
+	}
+	gsnet1 := NewFromLibp2pHost(host1)
+	r := &receiver{
+		messageReceived:   make(chan struct{}),
+		connectedPeers:    make(chan peer.ID, 1),
+		disconnectedPeers: make(chan peer.ID, 1),
+	}
+	gsnet1.SetDelegate(r)
+
+	err = gsnet1.ConnectTo(ctx, host2.ID())
+	if err != nil {
+		t.Fatal("Unable to connect peers")
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("did not receive connect notification")
+	case p := <-r.connectedPeers:
+		if p != host2.ID() {
+			t.Fatal("received connect notification for wrong peer")
+		}
+	}
+
+	err = mn.DisconnectPeers(host1.ID(), host2.ID())
+	if err != nil {
+		t.Fatal("Unable to disconnect peers")
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("did not receive disconnect notification")
+	case p := <-r.disconnectedPeers:
+		if p != host2.ID() {
+			t.Fatal("received disconnect notification for wrong peer")
+		}
+	}
+}
@@ -10,7 +10,11 @@ import (
 // PeerProcess is any process that provides services for a peer
 type PeerProcess interface {
 	Startup()
+	// Shutdown stops the process, dropping any work it has not finished
 	Shutdown()
+	// Drain finishes the work the process has outstanding and then stops it,
+	// returning once it has stopped or the context ends
+	Drain(ctx context.Context) error
 }
 
 // PeerProcessFactory provides a function that will create a PeerQueue.
@@ -26,17 +30,40 @@ type PeerManager struct {
 	peerProcesses   map[peer.ID]*peerProcessInstance
 	peerProcessesLk sync.RWMutex
 
+	// peers whose last connection closed and that have not connected again
+	disconnected          map[peer.ID]struct{}
+	stopAfterDisconnected bool
+
 	createPeerProcess PeerProcessFactory
 	ctx               context.Context
 }
 
+// Option configures a PeerManager
+type Option func(*PeerManager)
+
+// StopAfterDisconnected makes GetProcess return a stopped process, which drops
+// any work given to it, for a peer that has disconnected and not connected
+// again, rather than starting a process that no later Disconnected would shut
+// down. It suits processes that only serve connected peers, unlike message
+// queues, which connect to the peer themselves.
+func StopAfterDisconnected() Option {
+	return func(pm *PeerManager) {
+		pm.stopAfterDisconnected = true
+	}
+}
+
 // New creates a new PeerManager, given a context and a peerQueueFactory.
-func New(ctx context.Context, createPeerQueue PeerProcessFactory) *PeerManager {
-	return &PeerManager{
+func New(ctx context.Context, createPeerQueue PeerProcessFactory, options ...Option) *PeerManager {
+	pm := &PeerManager{
 		peerProcesses:     make(map[peer.ID]*peerProcessInstance),
+		disconnected:      make(map[peer.ID]struct{}),
 		createPeerProcess: createPeerQueue,
 		ctx:               ctx,
 	}
+	for _, option := range options {
+		option(pm)
+	}
+	return pm
 }
 
 // ConnectedPeers returns a list of peers this PeerManager is managing.
@@ -53,6 +80,7 @@ func (pm *PeerManager) ConnectedPeers() []peer.ID {
 // Connected is called to add a new peer to the pool
 func (pm *PeerManager) Connected(p peer.ID) {
 	pm.peerProcessesLk.Lock()
+	delete(pm.disconnected, p)
 	pq := pm.getOrCreate(p)
 	pq.refcnt++
 	pm.peerProcessesLk.Unlock()
@@ -74,16 +102,50 @@ func (pm *PeerManager) Disconnected(p peer.ID) {
 	}
 
 	delete(pm.peerProcesses, p)
+	pm.disconnected[p] = struct{}{}
 	pm.peerProcessesLk.Unlock()
 
 	pq.process.Shutdown()
 
 }
 
-// GetProcess returns the process for the given peer
+// Shutdown drains the processes for all peers and removes them from the pool,
+// returning once they have all stopped or the context ends.
+func (pm *PeerManager) Shutdown(ctx context.Context) error {
+	pm.peerProcessesLk.Lock()
+	peerProcesses := pm.peerProcesses
+	pm.peerProcesses = make(map[peer.ID]*peerProcessInstance)
+	pm.peerProcessesLk.Unlock()
+
+	drainErrs := make(chan error, len(peerProcesses))
+	for _, pqi := range peerProcesses {
+		go func(process PeerProcess) {
+			drainErrs <- process.Drain(ctx)
+		}(pqi.process)
+	}
+	var err error
+	for range peerProcesses {
+		if drainErr := <-drainErrs; drainErr != nil {
+			err = drainErr
+		}
+	}
+	return err
+}
+
+// GetProcess returns the process for the given peer, starting one if the peer
+// has none. A process started this way holds no connection reference, so the
+// peer's next Disconnected shuts it down.
 func (pm *PeerManager) GetProcess(
 	p peer.ID) PeerProcess {
 	pm.peerProcessesLk.Lock()
+	if _, ok := pm.peerProcesses[p]; !ok && pm.stopAfterDisconnected {
+		if _, disconnected := pm.disconnected[p]; disconnected {
+			pm.peerProcessesLk.Unlock()
+			pq := pm.createPeerProcess(pm.ctx, p)
+			pq.Shutdown()
+			return pq
+		}
+	}
 	pqi := pm.getOrCreate(p)
 	pm.peerProcessesLk.Unlock()
 	return pqi.process
@@ -9,10 +9,13 @@ import (
 )
 
 type fakePeerProcess struct {
+	started  bool
+	shutdown bool
 }
 
-func (fp *fakePeerProcess) Startup()  {}
-func (fp *fakePeerProcess) Shutdown() {}
+func (fp *fakePeerProcess) Startup()                    { fp.started = true }
+func (fp *fakePeerProcess) Shutdown()                   { fp.shutdown = true }
+func (fp *fakePeerProcess) Drain(context.Context) error { return nil }
 
 func TestAddingAndRemovingPeers(t *testing.T) {
 	ctx := context.Background()
@@ -58,3 +61,51 @@ func TestAddingAndRemovingPeers(t *testing.T) {
 		t.Fatal("Peer was disconnected but should not have been")
 	}
 }
+
+func TestGettingProcessesAfterDisconnecting(t *testing.T) {
+	ctx := context.Background()
+	peerProcessFatory := func(ctx context.Context, p peer.ID) PeerProcess {
+		return &fakePeerProcess{}
+	}
+
+	tp := testutil.GeneratePeers(2)
+	peer1, peer2 := tp[0], tp[1]
+	peerManager := New(ctx, peerProcessFatory, StopAfterDisconnected())
+
+	// a peer that has not connected yet gets a running process, which its
+	// next disconnect shuts down
+	process := peerManager.GetProcess(peer1).(*fakePeerProcess)
+	if !process.started || process.shutdown {
+		t.Fatal("Process for a peer not yet connected should have been started")
+	}
+	peerManager.Connected(peer1)
+	peerManager.Disconnected(peer1)
+	if !process.shutdown {
+		t.Fatal("Process should have been shut down when its peer disconnected")
+	}
+
+	// a peer that has disconnected does not get a process kept in the pool
+	process = peerManager.GetProcess(peer1).(*fakePeerProcess)
+	if process.started || !process.shutdown {
+		t.Fatal("Process for a disconnected peer should have been stopped")
+	}
+	if testutil.ContainsPeer(peerManager.ConnectedPeers(), peer1) {
+		t.Fatal("Disconnected peer should not have been added back to the pool")
+	}
+
+	// connecting again lifts this
+	peerManager.Connected(peer1)
+	process = peerManager.GetProcess(peer1).(*fakePeerProcess)
+	if !process.started || process.shutdown {
+		t.Fatal("Process for a reconnected peer should have been started")
+	}
+
+	// without the option, processes are started after disconnecting
+	peerManager = New(ctx, peerProcessFatory)
+	peerManager.Connected(peer2)
+	peerManager.Disconnected(peer2)
+	process = peerManager.GetProcess(peer2).(*fakePeerProcess)
+	if !process.started || process.shutdown {
+		t.Fatal("Process should have been started for a peer it can connect to")
+	}
+}
@@ -24,8 +24,9 @@ type fakePeer struct {
 	messagesSent chan messageSent
 }
 
-func (fp *fakePeer) Startup()  {}
-func (fp *fakePeer) Shutdown() {}
+func (fp *fakePeer) Startup()                    {}
+func (fp *fakePeer) Shutdown()                   {}
+func (fp *fakePeer) Drain(context.Context) error { return nil }
 
 func (fp *fakePeer) AddRequest(graphSyncRequest gsmsg.GraphSyncRequest) {
 	message := gsmsg.New()
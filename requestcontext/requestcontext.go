@@ -0,0 +1,33 @@
+package requestcontext
+
+import (
+	"context"
+
+	gsmsg "github.com/ipfs/go-graphsync/message"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+type requestKey struct{}
+
+type request struct {
+	p         peer.ID
+	requestID gsmsg.GraphSyncRequestID
+}
+
+// New returns a context for loading and storing links for the request with
+// the given ID, exchanged with the given peer.
+func New(ctx context.Context, p peer.ID, requestID gsmsg.GraphSyncRequestID) context.Context {
+	return context.WithValue(ctx, requestKey{}, request{p, requestID})
+}
+
+// Peer returns the peer of the request the context was made for, if any
+func Peer(ctx context.Context) (peer.ID, bool) {
+	r, ok := ctx.Value(requestKey{}).(request)
+	return r.p, ok
+}
+
+// RequestID returns the ID of the request the context was made for, if any
+func RequestID(ctx context.Context) (gsmsg.GraphSyncRequestID, bool) {
+	r, ok := ctx.Value(requestKey{}).(request)
+	return r.requestID, ok
+}
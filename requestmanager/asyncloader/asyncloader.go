@@ -2,8 +2,8 @@ package asyncloader
 
 import (
 	"context"
-	"errors"
 	"io/ioutil"
+	"sync"
 
 	"github.com/ipfs/go-block-format"
 
@@ -13,10 +13,15 @@ import (
 	"github.com/ipfs/go-graphsync/requestmanager/asyncloader/loadattemptqueue"
 	"github.com/ipfs/go-graphsync/requestmanager/asyncloader/responsecache"
 	"github.com/ipfs/go-graphsync/requestmanager/asyncloader/unverifiedblockstore"
+	"github.com/ipfs/go-graphsync/requestmanager/requesterrors"
 	"github.com/ipfs/go-graphsync/requestmanager/types"
+	logging "github.com/ipfs/go-log"
 	"github.com/ipld/go-ipld-prime"
+	peer "github.com/libp2p/go-libp2p-peer"
 )
 
+var log = logging.Logger("graphsync")
+
 type loaderMessage interface {
 	handle(al *AsyncLoader)
 }
@@ -29,40 +34,104 @@ type AsyncLoader struct {
 	incomingMessages chan loaderMessage
 	outgoingMessages chan loaderMessage
 
-	activeRequests   map[gsmsg.GraphSyncRequestID]bool
-	loadAttemptQueue *loadattemptqueue.LoadAttemptQueue
-	responseCache    *responsecache.ResponseCache
+	activeRequests              map[gsmsg.GraphSyncRequestID]bool
+	loader                      ipldbridge.ContextLoader
+	storer                      ipldbridge.ContextStorer
+	unverifiedBlockStoreOptions []unverifiedblockstore.Option
+	unverifiedBlockMemory       *unverifiedblockstore.MemoryBudget
+	defaultQueue                *requestQueue
+
+	// requests with their own loader or storer are loaded on their own queue
+	requestQueuesLk sync.RWMutex
+	requestQueues   map[gsmsg.GraphSyncRequestID]*requestQueue
 }
 
-// New initializes a new link loading manager for asynchronous loads from the given context
-// and local store loading and storing function
-func New(ctx context.Context, loader ipld.Loader, storer ipld.Storer) *AsyncLoader {
-	unverifiedBlockStore := unverifiedblockstore.New(storer)
+// requestQueue loads links from the blocks in responses, falling back to a
+// local store, and holds loads to retry as new responses come in
+type requestQueue struct {
+	loadAttemptQueue     *loadattemptqueue.LoadAttemptQueue
+	responseCache        *responsecache.ResponseCache
+	unverifiedBlockStore *unverifiedblockstore.UnverifiedBlockStore
+}
+
+func newRequestQueue(loader ipldbridge.ContextLoader, storer ipldbridge.ContextStorer, options []unverifiedblockstore.Option) *requestQueue {
+	unverifiedBlockStore := unverifiedblockstore.New(storer, options...)
 	responseCache := responsecache.New(unverifiedBlockStore)
-	loadAttemptQueue := loadattemptqueue.New(func(requestID gsmsg.GraphSyncRequestID, link ipld.Link) ([]byte, error) {
+	loadAttemptQueue := loadattemptqueue.New(func(requestCtx context.Context, requestID gsmsg.GraphSyncRequestID, link ipld.Link, linkCtx ipldbridge.LinkContext) ([]byte, error) {
 		// load from response cache
-		data, err := responseCache.AttemptLoad(requestID, link)
+		data, err := responseCache.AttemptLoad(requestCtx, requestID, link, linkCtx)
 		if data == nil && err == nil {
 			// fall back to local store
-			stream, loadErr := loader(link, ipldbridge.LinkContext{})
+			stream, loadErr := loader(requestCtx, link, linkCtx)
 			if stream != nil && loadErr == nil {
 				localData, loadErr := ioutil.ReadAll(stream)
 				if loadErr == nil && localData != nil {
+					// the request will not verify a copy from the network
+					responseCache.RecordLocalLoad(requestID, link)
 					return localData, nil
 				}
 			}
 		}
 		return data, err
 	})
+	return &requestQueue{
+		loadAttemptQueue:     loadAttemptQueue,
+		responseCache:        responseCache,
+		unverifiedBlockStore: unverifiedBlockStore,
+	}
+}
+
+type asyncLoaderConfig struct {
+	maxUnverifiedBlockMemory    uint64
+	unverifiedBlockStoreOptions []unverifiedblockstore.Option
+}
+
+// Option configures an AsyncLoader
+type Option func(*asyncLoaderConfig)
+
+// MaxUnverifiedBlockMemory sets how many bytes of blocks received from each
+// peer are held in memory waiting for a traversal to load them before
+// ReserveUnverifiedBlockSpace blocks for that peer. Zero means no limit. The
+// limit for a peer is shared by all requests, including those with their own
+// loader or storer.
+func MaxUnverifiedBlockMemory(maxUnverifiedBlockMemory uint64) Option {
+	return func(alc *asyncLoaderConfig) {
+		alc.maxUnverifiedBlockMemory = maxUnverifiedBlockMemory
+	}
+}
+
+// SpillUnverifiedBlocksToDisk writes blocks received from the network that do
+// not fit in the memory set with MaxUnverifiedBlockMemory to a temporary file
+// in the given directory, instead of making ReserveUnverifiedBlockSpace wait.
+// An empty directory means the system temporary directory.
+func SpillUnverifiedBlocksToDisk(dir string) Option {
+	return func(alc *asyncLoaderConfig) {
+		alc.unverifiedBlockStoreOptions = append(alc.unverifiedBlockStoreOptions, unverifiedblockstore.SpillToDisk(dir))
+	}
+}
+
+// New initializes a new link loading manager for asynchronous loads from the given context
+// and local store loading and storing function
+func New(ctx context.Context, loader ipldbridge.ContextLoader, storer ipldbridge.ContextStorer, options ...Option) *AsyncLoader {
+	var config asyncLoaderConfig
+	for _, option := range options {
+		option(&config)
+	}
+	unverifiedBlockMemory := unverifiedblockstore.NewMemoryBudget(config.maxUnverifiedBlockMemory)
+	unverifiedBlockStoreOptions := append(config.unverifiedBlockStoreOptions, unverifiedblockstore.ShareMemoryBudget(unverifiedBlockMemory))
 	ctx, cancel := context.WithCancel(ctx)
 	return &AsyncLoader{
-		ctx:              ctx,
-		cancel:           cancel,
-		incomingMessages: make(chan loaderMessage),
-		outgoingMessages: make(chan loaderMessage),
-		activeRequests:   make(map[gsmsg.GraphSyncRequestID]bool),
-		responseCache:    responseCache,
-		loadAttemptQueue: loadAttemptQueue,
+		ctx:                         ctx,
+		cancel:                      cancel,
+		incomingMessages:            make(chan loaderMessage),
+		outgoingMessages:            make(chan loaderMessage),
+		activeRequests:              make(map[gsmsg.GraphSyncRequestID]bool),
+		loader:                      loader,
+		storer:                      storer,
+		unverifiedBlockStoreOptions: unverifiedBlockStoreOptions,
+		unverifiedBlockMemory:       unverifiedBlockMemory,
+		defaultQueue:                newRequestQueue(loader, storer, unverifiedBlockStoreOptions),
+		requestQueues:               make(map[gsmsg.GraphSyncRequestID]*requestQueue),
 	}
 }
 
@@ -72,39 +141,92 @@ func (al *AsyncLoader) Startup() {
 	go al.run()
 }
 
-// Shutdown finishes processing of messages
+// Shutdown finishes processing of messages and removes any blocks spilled to
+// disk
 func (al *AsyncLoader) Shutdown() {
 	al.cancel()
+	for _, queue := range al.allQueues() {
+		queue.close()
+	}
 }
 
 // StartRequest indicates the given request has started and the manager should
-// continually attempt to load links for this request as new responses come in
-func (al *AsyncLoader) StartRequest(requestID gsmsg.GraphSyncRequestID) {
+// continually attempt to load links for this request as new responses come in.
+// Loads for higher priority requests are retried first. If a loader or storer
+// is given, links for the request are loaded from and stored to them in place
+// of the local store; a nil loader or storer means the local store's.
+func (al *AsyncLoader) StartRequest(requestID gsmsg.GraphSyncRequestID, priority gsmsg.GraphSyncPriority,
+	loader ipldbridge.ContextLoader, storer ipldbridge.ContextStorer) {
+	if loader != nil || storer != nil {
+		if loader == nil {
+			loader = al.loader
+		}
+		if storer == nil {
+			storer = al.storer
+		}
+		// the queue is set up before returning, so responses that arrive
+		// before the request starts are still routed to it
+		al.requestQueuesLk.Lock()
+		al.requestQueues[requestID] = newRequestQueue(loader, storer, al.unverifiedBlockStoreOptions)
+		al.requestQueuesLk.Unlock()
+	}
 	select {
 	case <-al.ctx.Done():
-	case al.incomingMessages <- &startRequestMessage{requestID}:
+	case al.incomingMessages <- &startRequestMessage{requestID, priority}:
 	}
 }
 
-// ProcessResponse injests new responses and completes asynchronous loads as
-// neccesary
-func (al *AsyncLoader) ProcessResponse(responses map[gsmsg.GraphSyncRequestID]metadata.Metadata,
+// ProcessResponse injests new responses from the given peer and completes
+// asynchronous loads as neccesary
+func (al *AsyncLoader) ProcessResponse(p peer.ID, responses map[gsmsg.GraphSyncRequestID]metadata.Metadata,
 	blks []blocks.Block) {
-	al.responseCache.ProcessResponse(responses, blks)
+	// the default queue always takes the blocks, so memory reserved for them
+	// is released even when no request on it uses them
+	queueResponses := map[*requestQueue]map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		al.defaultQueue: make(map[gsmsg.GraphSyncRequestID]metadata.Metadata),
+	}
+	for requestID, md := range responses {
+		queue := al.queueFor(requestID)
+		if _, ok := queueResponses[queue]; !ok {
+			queueResponses[queue] = make(map[gsmsg.GraphSyncRequestID]metadata.Metadata)
+		}
+		queueResponses[queue][requestID] = md
+	}
+	for queue, responses := range queueResponses {
+		queue.responseCache.ProcessResponse(p, responses, blks)
+	}
 	select {
 	case <-al.ctx.Done():
 	case al.incomingMessages <- &newResponsesAvailableMessage{}:
 	}
 }
 
+// UnverifiedBlockMemory returns how many bytes of blocks received from the
+// network are held in memory waiting for a traversal to load them, across
+// all peers and requests
+func (al *AsyncLoader) UnverifiedBlockMemory() uint64 {
+	return al.unverifiedBlockMemory.Size()
+}
+
+// ReserveUnverifiedBlockSpace blocks while the blocks from the given peer held
+// waiting for a traversal take up the maximum memory allowed, then sets aside
+// memory for blocks of the given size from the peer. It returns an error if
+// the loader shuts down first. Callers reserve space for the blocks in
+// responses before processing them, so that blocks are not read from a peer
+// faster than traversals use them, while other peers are not held up.
+func (al *AsyncLoader) ReserveUnverifiedBlockSpace(p peer.ID, size uint64) error {
+	return al.defaultQueue.unverifiedBlockStore.ReserveSpace(al.ctx, p, size)
+}
+
 // AsyncLoad asynchronously loads the given link for the given request ID. It returns a channel for data and a channel
-// for errors -- only one message will be sent over either.
-func (al *AsyncLoader) AsyncLoad(requestID gsmsg.GraphSyncRequestID, link ipld.Link) <-chan types.AsyncLoadResult {
+// for errors -- only one message will be sent over either. The request context and link context are passed to the
+// local loader and storer.
+func (al *AsyncLoader) AsyncLoad(requestCtx context.Context, requestID gsmsg.GraphSyncRequestID, link ipld.Link, linkCtx ipldbridge.LinkContext) <-chan types.AsyncLoadResult {
 	resultChan := make(chan types.AsyncLoadResult, 1)
-	lr := loadattemptqueue.NewLoadRequest(requestID, link, resultChan)
+	lr := loadattemptqueue.NewLoadRequest(requestCtx, requestID, link, linkCtx, resultChan)
 	select {
 	case <-al.ctx.Done():
-		resultChan <- types.AsyncLoadResult{Data: nil, Err: errors.New("Context closed")}
+		resultChan <- types.AsyncLoadResult{Data: nil, Err: requesterrors.ErrShutdown}
 		close(resultChan)
 	case al.incomingMessages <- &loadRequestMessage{requestID, lr}:
 	}
@@ -125,7 +247,43 @@ func (al *AsyncLoader) CompleteResponsesFor(requestID gsmsg.GraphSyncRequestID)
 // and no further attempts will be made to load links for this request,
 // so any cached response data is invalid can be cleaned
 func (al *AsyncLoader) CleanupRequest(requestID gsmsg.GraphSyncRequestID) {
-	al.responseCache.FinishRequest(requestID)
+	al.requestQueuesLk.Lock()
+	queue, ok := al.requestQueues[requestID]
+	delete(al.requestQueues, requestID)
+	al.requestQueuesLk.Unlock()
+	if !ok {
+		al.defaultQueue.responseCache.FinishRequest(requestID)
+		return
+	}
+	queue.responseCache.FinishRequest(requestID)
+	queue.close()
+}
+
+func (al *AsyncLoader) queueFor(requestID gsmsg.GraphSyncRequestID) *requestQueue {
+	al.requestQueuesLk.RLock()
+	defer al.requestQueuesLk.RUnlock()
+	queue, ok := al.requestQueues[requestID]
+	if !ok {
+		return al.defaultQueue
+	}
+	return queue
+}
+
+func (al *AsyncLoader) allQueues() []*requestQueue {
+	al.requestQueuesLk.RLock()
+	defer al.requestQueuesLk.RUnlock()
+	queues := make([]*requestQueue, 0, len(al.requestQueues)+1)
+	queues = append(queues, al.defaultQueue)
+	for _, queue := range al.requestQueues {
+		queues = append(queues, queue)
+	}
+	return queues
+}
+
+func (rq *requestQueue) close() {
+	if err := rq.unverifiedBlockStore.Close(); err != nil {
+		log.Warningf("Unable to remove unverified blocks spilled to disk: %s", err)
+	}
 }
 
 type loadRequestMessage struct {
@@ -138,6 +296,7 @@ type newResponsesAvailableMessage struct {
 
 type startRequestMessage struct {
 	requestID gsmsg.GraphSyncRequestID
+	priority  gsmsg.GraphSyncPriority
 }
 
 type finishRequestMessage struct {
@@ -183,18 +342,21 @@ func (al *AsyncLoader) messageQueueWorker() {
 
 func (lrm *loadRequestMessage) handle(al *AsyncLoader) {
 	retry := al.activeRequests[lrm.requestID]
-	al.loadAttemptQueue.AttemptLoad(lrm.loadRequest, retry)
+	al.queueFor(lrm.requestID).loadAttemptQueue.AttemptLoad(lrm.loadRequest, retry)
 }
 
 func (srm *startRequestMessage) handle(al *AsyncLoader) {
 	al.activeRequests[srm.requestID] = true
+	al.queueFor(srm.requestID).loadAttemptQueue.SetPriority(srm.requestID, srm.priority)
 }
 
 func (frm *finishRequestMessage) handle(al *AsyncLoader) {
 	delete(al.activeRequests, frm.requestID)
-	al.loadAttemptQueue.ClearRequest(frm.requestID)
+	al.queueFor(frm.requestID).loadAttemptQueue.ClearRequest(frm.requestID)
 }
 
 func (nram *newResponsesAvailableMessage) handle(al *AsyncLoader) {
-	al.loadAttemptQueue.RetryLoads()
+	for _, queue := range al.allQueues() {
+		queue.loadAttemptQueue.RetryLoads()
+	}
 }
@@ -8,11 +8,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-graphsync/ipldbridge"
 	"github.com/ipfs/go-graphsync/metadata"
 	"github.com/ipld/go-ipld-prime/linking/cid"
 
 	gsmsg "github.com/ipfs/go-graphsync/message"
+	"github.com/ipfs/go-graphsync/requestcontext"
+	"github.com/ipfs/go-graphsync/requestmanager/types"
 	"github.com/ipfs/go-graphsync/testbridge"
 	"github.com/ipfs/go-graphsync/testutil"
 	ipld "github.com/ipld/go-ipld-prime"
@@ -42,11 +45,11 @@ func TestAsyncLoadInitialLoadSucceedsLocallyPresent(t *testing.T) {
 		return loader(link, linkContext)
 	}
 
-	asyncLoader := New(ctx, wrappedLoader, storer)
+	asyncLoader := New(ctx, ipldbridge.LoaderWithContext(wrappedLoader), ipldbridge.StorerWithContext(storer))
 	asyncLoader.Startup()
 
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
-	resultChan := asyncLoader.AsyncLoad(requestID, link)
+	resultChan := asyncLoader.AsyncLoad(ctx, requestID, link, ipldbridge.LinkContext{})
 
 	select {
 	case result := <-resultChan:
@@ -66,6 +69,7 @@ func TestAsyncLoadInitialLoadSucceedsLocallyPresent(t *testing.T) {
 }
 
 func TestAsyncLoadInitialLoadSucceedsResponsePresent(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
 	ctx := context.Background()
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
 	defer cancel()
@@ -82,7 +86,7 @@ func TestAsyncLoadInitialLoadSucceedsResponsePresent(t *testing.T) {
 		return loader(link, linkContext)
 	}
 
-	asyncLoader := New(ctx, wrappedLoader, storer)
+	asyncLoader := New(ctx, ipldbridge.LoaderWithContext(wrappedLoader), ipldbridge.StorerWithContext(storer))
 	asyncLoader.Startup()
 
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
@@ -94,8 +98,8 @@ func TestAsyncLoadInitialLoadSucceedsResponsePresent(t *testing.T) {
 			},
 		},
 	}
-	asyncLoader.ProcessResponse(responses, blocks)
-	resultChan := asyncLoader.AsyncLoad(requestID, link)
+	asyncLoader.ProcessResponse(p, responses, blocks)
+	resultChan := asyncLoader.AsyncLoad(ctx, requestID, link, ipldbridge.LinkContext{})
 
 	select {
 	case result := <-resultChan:
@@ -119,6 +123,7 @@ func TestAsyncLoadInitialLoadSucceedsResponsePresent(t *testing.T) {
 }
 
 func TestAsyncLoadInitialLoadFails(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
 	ctx := context.Background()
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
 	defer cancel()
@@ -131,7 +136,7 @@ func TestAsyncLoadInitialLoadFails(t *testing.T) {
 		return loader(link, linkContext)
 	}
 
-	asyncLoader := New(ctx, wrappedLoader, storer)
+	asyncLoader := New(ctx, ipldbridge.LoaderWithContext(wrappedLoader), ipldbridge.StorerWithContext(storer))
 	asyncLoader.Startup()
 
 	link := testbridge.NewMockLink()
@@ -145,9 +150,9 @@ func TestAsyncLoadInitialLoadFails(t *testing.T) {
 			},
 		},
 	}
-	asyncLoader.ProcessResponse(responses, nil)
+	asyncLoader.ProcessResponse(p, responses, nil)
 
-	resultChan := asyncLoader.AsyncLoad(requestID, link)
+	resultChan := asyncLoader.AsyncLoad(ctx, requestID, link, ipldbridge.LinkContext{})
 
 	select {
 	case result := <-resultChan:
@@ -179,12 +184,12 @@ func TestAsyncLoadInitialLoadIndeterminateWhenRequestNotInProgress(t *testing.T)
 		return loader(link, linkContext)
 	}
 
-	asyncLoader := New(ctx, wrappedLoader, storer)
+	asyncLoader := New(ctx, ipldbridge.LoaderWithContext(wrappedLoader), ipldbridge.StorerWithContext(storer))
 	asyncLoader.Startup()
 
 	link := testbridge.NewMockLink()
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
-	resultChan := asyncLoader.AsyncLoad(requestID, link)
+	resultChan := asyncLoader.AsyncLoad(ctx, requestID, link, ipldbridge.LinkContext{})
 
 	select {
 	case result := <-resultChan:
@@ -204,6 +209,7 @@ func TestAsyncLoadInitialLoadIndeterminateWhenRequestNotInProgress(t *testing.T)
 }
 
 func TestAsyncLoadInitialLoadIndeterminateThenSucceeds(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
 	ctx := context.Background()
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
 	defer cancel()
@@ -221,12 +227,12 @@ func TestAsyncLoadInitialLoadIndeterminateThenSucceeds(t *testing.T) {
 		return loader(link, linkContext)
 	}
 
-	asyncLoader := New(ctx, wrappedLoader, storer)
+	asyncLoader := New(ctx, ipldbridge.LoaderWithContext(wrappedLoader), ipldbridge.StorerWithContext(storer))
 	asyncLoader.Startup()
 
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
-	asyncLoader.StartRequest(requestID)
-	resultChan := asyncLoader.AsyncLoad(requestID, link)
+	asyncLoader.StartRequest(requestID, gsmsg.GraphSyncPriority(0), nil, nil)
+	resultChan := asyncLoader.AsyncLoad(ctx, requestID, link, ipldbridge.LinkContext{})
 
 	select {
 	case <-called:
@@ -244,7 +250,7 @@ func TestAsyncLoadInitialLoadIndeterminateThenSucceeds(t *testing.T) {
 			},
 		},
 	}
-	asyncLoader.ProcessResponse(responses, blocks)
+	asyncLoader.ProcessResponse(p, responses, blocks)
 
 	select {
 	case result := <-resultChan:
@@ -268,6 +274,7 @@ func TestAsyncLoadInitialLoadIndeterminateThenSucceeds(t *testing.T) {
 }
 
 func TestAsyncLoadInitialLoadIndeterminateThenFails(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
 	ctx := context.Background()
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
 	defer cancel()
@@ -283,12 +290,12 @@ func TestAsyncLoadInitialLoadIndeterminateThenFails(t *testing.T) {
 		return loader(link, linkContext)
 	}
 
-	asyncLoader := New(ctx, wrappedLoader, storer)
+	asyncLoader := New(ctx, ipldbridge.LoaderWithContext(wrappedLoader), ipldbridge.StorerWithContext(storer))
 	asyncLoader.Startup()
 
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
-	asyncLoader.StartRequest(requestID)
-	resultChan := asyncLoader.AsyncLoad(requestID, link)
+	asyncLoader.StartRequest(requestID, gsmsg.GraphSyncPriority(0), nil, nil)
+	resultChan := asyncLoader.AsyncLoad(ctx, requestID, link, ipldbridge.LinkContext{})
 
 	select {
 	case <-called:
@@ -305,7 +312,7 @@ func TestAsyncLoadInitialLoadIndeterminateThenFails(t *testing.T) {
 			},
 		},
 	}
-	asyncLoader.ProcessResponse(responses, nil)
+	asyncLoader.ProcessResponse(p, responses, nil)
 
 	select {
 	case result := <-resultChan:
@@ -340,12 +347,12 @@ func TestAsyncLoadInitialLoadIndeterminateThenRequestFinishes(t *testing.T) {
 		return loader(link, linkContext)
 	}
 
-	asyncLoader := New(ctx, wrappedLoader, storer)
+	asyncLoader := New(ctx, ipldbridge.LoaderWithContext(wrappedLoader), ipldbridge.StorerWithContext(storer))
 	asyncLoader.Startup()
 
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
-	asyncLoader.StartRequest(requestID)
-	resultChan := asyncLoader.AsyncLoad(requestID, link)
+	asyncLoader.StartRequest(requestID, gsmsg.GraphSyncPriority(0), nil, nil)
+	resultChan := asyncLoader.AsyncLoad(ctx, requestID, link, ipldbridge.LinkContext{})
 
 	select {
 	case <-called:
@@ -374,6 +381,7 @@ func TestAsyncLoadInitialLoadIndeterminateThenRequestFinishes(t *testing.T) {
 }
 
 func TestAsyncLoadTwiceLoadsLocallySecondTime(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
 	ctx := context.Background()
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
 	defer cancel()
@@ -390,7 +398,7 @@ func TestAsyncLoadTwiceLoadsLocallySecondTime(t *testing.T) {
 		return loader(link, linkContext)
 	}
 
-	asyncLoader := New(ctx, wrappedLoader, storer)
+	asyncLoader := New(ctx, ipldbridge.LoaderWithContext(wrappedLoader), ipldbridge.StorerWithContext(storer))
 	asyncLoader.Startup()
 
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
@@ -402,8 +410,8 @@ func TestAsyncLoadTwiceLoadsLocallySecondTime(t *testing.T) {
 			},
 		},
 	}
-	asyncLoader.ProcessResponse(responses, blocks)
-	resultChan := asyncLoader.AsyncLoad(requestID, link)
+	asyncLoader.ProcessResponse(p, responses, blocks)
+	resultChan := asyncLoader.AsyncLoad(ctx, requestID, link, ipldbridge.LinkContext{})
 
 	select {
 	case result := <-resultChan:
@@ -425,7 +433,7 @@ func TestAsyncLoadTwiceLoadsLocallySecondTime(t *testing.T) {
 		t.Fatal("should have stored block but didn't")
 	}
 
-	resultChan = asyncLoader.AsyncLoad(requestID, link)
+	resultChan = asyncLoader.AsyncLoad(ctx, requestID, link, ipldbridge.LinkContext{})
 
 	select {
 	case result := <-resultChan:
@@ -447,3 +455,318 @@ func TestAsyncLoadTwiceLoadsLocallySecondTime(t *testing.T) {
 		t.Fatal("should have stored block but didn't")
 	}
 }
+
+func TestAsyncLoadPassesRequestAndLinkContexts(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	blockStore := make(map[ipld.Link][]byte)
+	loader, storer := testbridge.NewMockStore(blockStore)
+	blocks := testutil.GenerateBlocksOfSize(2, 100)
+	localLink := cidlink.Link{Cid: blocks[0].Cid()}
+	blockStore[localLink] = blocks[0].RawData()
+	remoteLink := cidlink.Link{Cid: blocks[1].Cid()}
+
+	p := testutil.GeneratePeers(1)[0]
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	requestCtx := requestcontext.New(ctx, p, requestID)
+	linkCtx := ipldbridge.LinkContext{LinkPath: ipld.ParsePath("Links/0/Hash")}
+
+	var loadedCtx, storedCtx context.Context
+	var loadedLinkCtx, storedLinkCtx ipldbridge.LinkContext
+	contextLoader := func(ctx context.Context, link ipld.Link, linkContext ipldbridge.LinkContext) (io.Reader, error) {
+		if link == localLink {
+			loadedCtx, loadedLinkCtx = ctx, linkContext
+		}
+		return loader(link, linkContext)
+	}
+	contextStorer := func(ctx context.Context, linkContext ipldbridge.LinkContext) (io.Writer, ipldbridge.StoreCommitter, error) {
+		storedCtx, storedLinkCtx = ctx, linkContext
+		return storer(linkContext)
+	}
+
+	asyncLoader := New(ctx, contextLoader, contextStorer)
+	asyncLoader.Startup()
+
+	responses := map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		requestID: metadata.Metadata{
+			metadata.Item{
+				Link:         remoteLink,
+				BlockPresent: true,
+			},
+		},
+	}
+	asyncLoader.ProcessResponse(p, responses, blocks[1:])
+	for _, link := range []ipld.Link{localLink, remoteLink} {
+		select {
+		case result := <-asyncLoader.AsyncLoad(requestCtx, requestID, link, linkCtx):
+			if result.Err != nil {
+				t.Fatal("should not have sent an error")
+			}
+		case <-ctx.Done():
+			t.Fatal("should have closed response channel")
+		}
+	}
+
+	for _, receivedCtx := range []context.Context{loadedCtx, storedCtx} {
+		receivedPeer, ok := requestcontext.Peer(receivedCtx)
+		if !ok || receivedPeer != p {
+			t.Fatal("should pass request context with peer")
+		}
+		receivedRequestID, ok := requestcontext.RequestID(receivedCtx)
+		if !ok || receivedRequestID != requestID {
+			t.Fatal("should pass request context with request ID")
+		}
+	}
+	if loadedLinkCtx.LinkPath.String() != linkCtx.LinkPath.String() ||
+		storedLinkCtx.LinkPath.String() != linkCtx.LinkPath.String() {
+		t.Fatal("should pass link context")
+	}
+}
+
+func TestAsyncLoadWithRequestLoaderAndStorer(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	blockStore := make(map[ipld.Link][]byte)
+	loader, storer := testbridge.NewMockStore(blockStore)
+	stagingStore := make(map[ipld.Link][]byte)
+	stagingLoader, stagingStorer := testbridge.NewMockStore(stagingStore)
+	blocks := testutil.GenerateBlocksOfSize(2, 100)
+	sharedLink := cidlink.Link{Cid: blocks[0].Cid()}
+	stagedLink := cidlink.Link{Cid: blocks[1].Cid()}
+	stagingStore[stagedLink] = blocks[1].RawData()
+
+	asyncLoader := New(ctx, ipldbridge.LoaderWithContext(loader), ipldbridge.StorerWithContext(storer))
+	asyncLoader.Startup()
+
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	stagingRequestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	asyncLoader.StartRequest(requestID, gsmsg.GraphSyncPriority(0), nil, nil)
+	asyncLoader.StartRequest(stagingRequestID, gsmsg.GraphSyncPriority(0),
+		ipldbridge.LoaderWithContext(stagingLoader), ipldbridge.StorerWithContext(stagingStorer))
+
+	md := metadata.Metadata{
+		metadata.Item{
+			Link:         sharedLink,
+			BlockPresent: true,
+		},
+	}
+	responses := map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		requestID:        md,
+		stagingRequestID: md,
+	}
+	asyncLoader.ProcessResponse(p, responses, blocks[:1])
+
+	loadLink := func(requestID gsmsg.GraphSyncRequestID, link ipld.Link) types.AsyncLoadResult {
+		select {
+		case result := <-asyncLoader.AsyncLoad(ctx, requestID, link, ipldbridge.LinkContext{}):
+			return result
+		case <-ctx.Done():
+			t.Fatal("should have closed response channel")
+		}
+		return types.AsyncLoadResult{}
+	}
+
+	result := loadLink(stagingRequestID, sharedLink)
+	if result.Err != nil || !reflect.DeepEqual(result.Data, blocks[0].RawData()) {
+		t.Fatal("should load block from response for request with its own store")
+	}
+	if _, ok := stagingStore[sharedLink]; !ok {
+		t.Fatal("should store block with the request's storer")
+	}
+	if _, ok := blockStore[sharedLink]; ok {
+		t.Fatal("should not store block for request with its own store in local store")
+	}
+
+	result = loadLink(requestID, sharedLink)
+	if result.Err != nil || !reflect.DeepEqual(result.Data, blocks[0].RawData()) {
+		t.Fatal("should load block from response for request using local store")
+	}
+	if _, ok := blockStore[sharedLink]; !ok {
+		t.Fatal("should store block in local store")
+	}
+
+	result = loadLink(stagingRequestID, stagedLink)
+	if result.Err != nil || !reflect.DeepEqual(result.Data, blocks[1].RawData()) {
+		t.Fatal("should fall back to the request's loader")
+	}
+
+	asyncLoader.CompleteResponsesFor(stagingRequestID)
+	asyncLoader.CleanupRequest(stagingRequestID)
+	asyncLoader.CompleteResponsesFor(requestID)
+	result = loadLink(requestID, stagedLink)
+	if result.Err == nil {
+		t.Fatal("should not fall back to another request's loader")
+	}
+}
+
+func TestUnverifiedBlockMemoryIncludesRequestQueues(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blockStore := make(map[ipld.Link][]byte)
+	loader, storer := testbridge.NewMockStore(blockStore)
+	stagingStore := make(map[ipld.Link][]byte)
+	stagingLoader, stagingStorer := testbridge.NewMockStore(stagingStore)
+	blocks := testutil.GenerateBlocksOfSize(1, 100)
+	link := cidlink.Link{Cid: blocks[0].Cid()}
+
+	asyncLoader := New(ctx, ipldbridge.LoaderWithContext(loader), ipldbridge.StorerWithContext(storer),
+		MaxUnverifiedBlockMemory(100))
+	asyncLoader.Startup()
+
+	stagingRequestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	asyncLoader.StartRequest(stagingRequestID, gsmsg.GraphSyncPriority(0),
+		ipldbridge.LoaderWithContext(stagingLoader), ipldbridge.StorerWithContext(stagingStorer))
+
+	err := asyncLoader.ReserveUnverifiedBlockSpace(p, 100)
+	if err != nil {
+		t.Fatal("should reserve space for blocks")
+	}
+	responses := map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		stagingRequestID: metadata.Metadata{
+			metadata.Item{
+				Link:         link,
+				BlockPresent: true,
+			},
+		},
+	}
+	asyncLoader.ProcessResponse(p, responses, blocks)
+	if asyncLoader.UnverifiedBlockMemory() != 100 {
+		t.Fatal("should count blocks held for request with its own store")
+	}
+
+	reserved := make(chan error, 1)
+	go func() {
+		reserved <- asyncLoader.ReserveUnverifiedBlockSpace(p, 100)
+	}()
+	select {
+	case <-reserved:
+		t.Fatal("should not reserve space while blocks for request with its own store use it up")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	asyncLoader.CompleteResponsesFor(stagingRequestID)
+	asyncLoader.CleanupRequest(stagingRequestID)
+	select {
+	case err := <-reserved:
+		if err != nil {
+			t.Fatal("should reserve space without error")
+		}
+	case <-ctx.Done():
+		t.Fatal("should reserve space once request with its own store is cleaned up")
+	}
+}
+
+func TestLocallyLoadedBlocksDoNotHoldUnverifiedBlockMemory(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blockStore := make(map[ipld.Link][]byte)
+	loader, storer := testbridge.NewMockStore(blockStore)
+	blks := testutil.GenerateBlocksOfSize(5, 100)
+	for _, block := range blks {
+		blockStore[cidlink.Link{Cid: block.Cid()}] = block.RawData()
+	}
+
+	asyncLoader := New(ctx, ipldbridge.LoaderWithContext(loader), ipldbridge.StorerWithContext(storer),
+		MaxUnverifiedBlockMemory(100))
+	asyncLoader.Startup()
+
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	asyncLoader.StartRequest(requestID, gsmsg.GraphSyncPriority(0), nil, nil)
+
+	for _, block := range blks {
+		link := cidlink.Link{Cid: block.Cid()}
+		resultChan := asyncLoader.AsyncLoad(ctx, requestID, link, ipldbridge.LinkContext{})
+		select {
+		case result := <-resultChan:
+			if result.Data == nil || result.Err != nil {
+				t.Fatal("should load block from local store")
+			}
+		case <-ctx.Done():
+			t.Fatal("should have closed response channel")
+		}
+
+		reserved := make(chan error, 1)
+		go func() {
+			reserved <- asyncLoader.ReserveUnverifiedBlockSpace(p, 100)
+		}()
+		select {
+		case err := <-reserved:
+			if err != nil {
+				t.Fatal("should reserve space without error")
+			}
+		case <-ctx.Done():
+			t.Fatal("should not wait on copies of blocks already loaded locally")
+		}
+		responses := map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+			requestID: metadata.Metadata{
+				metadata.Item{
+					Link:         link,
+					BlockPresent: true,
+				},
+			},
+		}
+		asyncLoader.ProcessResponse(p, responses, []blocks.Block{block})
+		if asyncLoader.UnverifiedBlockMemory() != 0 {
+			t.Fatal("should drop copy from the network of block loaded locally")
+		}
+	}
+}
+
+func TestUnverifiedBlockMemoryLimitedPerPeer(t *testing.T) {
+	peers := testutil.GeneratePeers(2)
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blockStore := make(map[ipld.Link][]byte)
+	loader, storer := testbridge.NewMockStore(blockStore)
+	blks := testutil.GenerateBlocksOfSize(1, 100)
+
+	asyncLoader := New(ctx, ipldbridge.LoaderWithContext(loader), ipldbridge.StorerWithContext(storer),
+		MaxUnverifiedBlockMemory(100))
+	asyncLoader.Startup()
+
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	asyncLoader.StartRequest(requestID, gsmsg.GraphSyncPriority(0), nil, nil)
+	err := asyncLoader.ReserveUnverifiedBlockSpace(peers[0], 100)
+	if err != nil {
+		t.Fatal("should reserve space for blocks")
+	}
+	responses := map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		requestID: metadata.Metadata{
+			metadata.Item{
+				Link:         cidlink.Link{Cid: blks[0].Cid()},
+				BlockPresent: true,
+			},
+		},
+	}
+	asyncLoader.ProcessResponse(peers[0], responses, blks)
+
+	reserved := make(chan error, 1)
+	go func() {
+		reserved <- asyncLoader.ReserveUnverifiedBlockSpace(peers[1], 100)
+	}()
+	select {
+	case err := <-reserved:
+		if err != nil {
+			t.Fatal("should reserve space without error")
+		}
+	case <-ctx.Done():
+		t.Fatal("should not hold up a peer while another peer's blocks use up its memory")
+	}
+
+	go func() {
+		reserved <- asyncLoader.ReserveUnverifiedBlockSpace(peers[0], 100)
+	}()
+	select {
+	case <-reserved:
+		t.Fatal("should not reserve space while the peer's blocks use up its memory")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
@@ -1,9 +1,12 @@
 package loadattemptqueue
 
 import (
-	"errors"
+	"context"
+	"sort"
 
+	"github.com/ipfs/go-graphsync/ipldbridge"
 	gsmsg "github.com/ipfs/go-graphsync/message"
+	"github.com/ipfs/go-graphsync/requestmanager/requesterrors"
 	"github.com/ipfs/go-graphsync/requestmanager/types"
 	"github.com/ipld/go-ipld-prime"
 )
@@ -11,17 +14,21 @@ import (
 // LoadRequest is a request to load the given link for the given request id,
 // with results returned to the given channel
 type LoadRequest struct {
+	ctx        context.Context
 	requestID  gsmsg.GraphSyncRequestID
 	link       ipld.Link
+	linkCtx    ipldbridge.LinkContext
 	resultChan chan types.AsyncLoadResult
 }
 
-// NewLoadRequest returns a new LoadRequest for the given request id, link,
-// and results channel
-func NewLoadRequest(requestID gsmsg.GraphSyncRequestID,
+// NewLoadRequest returns a new LoadRequest for the given request context,
+// request id, link, link context and results channel
+func NewLoadRequest(ctx context.Context,
+	requestID gsmsg.GraphSyncRequestID,
 	link ipld.Link,
+	linkCtx ipldbridge.LinkContext,
 	resultChan chan types.AsyncLoadResult) LoadRequest {
-	return LoadRequest{requestID, link, resultChan}
+	return LoadRequest{ctx, requestID, link, linkCtx, resultChan}
 }
 
 // LoadAttempter attempts to load a link to an array of bytes
@@ -29,26 +36,34 @@ func NewLoadRequest(requestID gsmsg.GraphSyncRequestID,
 // bytes present, error nil = success
 // bytes nil, error present = error
 // bytes nil, error nil = did not load, but try again later
-type LoadAttempter func(gsmsg.GraphSyncRequestID, ipld.Link) ([]byte, error)
+type LoadAttempter func(context.Context, gsmsg.GraphSyncRequestID, ipld.Link, ipldbridge.LinkContext) ([]byte, error)
 
 // LoadAttemptQueue attempts to load using the load attempter, and then can
 // place requests on a retry queue
 type LoadAttemptQueue struct {
 	loadAttempter  LoadAttempter
 	pausedRequests []LoadRequest
+	priorities     map[gsmsg.GraphSyncRequestID]gsmsg.GraphSyncPriority
 }
 
 // New initializes a new AsyncLoader from loadAttempter function
 func New(loadAttempter LoadAttempter) *LoadAttemptQueue {
 	return &LoadAttemptQueue{
 		loadAttempter: loadAttempter,
+		priorities:    make(map[gsmsg.GraphSyncRequestID]gsmsg.GraphSyncPriority),
 	}
 }
 
+// SetPriority sets the priority of the given request. Saved load requests for
+// higher priority requests are retried first.
+func (laq *LoadAttemptQueue) SetPriority(requestID gsmsg.GraphSyncRequestID, priority gsmsg.GraphSyncPriority) {
+	laq.priorities[requestID] = priority
+}
+
 // AttemptLoad attempts to loads the given load request, and if retry is true
 // it saves the loadrequest for retrying later
 func (laq *LoadAttemptQueue) AttemptLoad(lr LoadRequest, retry bool) {
-	response, err := laq.loadAttempter(lr.requestID, lr.link)
+	response, err := laq.loadAttempter(lr.ctx, lr.requestID, lr.link, lr.linkCtx)
 	if err != nil {
 		lr.resultChan <- types.AsyncLoadResult{Data: nil, Err: err}
 		close(lr.resultChan)
@@ -60,7 +75,7 @@ func (laq *LoadAttemptQueue) AttemptLoad(lr LoadRequest, retry bool) {
 		return
 	}
 	if !retry {
-		laq.terminateWithError("No active request", lr.resultChan)
+		laq.terminateWithError(lr)
 		return
 	}
 	laq.pausedRequests = append(laq.pausedRequests, lr)
@@ -69,11 +84,12 @@ func (laq *LoadAttemptQueue) AttemptLoad(lr LoadRequest, retry bool) {
 // ClearRequest purges the given request from the queue of load requests
 // to retry
 func (laq *LoadAttemptQueue) ClearRequest(requestID gsmsg.GraphSyncRequestID) {
+	delete(laq.priorities, requestID)
 	pausedRequests := laq.pausedRequests
 	laq.pausedRequests = nil
 	for _, lr := range pausedRequests {
 		if lr.requestID == requestID {
-			laq.terminateWithError("No active request", lr.resultChan)
+			laq.terminateWithError(lr)
 		} else {
 			laq.pausedRequests = append(laq.pausedRequests, lr)
 		}
@@ -86,12 +102,15 @@ func (laq *LoadAttemptQueue) RetryLoads() {
 	// drain buffered
 	pausedRequests := laq.pausedRequests
 	laq.pausedRequests = nil
+	sort.SliceStable(pausedRequests, func(i, j int) bool {
+		return laq.priorities[pausedRequests[i].requestID] > laq.priorities[pausedRequests[j].requestID]
+	})
 	for _, lr := range pausedRequests {
 		laq.AttemptLoad(lr, true)
 	}
 }
 
-func (laq *LoadAttemptQueue) terminateWithError(errMsg string, resultChan chan<- types.AsyncLoadResult) {
-	resultChan <- types.AsyncLoadResult{Data: nil, Err: errors.New(errMsg)}
-	close(resultChan)
+func (laq *LoadAttemptQueue) terminateWithError(lr LoadRequest) {
+	lr.resultChan <- types.AsyncLoadResult{Data: nil, Err: requesterrors.NoActiveRequestError{RequestID: lr.requestID, Link: lr.link}}
+	close(lr.resultChan)
 }
@@ -7,7 +7,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ipfs/go-graphsync/ipldbridge"
 	gsmsg "github.com/ipfs/go-graphsync/message"
+	"github.com/ipfs/go-graphsync/requestmanager/requesterrors"
 	"github.com/ipfs/go-graphsync/requestmanager/types"
 	"github.com/ipfs/go-graphsync/testbridge"
 	"github.com/ipfs/go-graphsync/testutil"
@@ -19,7 +21,7 @@ func TestAsyncLoadInitialLoadSucceeds(t *testing.T) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
 	defer cancel()
 	callCount := 0
-	loadAttempter := func(gsmsg.GraphSyncRequestID, ipld.Link) ([]byte, error) {
+	loadAttempter := func(context.Context, gsmsg.GraphSyncRequestID, ipld.Link, ipldbridge.LinkContext) ([]byte, error) {
 		callCount++
 		return testutil.RandomBytes(100), nil
 	}
@@ -29,7 +31,7 @@ func TestAsyncLoadInitialLoadSucceeds(t *testing.T) {
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
 
 	resultChan := make(chan types.AsyncLoadResult, 1)
-	lr := NewLoadRequest(requestID, link, resultChan)
+	lr := NewLoadRequest(ctx, requestID, link, ipldbridge.LinkContext{}, resultChan)
 	loadAttemptQueue.AttemptLoad(lr, false)
 
 	select {
@@ -54,7 +56,7 @@ func TestAsyncLoadInitialLoadFails(t *testing.T) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
 	defer cancel()
 	callCount := 0
-	loadAttempter := func(gsmsg.GraphSyncRequestID, ipld.Link) ([]byte, error) {
+	loadAttempter := func(context.Context, gsmsg.GraphSyncRequestID, ipld.Link, ipldbridge.LinkContext) ([]byte, error) {
 		callCount++
 		return nil, fmt.Errorf("something went wrong")
 	}
@@ -63,7 +65,7 @@ func TestAsyncLoadInitialLoadFails(t *testing.T) {
 	link := testbridge.NewMockLink()
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
 	resultChan := make(chan types.AsyncLoadResult, 1)
-	lr := NewLoadRequest(requestID, link, resultChan)
+	lr := NewLoadRequest(ctx, requestID, link, ipldbridge.LinkContext{}, resultChan)
 	loadAttemptQueue.AttemptLoad(lr, false)
 
 	select {
@@ -89,7 +91,7 @@ func TestAsyncLoadInitialLoadIndeterminateRetryFalse(t *testing.T) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
 	defer cancel()
 	callCount := 0
-	loadAttempter := func(gsmsg.GraphSyncRequestID, ipld.Link) ([]byte, error) {
+	loadAttempter := func(context.Context, gsmsg.GraphSyncRequestID, ipld.Link, ipldbridge.LinkContext) ([]byte, error) {
 		var result []byte
 		if callCount > 0 {
 			result = testutil.RandomBytes(100)
@@ -103,7 +105,7 @@ func TestAsyncLoadInitialLoadIndeterminateRetryFalse(t *testing.T) {
 	link := testbridge.NewMockLink()
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
 	resultChan := make(chan types.AsyncLoadResult, 1)
-	lr := NewLoadRequest(requestID, link, resultChan)
+	lr := NewLoadRequest(ctx, requestID, link, ipldbridge.LinkContext{}, resultChan)
 	loadAttemptQueue.AttemptLoad(lr, false)
 
 	select {
@@ -115,6 +117,9 @@ func TestAsyncLoadInitialLoadIndeterminateRetryFalse(t *testing.T) {
 			t.Fatal("should have sent an error")
 
 		}
+		if _, ok := result.Err.(requesterrors.NoActiveRequestError); !ok {
+			t.Fatal("should have sent no active request error")
+		}
 	case <-ctx.Done():
 		t.Fatal("should have produced result")
 	}
@@ -130,7 +135,7 @@ func TestAsyncLoadInitialLoadIndeterminateRetryTrueThenRetriedSuccess(t *testing
 	defer cancel()
 	callCount := 0
 	called := make(chan struct{}, 2)
-	loadAttempter := func(gsmsg.GraphSyncRequestID, ipld.Link) ([]byte, error) {
+	loadAttempter := func(context.Context, gsmsg.GraphSyncRequestID, ipld.Link, ipldbridge.LinkContext) ([]byte, error) {
 		var result []byte
 		called <- struct{}{}
 		if callCount > 0 {
@@ -144,7 +149,7 @@ func TestAsyncLoadInitialLoadIndeterminateRetryTrueThenRetriedSuccess(t *testing
 	link := testbridge.NewMockLink()
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
 	resultChan := make(chan types.AsyncLoadResult, 1)
-	lr := NewLoadRequest(requestID, link, resultChan)
+	lr := NewLoadRequest(ctx, requestID, link, ipldbridge.LinkContext{}, resultChan)
 	loadAttemptQueue.AttemptLoad(lr, true)
 
 	select {
@@ -179,7 +184,7 @@ func TestAsyncLoadInitialLoadIndeterminateThenRequestFinishes(t *testing.T) {
 	defer cancel()
 	callCount := 0
 	called := make(chan struct{}, 2)
-	loadAttempter := func(gsmsg.GraphSyncRequestID, ipld.Link) ([]byte, error) {
+	loadAttempter := func(context.Context, gsmsg.GraphSyncRequestID, ipld.Link, ipldbridge.LinkContext) ([]byte, error) {
 		var result []byte
 		called <- struct{}{}
 		if callCount > 0 {
@@ -193,7 +198,7 @@ func TestAsyncLoadInitialLoadIndeterminateThenRequestFinishes(t *testing.T) {
 	link := testbridge.NewMockLink()
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
 	resultChan := make(chan types.AsyncLoadResult, 1)
-	lr := NewLoadRequest(requestID, link, resultChan)
+	lr := NewLoadRequest(ctx, requestID, link, ipldbridge.LinkContext{}, resultChan)
 	loadAttemptQueue.AttemptLoad(lr, true)
 
 	select {
@@ -222,3 +227,45 @@ func TestAsyncLoadInitialLoadIndeterminateThenRequestFinishes(t *testing.T) {
 		t.Fatal("should only have attempted one call but attempted multiple")
 	}
 }
+
+func TestAsyncLoadRetriesHigherPriorityRequestsFirst(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	retrying := false
+	var retryOrder []gsmsg.GraphSyncRequestID
+	loadAttempter := func(_ context.Context, requestID gsmsg.GraphSyncRequestID, link ipld.Link, _ ipldbridge.LinkContext) ([]byte, error) {
+		if !retrying {
+			return nil, nil
+		}
+		retryOrder = append(retryOrder, requestID)
+		return testutil.RandomBytes(100), nil
+	}
+	loadAttemptQueue := New(loadAttempter)
+
+	lowPriorityID := gsmsg.GraphSyncRequestID(1)
+	highPriorityID := gsmsg.GraphSyncRequestID(2)
+	loadAttemptQueue.SetPriority(lowPriorityID, gsmsg.GraphSyncPriority(1))
+	loadAttemptQueue.SetPriority(highPriorityID, gsmsg.GraphSyncPriority(10))
+	lowResultChan := make(chan types.AsyncLoadResult, 1)
+	highResultChan := make(chan types.AsyncLoadResult, 1)
+	loadAttemptQueue.AttemptLoad(NewLoadRequest(ctx, lowPriorityID, testbridge.NewMockLink(), ipldbridge.LinkContext{}, lowResultChan), true)
+	loadAttemptQueue.AttemptLoad(NewLoadRequest(ctx, highPriorityID, testbridge.NewMockLink(), ipldbridge.LinkContext{}, highResultChan), true)
+
+	retrying = true
+	loadAttemptQueue.RetryLoads()
+
+	for _, resultChan := range []chan types.AsyncLoadResult{lowResultChan, highResultChan} {
+		select {
+		case result := <-resultChan:
+			if result.Data == nil {
+				t.Fatal("should have sent response")
+			}
+		case <-ctx.Done():
+			t.Fatal("should have retried loads")
+		}
+	}
+	if len(retryOrder) != 2 || retryOrder[0] != highPriorityID || retryOrder[1] != lowPriorityID {
+		t.Fatal("should have retried higher priority request first")
+	}
+}
@@ -1,17 +1,21 @@
 package responsecache
 
 import (
-	"fmt"
+	"context"
 	"sync"
 
 	"github.com/ipfs/go-graphsync/metadata"
 	logging "github.com/ipfs/go-log"
 
 	"github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-graphsync/ipldbridge"
 	"github.com/ipfs/go-graphsync/linktracker"
 	gsmsg "github.com/ipfs/go-graphsync/message"
+	"github.com/ipfs/go-graphsync/requestmanager/asyncloader/unverifiedblockstore"
+	"github.com/ipfs/go-graphsync/requestmanager/requesterrors"
 	"github.com/ipld/go-ipld-prime"
 	"github.com/ipld/go-ipld-prime/linking/cid"
+	peer "github.com/libp2p/go-libp2p-peer"
 )
 
 var log = logging.Logger("graphsync")
@@ -21,11 +25,12 @@ type responseCacheMessage interface {
 }
 
 // UnverifiedBlockStore is an interface for storing blocks
-// as they come in and removing them as they are verified
+// as they come in and removing them as they are verified. VerifyBlock returns
+// unverifiedblockstore.ErrBlockNotFound for blocks it does not hold.
 type UnverifiedBlockStore interface {
 	PruneBlocks(func(ipld.Link) bool)
-	VerifyBlock(ipld.Link) ([]byte, error)
-	AddUnverifiedBlock(ipld.Link, []byte)
+	VerifyBlock(context.Context, ipld.Link, ipldbridge.LinkContext) ([]byte, error)
+	AddUnverifiedBlock(peer.ID, ipld.Link, []byte)
 }
 
 // ResponseCache maintains a store of unverified blocks and response
@@ -57,30 +62,56 @@ func (rc *ResponseCache) FinishRequest(requestID gsmsg.GraphSyncRequestID) {
 	rc.responseCacheLk.Unlock()
 }
 
-// AttemptLoad attempts to laod the given block from the cache
-func (rc *ResponseCache) AttemptLoad(requestID gsmsg.GraphSyncRequestID, link ipld.Link) ([]byte, error) {
+// AttemptLoad attempts to laod the given block from the cache, storing it
+// with the given request context and link context if it is found. It returns
+// a BlockStorageError if the block is found but cannot be read or stored.
+func (rc *ResponseCache) AttemptLoad(ctx context.Context, requestID gsmsg.GraphSyncRequestID, link ipld.Link, linkCtx ipldbridge.LinkContext) ([]byte, error) {
 	rc.responseCacheLk.Lock()
 	defer rc.responseCacheLk.Unlock()
 	if rc.linkTracker.IsKnownMissingLink(requestID, link) {
-		return nil, fmt.Errorf("Remote Peer Is Missing Block: %s", link.String())
+		return nil, requesterrors.MissingBlockError{RequestID: requestID, Link: link}
 	}
-	data, _ := rc.unverifiedBlockStore.VerifyBlock(link)
+	data, err := rc.unverifiedBlockStore.VerifyBlock(ctx, link, linkCtx)
+	if err == unverifiedblockstore.ErrBlockNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, requesterrors.BlockStorageError{RequestID: requestID, Link: link, Err: err}
+	}
+	rc.linkTracker.RecordLinkVerification(requestID, link)
 	return data, nil
 }
 
-// ProcessResponse processes incoming response data, adding unverified blocks,
-// and tracking link metadata from a remote peer
-func (rc *ResponseCache) ProcessResponse(responses map[gsmsg.GraphSyncRequestID]metadata.Metadata,
+// RecordLocalLoad records that the given request loaded the block for a link
+// from the local store, so copies of the block received from the network are
+// pruned rather than held for the request
+func (rc *ResponseCache) RecordLocalLoad(requestID gsmsg.GraphSyncRequestID, link ipld.Link) {
+	rc.responseCacheLk.Lock()
+	rc.linkTracker.RecordLinkVerification(requestID, link)
+	rc.unverifiedBlockStore.PruneBlocks(func(prunedLink ipld.Link) bool {
+		return prunedLink == link && rc.linkTracker.BlockRefCount(link) == 0
+	})
+	rc.responseCacheLk.Unlock()
+}
+
+// ProcessResponse processes incoming response data from the given remote peer,
+// adding unverified blocks, and tracking link metadata
+func (rc *ResponseCache) ProcessResponse(p peer.ID, responses map[gsmsg.GraphSyncRequestID]metadata.Metadata,
 	blks []blocks.Block) {
 	rc.responseCacheLk.Lock()
 
 	for _, block := range blks {
 		log.Debugf("Received block from network: %s", block.Cid().String())
-		rc.unverifiedBlockStore.AddUnverifiedBlock(cidlink.Link{Cid: block.Cid()}, block.RawData())
+		rc.unverifiedBlockStore.AddUnverifiedBlock(p, cidlink.Link{Cid: block.Cid()}, block.RawData())
 	}
 
 	for requestID, md := range responses {
 		for _, item := range md {
+			// other peers responding to the same request may send links this
+			// request already verified
+			if rc.linkTracker.IsVerifiedLink(requestID, item.Link) {
+				continue
+			}
 			log.Debugf("Traverse link %s on request ID %d", item.Link.String(), requestID)
 			rc.linkTracker.RecordLinkTraversal(requestID, item.Link, item.BlockPresent)
 		}
@@ -1,6 +1,7 @@
 package responsecache
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"reflect"
@@ -8,19 +9,24 @@ import (
 
 	"github.com/ipfs/go-block-format"
 
+	"github.com/ipfs/go-graphsync/ipldbridge"
 	gsmsg "github.com/ipfs/go-graphsync/message"
 	"github.com/ipfs/go-graphsync/metadata"
+	"github.com/ipfs/go-graphsync/requestmanager/asyncloader/unverifiedblockstore"
+	"github.com/ipfs/go-graphsync/requestmanager/requesterrors"
 	"github.com/ipfs/go-graphsync/testutil"
 	"github.com/ipld/go-ipld-prime/linking/cid"
 
 	ipld "github.com/ipld/go-ipld-prime"
+	peer "github.com/libp2p/go-libp2p-peer"
 )
 
 type fakeUnverifiedBlockStore struct {
 	inMemoryBlocks map[ipld.Link][]byte
+	unreadable     map[ipld.Link]struct{}
 }
 
-func (ubs *fakeUnverifiedBlockStore) AddUnverifiedBlock(lnk ipld.Link, data []byte) {
+func (ubs *fakeUnverifiedBlockStore) AddUnverifiedBlock(p peer.ID, lnk ipld.Link, data []byte) {
 	ubs.inMemoryBlocks[lnk] = data
 }
 
@@ -32,10 +38,13 @@ func (ubs *fakeUnverifiedBlockStore) PruneBlocks(shouldPrune func(ipld.Link) boo
 	}
 }
 
-func (ubs *fakeUnverifiedBlockStore) VerifyBlock(lnk ipld.Link) ([]byte, error) {
+func (ubs *fakeUnverifiedBlockStore) VerifyBlock(ctx context.Context, lnk ipld.Link, lnkCtx ipldbridge.LinkContext) ([]byte, error) {
+	if _, ok := ubs.unreadable[lnk]; ok {
+		return nil, fmt.Errorf("Unable to read block")
+	}
 	data, ok := ubs.inMemoryBlocks[lnk]
 	if !ok {
-		return nil, fmt.Errorf("Block not found")
+		return nil, unverifiedblockstore.ErrBlockNotFound
 	}
 	delete(ubs.inMemoryBlocks, lnk)
 	return data, nil
@@ -53,6 +62,8 @@ func (ubs *fakeUnverifiedBlockStore) blocks() []blocks.Block {
 }
 
 func TestResponseCacheManagingLinks(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
+	ctx := context.Background()
 	blks := testutil.GenerateBlocksOfSize(5, 100)
 	requestID1 := gsmsg.GraphSyncRequestID(rand.Int31())
 	requestID2 := gsmsg.GraphSyncRequestID(rand.Int31())
@@ -97,14 +108,14 @@ func TestResponseCacheManagingLinks(t *testing.T) {
 	}
 	responseCache := New(fubs)
 
-	responseCache.ProcessResponse(responses, blks)
+	responseCache.ProcessResponse(p, responses, blks)
 
 	if len(fubs.blocks()) != len(blks)-1 || testutil.ContainsBlock(fubs.blocks(), blks[2]) {
 		t.Fatal("should have prune block not referred to but didn't")
 	}
 
 	// should load block from unverified block store
-	data, err := responseCache.AttemptLoad(requestID2, cidlink.Link{Cid: blks[4].Cid()})
+	data, err := responseCache.AttemptLoad(ctx, requestID2, cidlink.Link{Cid: blks[4].Cid()}, ipldbridge.LinkContext{})
 	if err != nil || !reflect.DeepEqual(data, blks[4].RawData()) {
 		t.Fatal("did not load correct block")
 	}
@@ -114,13 +125,18 @@ func TestResponseCacheManagingLinks(t *testing.T) {
 	}
 
 	// fails as it is a known missing block
-	data, err = responseCache.AttemptLoad(requestID1, cidlink.Link{Cid: blks[1].Cid()})
+	data, err = responseCache.AttemptLoad(ctx, requestID1, cidlink.Link{Cid: blks[1].Cid()}, ipldbridge.LinkContext{})
 	if err == nil || data != nil {
 		t.Fatal("found block that should not have been found")
 	}
+	missingBlockError, ok := err.(requesterrors.MissingBlockError)
+	if !ok || missingBlockError.RequestID != requestID1 ||
+		missingBlockError.Link != (cidlink.Link{Cid: blks[1].Cid()}) {
+		t.Fatal("did not return missing block error for known missing block")
+	}
 
 	// should succeed for request 2 where it's not a missing block
-	data, err = responseCache.AttemptLoad(requestID2, cidlink.Link{Cid: blks[1].Cid()})
+	data, err = responseCache.AttemptLoad(ctx, requestID2, cidlink.Link{Cid: blks[1].Cid()}, ipldbridge.LinkContext{})
 	if err != nil || !reflect.DeepEqual(data, blks[1].RawData()) {
 		t.Fatal("did not load correct block")
 	}
@@ -130,7 +146,7 @@ func TestResponseCacheManagingLinks(t *testing.T) {
 	}
 
 	// should be unknown result as block is not known missing or present in block store
-	data, err = responseCache.AttemptLoad(requestID1, cidlink.Link{Cid: blks[2].Cid()})
+	data, err = responseCache.AttemptLoad(ctx, requestID1, cidlink.Link{Cid: blks[2].Cid()}, ipldbridge.LinkContext{})
 	if err != nil || data != nil {
 		t.Fatal("should have produced unknown result but didn't")
 	}
@@ -147,3 +163,69 @@ func TestResponseCacheManagingLinks(t *testing.T) {
 		t.Fatal("should have removed block on verify but didn't")
 	}
 }
+
+func TestResponseCachePrunesBlocksAlreadyVerified(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
+	ctx := context.Background()
+	blks := testutil.GenerateBlocksOfSize(2, 100)
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	link := cidlink.Link{Cid: blks[0].Cid()}
+	responses := map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		requestID: metadata.Metadata{
+			metadata.Item{
+				Link:         link,
+				BlockPresent: true,
+			},
+		},
+	}
+
+	fubs := &fakeUnverifiedBlockStore{
+		inMemoryBlocks: make(map[ipld.Link][]byte),
+	}
+	responseCache := New(fubs)
+
+	// the first peer to respond sends the block, which is verified
+	responseCache.ProcessResponse(p, responses, blks[:1])
+	data, err := responseCache.AttemptLoad(ctx, requestID, link, ipldbridge.LinkContext{})
+	if err != nil || !reflect.DeepEqual(data, blks[0].RawData()) {
+		t.Fatal("did not load correct block")
+	}
+
+	// a slower peer sends the same block for the same request
+	responseCache.ProcessResponse(p, responses, blks[:1])
+	if len(fubs.blocks()) != 0 {
+		t.Fatal("should have pruned block the request already verified but didn't")
+	}
+}
+
+func TestResponseCacheReturnsBlockStorageErrors(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
+	ctx := context.Background()
+	blks := testutil.GenerateBlocksOfSize(1, 100)
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	link := cidlink.Link{Cid: blks[0].Cid()}
+	responses := map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		requestID: metadata.Metadata{
+			metadata.Item{
+				Link:         link,
+				BlockPresent: true,
+			},
+		},
+	}
+
+	fubs := &fakeUnverifiedBlockStore{
+		inMemoryBlocks: make(map[ipld.Link][]byte),
+		unreadable:     map[ipld.Link]struct{}{link: struct{}{}},
+	}
+	responseCache := New(fubs)
+	responseCache.ProcessResponse(p, responses, blks)
+
+	data, err := responseCache.AttemptLoad(ctx, requestID, link, ipldbridge.LinkContext{})
+	if data != nil {
+		t.Fatal("should not load block that cannot be read")
+	}
+	blockStorageError, ok := err.(requesterrors.BlockStorageError)
+	if !ok || blockStorageError.RequestID != requestID || blockStorageError.Link != link {
+		t.Fatal("did not return block storage error for block that cannot be read")
+	}
+}
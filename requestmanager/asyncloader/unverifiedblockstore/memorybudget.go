@@ -0,0 +1,124 @@
+package unverifiedblockstore
+
+import (
+	"context"
+	"sync"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// MemoryBudget limits how many bytes of blocks from each peer one or more
+// unverified block stores hold in memory, so a peer whose blocks are not used
+// yet does not hold up blocks from other peers. It is safe to use
+// concurrently.
+type MemoryBudget struct {
+	maxSize uint64
+
+	sizeLk sync.Mutex
+	size   uint64
+	peers  map[peer.ID]*peerMemory
+}
+
+// peerMemory is what the blocks from one peer take up of the budget
+type peerMemory struct {
+	size           uint64
+	reserved       uint64
+	spaceAvailable chan struct{}
+}
+
+// NewMemoryBudget returns a budget of the given number of bytes for each peer.
+// Zero means no limit.
+func NewMemoryBudget(maxSize uint64) *MemoryBudget {
+	return &MemoryBudget{
+		maxSize: maxSize,
+		peers:   make(map[peer.ID]*peerMemory),
+	}
+}
+
+// Size returns how many bytes of blocks from all peers are held in memory
+// against the budget, including space reserved for blocks not yet added
+func (mb *MemoryBudget) Size() uint64 {
+	mb.sizeLk.Lock()
+	defer mb.sizeLk.Unlock()
+	size := mb.size
+	for _, pm := range mb.peers {
+		size += pm.reserved
+	}
+	return size
+}
+
+// ReserveSpace blocks while the given peer's budget is used up, then sets
+// aside the given number of bytes for blocks from the peer about to be added.
+// It returns an error if the context ends first. The budget can be exceeded by
+// one reservation, so blocks are never refused.
+func (mb *MemoryBudget) ReserveSpace(ctx context.Context, p peer.ID, size uint64) error {
+	for {
+		mb.sizeLk.Lock()
+		pm := mb.peerMemory(p)
+		if mb.maxSize == 0 || pm.size+pm.reserved < mb.maxSize {
+			pm.reserved += size
+			mb.sizeLk.Unlock()
+			return nil
+		}
+		spaceAvailable := pm.spaceAvailable
+		mb.sizeLk.Unlock()
+		select {
+		case <-spaceAvailable:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (mb *MemoryBudget) wouldExceed(p peer.ID, size uint64) bool {
+	if mb.maxSize == 0 {
+		return false
+	}
+	mb.sizeLk.Lock()
+	defer mb.sizeLk.Unlock()
+	pm, ok := mb.peers[p]
+	if !ok {
+		return size > mb.maxSize
+	}
+	return pm.size+size > mb.maxSize
+}
+
+// use counts a block from the given peer added to memory, taking it out of
+// the peer's reserved space first
+func (mb *MemoryBudget) use(p peer.ID, size uint64) {
+	mb.sizeLk.Lock()
+	defer mb.sizeLk.Unlock()
+	pm := mb.peerMemory(p)
+	mb.size += size
+	pm.size += size
+	if pm.reserved > size {
+		pm.reserved -= size
+	} else {
+		pm.reserved = 0
+	}
+}
+
+func (mb *MemoryBudget) free(p peer.ID, size uint64) {
+	mb.sizeLk.Lock()
+	defer mb.sizeLk.Unlock()
+	pm := mb.peerMemory(p)
+	mb.size -= size
+	pm.size -= size
+	close(pm.spaceAvailable)
+	pm.spaceAvailable = make(chan struct{})
+	// waiters were woken, so they look the peer up again
+	if pm.size == 0 && pm.reserved == 0 {
+		delete(mb.peers, p)
+	}
+}
+
+// peerMemory returns what the given peer's blocks take up, starting the peer
+// at zero if it has none
+func (mb *MemoryBudget) peerMemory(p peer.ID) *peerMemory {
+	pm, ok := mb.peers[p]
+	if !ok {
+		pm = &peerMemory{spaceAvailable: make(chan struct{})}
+		mb.peers[p] = pm
+	}
+	return pm
+}
@@ -0,0 +1,105 @@
+package unverifiedblockstore
+
+import (
+	"io/ioutil"
+	"os"
+
+	ipld "github.com/ipld/go-ipld-prime"
+)
+
+// spilledBlock is where a block's data is in a spill file
+type spilledBlock struct {
+	offset int64
+	length int
+}
+
+// spillFile is an append only log of blocks written to disk because the store
+// was at its maximum size. Space from blocks no longer held is reclaimed by
+// emptying or compacting the log.
+type spillFile struct {
+	dir  string
+	file *os.File
+	end  int64
+	used int64
+}
+
+func openSpillFile(dir string) (*spillFile, error) {
+	file, err := ioutil.TempFile(dir, "graphsync-unverified-blocks-")
+	if err != nil {
+		return nil, err
+	}
+	return &spillFile{dir: dir, file: file}, nil
+}
+
+func (sf *spillFile) append(data []byte) (spilledBlock, error) {
+	n, err := sf.file.WriteAt(data, sf.end)
+	if err != nil {
+		return spilledBlock{}, err
+	}
+	sb := spilledBlock{offset: sf.end, length: n}
+	sf.end += int64(n)
+	sf.used += int64(n)
+	return sb, nil
+}
+
+func (sf *spillFile) read(sb spilledBlock) ([]byte, error) {
+	data := make([]byte, sb.length)
+	_, err := sf.file.ReadAt(data, sb.offset)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// release records that a block in the log is no longer held
+func (sf *spillFile) release(sb spilledBlock) {
+	sf.used -= int64(sb.length)
+}
+
+// unused is how many bytes of the log hold blocks no longer held
+func (sf *spillFile) unused() int64 {
+	return sf.end - sf.used
+}
+
+func (sf *spillFile) reset() error {
+	sf.end = 0
+	sf.used = 0
+	return sf.file.Truncate(0)
+}
+
+// compact copies the given blocks to a new log, updating where each one is,
+// and removes the old log. If copying fails the old log is kept unchanged.
+func (sf *spillFile) compact(spilledBlocks map[ipld.Link]spilledBlock) error {
+	compacted, err := openSpillFile(sf.dir)
+	if err != nil {
+		return err
+	}
+	newSpilledBlocks := make(map[ipld.Link]spilledBlock, len(spilledBlocks))
+	for lnk, sb := range spilledBlocks {
+		data, err := sf.read(sb)
+		if err == nil {
+			newSpilledBlocks[lnk], err = compacted.append(data)
+		}
+		if err != nil {
+			compacted.remove()
+			return err
+		}
+	}
+	err = sf.remove()
+	if err != nil {
+		log.Warningf("Unable to remove compacted spill file: %s", err)
+	}
+	for lnk, sb := range newSpilledBlocks {
+		spilledBlocks[lnk] = sb
+	}
+	*sf = *compacted
+	return nil
+}
+
+func (sf *spillFile) remove() error {
+	err := sf.file.Close()
+	if removeErr := os.Remove(sf.file.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
@@ -1,32 +1,102 @@
 package unverifiedblockstore
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"sync"
 
 	"github.com/ipfs/go-graphsync/ipldbridge"
+	logging "github.com/ipfs/go-log"
 	ipld "github.com/ipld/go-ipld-prime"
+	peer "github.com/libp2p/go-libp2p-peer"
 )
 
+var log = logging.Logger("graphsync")
+
+// ErrBlockNotFound is returned when verifying a block that is not in the
+// store, as opposed to one that is but cannot be read or stored
+var ErrBlockNotFound = errors.New("Block not found")
+
+// inMemoryBlock is a block held in memory, counted against the budget of the
+// peer that sent it
+type inMemoryBlock struct {
+	from peer.ID
+	data []byte
+}
+
 // UnverifiedBlockStore holds an in memory cache of receied blocks from the network
 // that have not been verified to be part of a traversal
 type UnverifiedBlockStore struct {
-	inMemoryBlocks map[ipld.Link][]byte
-	storer         ipldbridge.Storer
+	inMemoryBlocks map[ipld.Link]inMemoryBlock
+	storer         ipldbridge.ContextStorer
+	budget         *MemoryBudget
+
+	spillToDisk   bool
+	spillDir      string
+	spilledBlocks map[ipld.Link]spilledBlock
+	spillLk       sync.Mutex
+	spillFile     *spillFile
+	closed        bool
+}
+
+// Option configures an UnverifiedBlockStore
+type Option func(*UnverifiedBlockStore)
+
+// MaxSize sets how many bytes of blocks from each peer the store holds in
+// memory before ReserveSpace blocks for that peer, or before the peer's blocks
+// are spilled to disk with SpillToDisk. Zero means no limit.
+func MaxSize(maxSize uint64) Option {
+	return func(ubs *UnverifiedBlockStore) {
+		ubs.budget = NewMemoryBudget(maxSize)
+	}
+}
+
+// ShareMemoryBudget counts blocks the store holds in memory against a budget
+// shared with other stores, in place of a budget of its own set with MaxSize.
+func ShareMemoryBudget(budget *MemoryBudget) Option {
+	return func(ubs *UnverifiedBlockStore) {
+		ubs.budget = budget
+	}
+}
+
+// SpillToDisk writes blocks that do not fit in memory to a temporary file in
+// the given directory, or the system temporary directory if it is empty,
+// rather than having ReserveSpace wait for room. The file is removed on Close.
+func SpillToDisk(dir string) Option {
+	return func(ubs *UnverifiedBlockStore) {
+		ubs.spillToDisk = true
+		ubs.spillDir = dir
+	}
 }
 
 // New initializes a new unverified store with the given storer function for writing
 // to permaneant storage if the block is verified
-func New(storer ipldbridge.Storer) *UnverifiedBlockStore {
-	return &UnverifiedBlockStore{
-		inMemoryBlocks: make(map[ipld.Link][]byte),
+func New(storer ipldbridge.ContextStorer, options ...Option) *UnverifiedBlockStore {
+	ubs := &UnverifiedBlockStore{
+		inMemoryBlocks: make(map[ipld.Link]inMemoryBlock),
+		spilledBlocks:  make(map[ipld.Link]spilledBlock),
 		storer:         storer,
+		budget:         NewMemoryBudget(0),
+	}
+	for _, option := range options {
+		option(ubs)
 	}
+	return ubs
 }
 
-// AddUnverifiedBlock adds a new unverified block to the in memory cache as it
-// comes in as part of a traversal.
-func (ubs *UnverifiedBlockStore) AddUnverifiedBlock(lnk ipld.Link, data []byte) {
-	ubs.inMemoryBlocks[lnk] = data
+// AddUnverifiedBlock adds a new unverified block from the given peer to the in
+// memory cache as it comes in as part of a traversal.
+func (ubs *UnverifiedBlockStore) AddUnverifiedBlock(p peer.ID, lnk ipld.Link, data []byte) {
+	ubs.removeBlock(lnk)
+	if ubs.shouldSpill(p, len(data)) {
+		err := ubs.spillBlock(lnk, data)
+		if err == nil {
+			return
+		}
+		log.Warningf("Unable to spill unverified block to disk, keeping it in memory: %s", err)
+	}
+	ubs.inMemoryBlocks[lnk] = inMemoryBlock{p, data}
+	ubs.budget.use(p, uint64(len(data)))
 }
 
 // PruneBlocks removes blocks from the unverified store without committing them,
@@ -34,20 +104,27 @@ func (ubs *UnverifiedBlockStore) AddUnverifiedBlock(lnk ipld.Link, data []byte)
 func (ubs *UnverifiedBlockStore) PruneBlocks(shouldPrune func(ipld.Link) bool) {
 	for link := range ubs.inMemoryBlocks {
 		if shouldPrune(link) {
-			delete(ubs.inMemoryBlocks, link)
+			ubs.removeBlock(link)
+		}
+	}
+	for link := range ubs.spilledBlocks {
+		if shouldPrune(link) {
+			ubs.removeBlock(link)
 		}
 	}
 }
 
 // VerifyBlock verifies the data for the given link as being part of a traversal,
-// removes it from the unverified store, and writes it to permaneant storage.
-func (ubs *UnverifiedBlockStore) VerifyBlock(lnk ipld.Link) ([]byte, error) {
-	data, ok := ubs.inMemoryBlocks[lnk]
-	if !ok {
-		return nil, fmt.Errorf("Block not found")
-	}
-	delete(ubs.inMemoryBlocks, lnk)
-	buffer, committer, err := ubs.storer(ipldbridge.LinkContext{})
+// removes it from the unverified store, and writes it to permaneant storage,
+// passing the storer the given request context and link context. It returns
+// ErrBlockNotFound if the block is not in the store.
+func (ubs *UnverifiedBlockStore) VerifyBlock(ctx context.Context, lnk ipld.Link, lnkCtx ipldbridge.LinkContext) ([]byte, error) {
+	data, err := ubs.loadBlock(lnk)
+	if err != nil {
+		return nil, err
+	}
+	ubs.removeBlock(lnk)
+	buffer, committer, err := ubs.storer(ctx, lnkCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -61,3 +138,110 @@ func (ubs *UnverifiedBlockStore) VerifyBlock(lnk ipld.Link) ([]byte, error) {
 	}
 	return data, nil
 }
+
+// Size returns how many bytes of blocks are held in memory against the store's
+// budget, including space reserved for blocks not yet added. Unlike the other
+// methods, it is safe to call concurrently.
+func (ubs *UnverifiedBlockStore) Size() uint64 {
+	return ubs.budget.Size()
+}
+
+// ReserveSpace blocks while the store's budget for the given peer is used up,
+// then sets aside the given number of bytes for blocks from the peer about to
+// be added. It returns an error if the context ends first. The budget can be
+// exceeded by one reservation, so blocks are never refused. A store that
+// spills to disk always has room, so it returns right away. Unlike the other
+// methods, it is safe to call concurrently.
+func (ubs *UnverifiedBlockStore) ReserveSpace(ctx context.Context, p peer.ID, size uint64) error {
+	if ubs.spillToDisk {
+		return nil
+	}
+	return ubs.budget.ReserveSpace(ctx, p, size)
+}
+
+// Close removes any blocks spilled to disk. Blocks added after the store is
+// closed are kept in memory. Unlike the other methods, it is safe to call
+// concurrently.
+func (ubs *UnverifiedBlockStore) Close() error {
+	ubs.spillLk.Lock()
+	defer ubs.spillLk.Unlock()
+	ubs.closed = true
+	if ubs.spillFile == nil {
+		return nil
+	}
+	return ubs.spillFile.remove()
+}
+
+func (ubs *UnverifiedBlockStore) shouldSpill(p peer.ID, size int) bool {
+	return ubs.spillToDisk && ubs.budget.wouldExceed(p, uint64(size))
+}
+
+func (ubs *UnverifiedBlockStore) spillBlock(lnk ipld.Link, data []byte) error {
+	ubs.spillLk.Lock()
+	defer ubs.spillLk.Unlock()
+	if ubs.closed {
+		return errors.New("store closed")
+	}
+	if ubs.spillFile == nil {
+		spillFile, err := openSpillFile(ubs.spillDir)
+		if err != nil {
+			return err
+		}
+		ubs.spillFile = spillFile
+	}
+	sb, err := ubs.spillFile.append(data)
+	if err != nil {
+		return err
+	}
+	ubs.spilledBlocks[lnk] = sb
+	return nil
+}
+
+func (ubs *UnverifiedBlockStore) loadBlock(lnk ipld.Link) ([]byte, error) {
+	if block, ok := ubs.inMemoryBlocks[lnk]; ok {
+		return block.data, nil
+	}
+	if sb, ok := ubs.spilledBlocks[lnk]; ok {
+		ubs.spillLk.Lock()
+		defer ubs.spillLk.Unlock()
+		if ubs.closed {
+			return nil, errors.New("store closed")
+		}
+		return ubs.spillFile.read(sb)
+	}
+	return nil, ErrBlockNotFound
+}
+
+func (ubs *UnverifiedBlockStore) removeBlock(lnk ipld.Link) {
+	if block, ok := ubs.inMemoryBlocks[lnk]; ok {
+		delete(ubs.inMemoryBlocks, lnk)
+		ubs.budget.free(block.from, uint64(len(block.data)))
+		return
+	}
+	if sb, ok := ubs.spilledBlocks[lnk]; ok {
+		delete(ubs.spilledBlocks, lnk)
+		ubs.reclaimSpillSpace(sb)
+	}
+}
+
+// reclaimSpillSpace empties the spill file once no blocks in it are held, and
+// otherwise rewrites it with only the blocks still held once more of it is
+// unused than used, so rewriting costs at most as much as the writes it
+// reclaims
+func (ubs *UnverifiedBlockStore) reclaimSpillSpace(sb spilledBlock) {
+	ubs.spillLk.Lock()
+	defer ubs.spillLk.Unlock()
+	if ubs.closed {
+		return
+	}
+	ubs.spillFile.release(sb)
+	var err error
+	if len(ubs.spilledBlocks) == 0 {
+		err = ubs.spillFile.reset()
+	} else if ubs.spillFile.unused() > ubs.spillFile.used {
+		err = ubs.spillFile.compact(ubs.spilledBlocks)
+	}
+	if err != nil {
+		log.Warningf("Unable to reclaim disk space for unverified blocks: %s", err)
+	}
+}
@@ -2,9 +2,13 @@ package unverifiedblockstore
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"io/ioutil"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-graphsync/ipldbridge"
 
@@ -17,24 +21,26 @@ import (
 )
 
 func TestVerifyBlockPresent(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
+	ctx := context.Background()
 	blocksWritten := make(map[ipld.Link][]byte)
 	loader, storer := testbridge.NewMockStore(blocksWritten)
-	unverifiedBlockStore := New(storer)
+	unverifiedBlockStore := New(ipldbridge.StorerWithContext(storer))
 	block := testutil.GenerateBlocksOfSize(1, 100)[0]
 	reader, err := loader(cidlink.Link{Cid: block.Cid()}, ipldbridge.LinkContext{})
 	if reader != nil || err == nil {
 		t.Fatal("block should not be loadable till it's verified and stored")
 	}
-	data, err := unverifiedBlockStore.VerifyBlock(cidlink.Link{Cid: block.Cid()})
+	data, err := unverifiedBlockStore.VerifyBlock(ctx, cidlink.Link{Cid: block.Cid()}, ipldbridge.LinkContext{})
 	if data != nil || err == nil {
 		t.Fatal("block should not be verifiable till it's added as an unverifiable block")
 	}
-	unverifiedBlockStore.AddUnverifiedBlock(cidlink.Link{Cid: block.Cid()}, block.RawData())
+	unverifiedBlockStore.AddUnverifiedBlock(p, cidlink.Link{Cid: block.Cid()}, block.RawData())
 	reader, err = loader(cidlink.Link{Cid: block.Cid()}, ipldbridge.LinkContext{})
 	if reader != nil || err == nil {
 		t.Fatal("block should not be loadable till it's verified and stored")
 	}
-	data, err = unverifiedBlockStore.VerifyBlock(cidlink.Link{Cid: block.Cid()})
+	data, err = unverifiedBlockStore.VerifyBlock(ctx, cidlink.Link{Cid: block.Cid()}, ipldbridge.LinkContext{})
 	if !reflect.DeepEqual(data, block.RawData()) || err != nil {
 		t.Fatal("block should be returned on verification if added")
 	}
@@ -44,8 +50,247 @@ func TestVerifyBlockPresent(t *testing.T) {
 	if !reflect.DeepEqual(buffer.Bytes(), block.RawData()) || err != nil {
 		t.Fatal("block should be stored after verification and therefore loadable")
 	}
-	data, err = unverifiedBlockStore.VerifyBlock(cidlink.Link{Cid: block.Cid()})
+	data, err = unverifiedBlockStore.VerifyBlock(ctx, cidlink.Link{Cid: block.Cid()}, ipldbridge.LinkContext{})
 	if data != nil || err == nil {
 		t.Fatal("block cannot be verified twice")
 	}
 }
+
+func TestReserveSpaceWaitsForMaxSize(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blocksWritten := make(map[ipld.Link][]byte)
+	_, storer := testbridge.NewMockStore(blocksWritten)
+	unverifiedBlockStore := New(ipldbridge.StorerWithContext(storer), MaxSize(100))
+	blks := testutil.GenerateBlocksOfSize(3, 100)
+
+	err := unverifiedBlockStore.ReserveSpace(ctx, p, 200)
+	if err != nil {
+		t.Fatal("should reserve space in empty store")
+	}
+	if unverifiedBlockStore.Size() != 200 {
+		t.Fatal("should count reserved space in size")
+	}
+	unverifiedBlockStore.AddUnverifiedBlock(p, cidlink.Link{Cid: blks[0].Cid()}, blks[0].RawData())
+	unverifiedBlockStore.AddUnverifiedBlock(p, cidlink.Link{Cid: blks[1].Cid()}, blks[1].RawData())
+	if unverifiedBlockStore.Size() != 200 {
+		t.Fatal("should count added blocks against reserved space")
+	}
+
+	reserved := make(chan error, 1)
+	go func() {
+		reserved <- unverifiedBlockStore.ReserveSpace(ctx, p, 100)
+	}()
+	select {
+	case <-reserved:
+		t.Fatal("should not reserve space while store is at max size")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	_, err = unverifiedBlockStore.VerifyBlock(ctx, cidlink.Link{Cid: blks[0].Cid()}, ipldbridge.LinkContext{})
+	if err != nil {
+		t.Fatal("should verify added block")
+	}
+	select {
+	case <-reserved:
+		t.Fatal("should not reserve space while store is at max size")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	unverifiedBlockStore.PruneBlocks(func(ipld.Link) bool { return true })
+	select {
+	case err := <-reserved:
+		if err != nil {
+			t.Fatal("should reserve space without error")
+		}
+	case <-ctx.Done():
+		t.Fatal("should reserve space once blocks are removed")
+	}
+
+	unverifiedBlockStore.AddUnverifiedBlock(p, cidlink.Link{Cid: blks[2].Cid()}, blks[2].RawData())
+	unverifiedBlockStore.AddUnverifiedBlock(p, cidlink.Link{Cid: blks[0].Cid()}, blks[0].RawData())
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer timeoutCancel()
+	err = unverifiedBlockStore.ReserveSpace(timeoutCtx, p, 100)
+	if err != context.DeadlineExceeded {
+		t.Fatal("should return error when context ends while waiting")
+	}
+}
+
+func TestShareMemoryBudget(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blocksWritten := make(map[ipld.Link][]byte)
+	_, storer := testbridge.NewMockStore(blocksWritten)
+	budget := NewMemoryBudget(100)
+	unverifiedBlockStore1 := New(ipldbridge.StorerWithContext(storer), ShareMemoryBudget(budget))
+	unverifiedBlockStore2 := New(ipldbridge.StorerWithContext(storer), ShareMemoryBudget(budget))
+	blks := testutil.GenerateBlocksOfSize(1, 100)
+
+	unverifiedBlockStore1.AddUnverifiedBlock(p, cidlink.Link{Cid: blks[0].Cid()}, blks[0].RawData())
+	if budget.Size() != 100 || unverifiedBlockStore2.Size() != 100 {
+		t.Fatal("should count blocks in either store against shared budget")
+	}
+
+	reserved := make(chan error, 1)
+	go func() {
+		reserved <- unverifiedBlockStore2.ReserveSpace(ctx, p, 100)
+	}()
+	select {
+	case <-reserved:
+		t.Fatal("should not reserve space while shared budget is used up")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	unverifiedBlockStore1.PruneBlocks(func(ipld.Link) bool { return true })
+	select {
+	case err := <-reserved:
+		if err != nil {
+			t.Fatal("should reserve space without error")
+		}
+	case <-ctx.Done():
+		t.Fatal("should reserve space once blocks in the other store are removed")
+	}
+}
+
+func TestSpillToDisk(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
+	ctx := context.Background()
+	spillDir, err := ioutil.TempDir("", "graphsync-test")
+	if err != nil {
+		t.Fatal("unable to create temporary directory")
+	}
+	defer os.RemoveAll(spillDir)
+	blocksWritten := make(map[ipld.Link][]byte)
+	loader, storer := testbridge.NewMockStore(blocksWritten)
+	unverifiedBlockStore := New(ipldbridge.StorerWithContext(storer), MaxSize(150), SpillToDisk(spillDir))
+	blks := testutil.GenerateBlocksOfSize(3, 100)
+
+	for _, blk := range blks {
+		err := unverifiedBlockStore.ReserveSpace(ctx, p, 100)
+		if err != nil {
+			t.Fatal("should not wait for space when spilling to disk")
+		}
+		unverifiedBlockStore.AddUnverifiedBlock(p, cidlink.Link{Cid: blk.Cid()}, blk.RawData())
+	}
+	if unverifiedBlockStore.Size() > 150 {
+		t.Fatal("should spill blocks past max size to disk")
+	}
+	files, _ := ioutil.ReadDir(spillDir)
+	if len(files) != 1 {
+		t.Fatal("should spill blocks to a single file")
+	}
+
+	data, err := unverifiedBlockStore.VerifyBlock(ctx, cidlink.Link{Cid: blks[2].Cid()}, ipldbridge.LinkContext{})
+	if !reflect.DeepEqual(data, blks[2].RawData()) || err != nil {
+		t.Fatal("spilled block should be returned on verification")
+	}
+	reader, err := loader(cidlink.Link{Cid: blks[2].Cid()}, ipldbridge.LinkContext{})
+	var buffer bytes.Buffer
+	io.Copy(&buffer, reader)
+	if !reflect.DeepEqual(buffer.Bytes(), blks[2].RawData()) || err != nil {
+		t.Fatal("spilled block should be stored after verification")
+	}
+
+	unverifiedBlockStore.PruneBlocks(func(ipld.Link) bool { return true })
+	if unverifiedBlockStore.Size() != 0 {
+		t.Fatal("should remove pruned blocks")
+	}
+	_, err = unverifiedBlockStore.VerifyBlock(ctx, cidlink.Link{Cid: blks[1].Cid()}, ipldbridge.LinkContext{})
+	if err == nil {
+		t.Fatal("pruned spilled block should not be verifiable")
+	}
+
+	err = unverifiedBlockStore.Close()
+	if err != nil {
+		t.Fatal("should close without error")
+	}
+	files, _ = ioutil.ReadDir(spillDir)
+	if len(files) != 0 {
+		t.Fatal("should remove spill file on close")
+	}
+}
+
+func TestSpillToDiskCompactsUnusedSpace(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
+	ctx := context.Background()
+	spillDir, err := ioutil.TempDir("", "graphsync-test")
+	if err != nil {
+		t.Fatal("unable to create temporary directory")
+	}
+	defer os.RemoveAll(spillDir)
+	blocksWritten := make(map[ipld.Link][]byte)
+	_, storer := testbridge.NewMockStore(blocksWritten)
+	unverifiedBlockStore := New(ipldbridge.StorerWithContext(storer), MaxSize(50), SpillToDisk(spillDir))
+	defer unverifiedBlockStore.Close()
+	blks := testutil.GenerateBlocksOfSize(4, 100)
+	for _, blk := range blks {
+		unverifiedBlockStore.AddUnverifiedBlock(p, cidlink.Link{Cid: blk.Cid()}, blk.RawData())
+	}
+	spillFileSize := func() int64 {
+		files, _ := ioutil.ReadDir(spillDir)
+		if len(files) != 1 {
+			t.Fatal("should spill blocks to a single file")
+		}
+		return files[0].Size()
+	}
+	if spillFileSize() != 400 {
+		t.Fatal("should spill blocks past max size to disk")
+	}
+
+	shouldPrune := func(pruned ...int) func(ipld.Link) bool {
+		return func(lnk ipld.Link) bool {
+			for _, i := range pruned {
+				if lnk == (cidlink.Link{Cid: blks[i].Cid()}) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	unverifiedBlockStore.PruneBlocks(shouldPrune(0, 1))
+	if spillFileSize() != 400 {
+		t.Fatal("should not compact while at most half of spill file is unused")
+	}
+	unverifiedBlockStore.PruneBlocks(shouldPrune(2))
+	if spillFileSize() != 100 {
+		t.Fatal("should compact once most of spill file is unused")
+	}
+	data, err := unverifiedBlockStore.VerifyBlock(ctx, cidlink.Link{Cid: blks[3].Cid()}, ipldbridge.LinkContext{})
+	if !reflect.DeepEqual(data, blks[3].RawData()) || err != nil {
+		t.Fatal("block should be returned on verification after compaction")
+	}
+	if spillFileSize() != 0 {
+		t.Fatal("should empty spill file once no blocks in it are held")
+	}
+}
+
+func TestVerifyBlockErrors(t *testing.T) {
+	p := testutil.GeneratePeers(1)[0]
+	ctx := context.Background()
+	spillDir, err := ioutil.TempDir("", "graphsync-test")
+	if err != nil {
+		t.Fatal("unable to create temporary directory")
+	}
+	defer os.RemoveAll(spillDir)
+	blocksWritten := make(map[ipld.Link][]byte)
+	_, storer := testbridge.NewMockStore(blocksWritten)
+	unverifiedBlockStore := New(ipldbridge.StorerWithContext(storer), MaxSize(50), SpillToDisk(spillDir))
+	blks := testutil.GenerateBlocksOfSize(2, 100)
+
+	_, err = unverifiedBlockStore.VerifyBlock(ctx, cidlink.Link{Cid: blks[0].Cid()}, ipldbridge.LinkContext{})
+	if err != ErrBlockNotFound {
+		t.Fatal("should return not found error for block not in store")
+	}
+
+	unverifiedBlockStore.AddUnverifiedBlock(p, cidlink.Link{Cid: blks[1].Cid()}, blks[1].RawData())
+	unverifiedBlockStore.Close()
+	_, err = unverifiedBlockStore.VerifyBlock(ctx, cidlink.Link{Cid: blks[1].Cid()}, ipldbridge.LinkContext{})
+	if err == nil || err == ErrBlockNotFound {
+		t.Fatal("should return error other than not found for block that cannot be read")
+	}
+}
@@ -3,38 +3,46 @@ package loader
 import (
 	"bytes"
 	"context"
-	"fmt"
 	"io"
 
 	"github.com/ipfs/go-graphsync/ipldbridge"
 	gsmsg "github.com/ipfs/go-graphsync/message"
+	"github.com/ipfs/go-graphsync/requestmanager/requesterrors"
 	"github.com/ipfs/go-graphsync/requestmanager/types"
 	ipld "github.com/ipld/go-ipld-prime"
 )
 
-// AsyncLoadFn is a function which given a request id and an ipld.Link, returns
-// a channel which will eventually return data for the link or an err
-type AsyncLoadFn func(gsmsg.GraphSyncRequestID, ipld.Link) <-chan types.AsyncLoadResult
+// AsyncLoadFn is a function which given a request context, a request id, an
+// ipld.Link and its link context, returns a channel which will eventually
+// return data for the link or an err
+type AsyncLoadFn func(context.Context, gsmsg.GraphSyncRequestID, ipld.Link, ipldbridge.LinkContext) <-chan types.AsyncLoadResult
 
 // WrapAsyncLoader creates a regular ipld link laoder from an asynchronous load
 // function, with the given cancellation context, for the given requests, and will
-// transmit load errors on the given channel
+// transmit load errors on the given channel, after passing them through
+// addErrorDetails if it is not nil. The cancellation context is also passed to
+// the load function as the request context.
 func WrapAsyncLoader(
 	ctx context.Context,
 	asyncLoadFn AsyncLoadFn,
 	requestID gsmsg.GraphSyncRequestID,
-	errorChan chan error) ipld.Loader {
+	errorChan chan error,
+	addErrorDetails func(error) error) ipld.Loader {
 	return func(link ipld.Link, linkContext ipldbridge.LinkContext) (io.Reader, error) {
-		resultChan := asyncLoadFn(requestID, link)
+		resultChan := asyncLoadFn(ctx, requestID, link, linkContext)
 		select {
 		case <-ctx.Done():
-			return nil, fmt.Errorf("request finished")
+			return nil, requesterrors.ErrRequestFinished
 		case result := <-resultChan:
 			if result.Err != nil {
+				err := result.Err
+				if addErrorDetails != nil {
+					err = addErrorDetails(err)
+				}
 				select {
 				case <-ctx.Done():
-					return nil, fmt.Errorf("request finished")
-				case errorChan <- result.Err:
+					return nil, requesterrors.ErrRequestFinished
+				case errorChan <- err:
 					return nil, ipldbridge.ErrDoNotFollow()
 				}
 			}
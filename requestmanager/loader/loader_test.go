@@ -26,7 +26,7 @@ type callParams struct {
 }
 
 func makeAsyncLoadFn(responseChan chan types.AsyncLoadResult, calls chan callParams) AsyncLoadFn {
-	return func(requestID gsmsg.GraphSyncRequestID, link ipld.Link) <-chan types.AsyncLoadResult {
+	return func(ctx context.Context, requestID gsmsg.GraphSyncRequestID, link ipld.Link, linkContext ipldbridge.LinkContext) <-chan types.AsyncLoadResult {
 		calls <- callParams{requestID, link}
 		return responseChan
 	}
@@ -41,7 +41,7 @@ func TestWrappedAsyncLoaderReturnsValues(t *testing.T) {
 	asyncLoadFn := makeAsyncLoadFn(responseChan, calls)
 	errChan := make(chan error)
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
-	loader := WrapAsyncLoader(ctx, asyncLoadFn, requestID, errChan)
+	loader := WrapAsyncLoader(ctx, asyncLoadFn, requestID, errChan, nil)
 
 	link := testbridge.NewMockLink()
 	data := testutil.RandomBytes(100)
@@ -68,7 +68,7 @@ func TestWrappedAsyncLoaderSideChannelsErrors(t *testing.T) {
 	asyncLoadFn := makeAsyncLoadFn(responseChan, calls)
 	errChan := make(chan error, 1)
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
-	loader := WrapAsyncLoader(ctx, asyncLoadFn, requestID, errChan)
+	loader := WrapAsyncLoader(ctx, asyncLoadFn, requestID, errChan, nil)
 
 	link := testbridge.NewMockLink()
 	err := errors.New("something went wrong")
@@ -97,7 +97,7 @@ func TestWrappedAsyncLoaderContextCancels(t *testing.T) {
 	asyncLoadFn := makeAsyncLoadFn(responseChan, calls)
 	errChan := make(chan error, 1)
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
-	loader := WrapAsyncLoader(subCtx, asyncLoadFn, requestID, errChan)
+	loader := WrapAsyncLoader(subCtx, asyncLoadFn, requestID, errChan, nil)
 	link := testbridge.NewMockLink()
 	resultsChan := make(chan struct {
 		io.Reader
@@ -0,0 +1,130 @@
+// Package requesterrors defines the errors sent on the error channel of an
+// outgoing request when it fails.
+package requesterrors
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	gsmsg "github.com/ipfs/go-graphsync/message"
+	ipld "github.com/ipld/go-ipld-prime"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// ErrInvalidSelector is sent on a request's error channel when the request's
+// selector spec is not valid.
+var ErrInvalidSelector = errors.New("Invalid Selector Spec")
+
+// ErrTimedOut is sent on a request's error channel when the request does not
+// complete before its deadline.
+var ErrTimedOut = errors.New("Request Failed - Timed Out")
+
+// ErrStalled is sent on a request's error channel when the responder makes no
+// progress on the request for longer than its stall timeout.
+var ErrStalled = errors.New("Request Failed - Peer Stalled")
+
+// ErrShutdown is sent on a request's error channel when the request is made
+// after, or is still in progress when, the request manager shuts down.
+var ErrShutdown = errors.New("Request Failed - GraphSync Shut Down")
+
+// ErrNoPeers is sent on a request's error channel when the request is made
+// without any peers to send it to.
+var ErrNoPeers = errors.New("Request Failed - No Peers To Request From")
+
+// ErrPeerDisconnected is the Err of a NetworkError sent when the peer
+// disconnects while the request is in progress.
+var ErrPeerDisconnected = errors.New("peer disconnected")
+
+// ErrRequestFinished is returned to the traversal when it loads a link after
+// its request has finished.
+var ErrRequestFinished = errors.New("Request Finished")
+
+// SelectorSpecError is sent on a request's error channel when the request's
+// selector spec cannot be encoded to send to peers, or decoded to traverse.
+type SelectorSpecError struct {
+	Err error
+}
+
+func (e SelectorSpecError) Error() string {
+	return fmt.Sprintf("Request Failed - Unusable Selector Spec: %s", e.Err.Error())
+}
+
+// NetworkError is sent on a request's error channel when the request fails
+// because the peer could not be reached, either because the request could
+// not be delivered or because the peer disconnected.
+type NetworkError struct {
+	Peer      peer.ID
+	RequestID gsmsg.GraphSyncRequestID
+	Err       error
+}
+
+func (e NetworkError) Error() string {
+	return fmt.Sprintf("Request Failed - Network Error With Peer %s: %s", e.Peer.Pretty(), e.Err.Error())
+}
+
+// RequestFailedError is sent on a request's error channel when the responder
+// terminates the request with a failure status.
+type RequestFailedError struct {
+	Peer      peer.ID
+	RequestID gsmsg.GraphSyncRequestID
+	Status    gsmsg.GraphSyncResponseStatusCode
+	// RetryAfter is how long a busy responder asked the requester to wait
+	// before trying again, or zero if it did not say
+	RetryAfter time.Duration
+}
+
+func (e RequestFailedError) Error() string {
+	switch e.Status {
+	case gsmsg.RequestRejected:
+		return "Request Failed - Rejected By Peer"
+	case gsmsg.RequestFailedBusy:
+		return "Request Failed - Peer Is Busy"
+	case gsmsg.RequestFailedContentNotFound:
+		return "Request Failed - Content Not Found"
+	case gsmsg.RequestFailedLegal:
+		return "Request Failed - For Legal Reasons"
+	case gsmsg.RequestFailedUnknown:
+		return "Request Failed - Unknown Reason"
+	default:
+		return "Unknown"
+	}
+}
+
+// MissingBlockError is sent on a request's error channel when the responder
+// does not have the block for a link in the traversal. When several peers
+// respond to the request, Peer is the last of them to report the block
+// missing.
+type MissingBlockError struct {
+	Peer      peer.ID
+	RequestID gsmsg.GraphSyncRequestID
+	Link      ipld.Link
+}
+
+func (e MissingBlockError) Error() string {
+	return fmt.Sprintf("Remote Peer Is Missing Block: %s", e.Link.String())
+}
+
+// BlockStorageError is sent on a request's error channel when a block
+// received for the request cannot be read back from where it was held until
+// verified, or cannot be written to the local store once verified.
+type BlockStorageError struct {
+	RequestID gsmsg.GraphSyncRequestID
+	Link      ipld.Link
+	Err       error
+}
+
+func (e BlockStorageError) Error() string {
+	return fmt.Sprintf("Request Failed - Unable To Store Block %s: %s", e.Link.String(), e.Err.Error())
+}
+
+// NoActiveRequestError is returned when loading a link for a request that is
+// no longer receiving responses, and the link is not available locally.
+type NoActiveRequestError struct {
+	RequestID gsmsg.GraphSyncRequestID
+	Link      ipld.Link
+}
+
+func (e NoActiveRequestError) Error() string {
+	return "No active request"
+}
@@ -2,18 +2,24 @@ package requestmanager
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"math"
+	"sync"
+	"time"
 
 	"github.com/ipfs/go-block-format"
 	ipldbridge "github.com/ipfs/go-graphsync/ipldbridge"
 	gsmsg "github.com/ipfs/go-graphsync/message"
 	"github.com/ipfs/go-graphsync/metadata"
+	"github.com/ipfs/go-graphsync/requestcontext"
 	"github.com/ipfs/go-graphsync/requestmanager/loader"
+	"github.com/ipfs/go-graphsync/requestmanager/requesterrors"
 	"github.com/ipfs/go-graphsync/requestmanager/types"
 	logging "github.com/ipfs/go-log"
 	"github.com/ipld/go-ipld-prime"
 	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 var log = logging.Logger("graphsync")
@@ -21,13 +27,127 @@ var log = logging.Logger("graphsync")
 const (
 	// maxPriority is the max priority as defined by the bitswap protocol
 	maxPriority = gsmsg.GraphSyncPriority(math.MaxInt32)
+	// defaultBusyRetryAfter is how long to wait before retrying a request a
+	// busy responder refused without saying when to try again
+	defaultBusyRetryAfter = time.Second
+	// defaultMessageBufferSize is how many incoming messages are buffered
+	// before callers block
+	defaultMessageBufferSize = 16
 )
 
 type inProgressRequestStatus struct {
-	ctx          context.Context
-	cancelFn     func()
-	p            peer.ID
-	networkError chan error
+	ctx           context.Context
+	cancelFn      func()
+	request       gsmsg.GraphSyncRequest
+	peers         []peer.ID
+	failoverPeers []peer.ID
+	busyRetries   int
+	// followAdditionalPeers adds peers responders point to as failover peers,
+	// unless the request has already been sent to them
+	followAdditionalPeers bool
+	seenPeers             map[peer.ID]struct{}
+	networkError          chan error
+	notices               chan error
+	stallTimeout          time.Duration
+	lastProgress          time.Time
+	isPaused              bool
+	result                RequestResult
+	// links reported missing, and by which peers, that have not yet been
+	// reported missing by every peer responding to the request
+	missingFrom map[ipld.Link]map[peer.ID]struct{}
+	isMissing   map[ipld.Link]struct{}
+	// the last peer to report each link missing, read by the traversal when
+	// it reports missing blocks
+	missingBlockPeersLk sync.Mutex
+	missingBlockPeers   map[ipld.Link]peer.ID
+}
+
+func (rs *inProgressRequestStatus) hasPeer(p peer.ID) bool {
+	for _, rp := range rs.peers {
+		if rp == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (rs *inProgressRequestStatus) addFailoverPeer(p peer.ID) {
+	if _, ok := rs.seenPeers[p]; ok {
+		return
+	}
+	rs.seenPeers[p] = struct{}{}
+	rs.failoverPeers = append(rs.failoverPeers, p)
+}
+
+func (rs *inProgressRequestStatus) removePeer(p peer.ID) {
+	for i, rp := range rs.peers {
+		if rp == p {
+			rs.peers = append(rs.peers[:i], rs.peers[i+1:]...)
+			return
+		}
+	}
+}
+
+// recordMissingLink notes that the given peer does not have the block for a
+// link, and returns true once no peer responding to the request has it
+func (rs *inProgressRequestStatus) recordMissingLink(p peer.ID, link ipld.Link) bool {
+	if _, ok := rs.isMissing[link]; ok {
+		return false
+	}
+	missingFrom, ok := rs.missingFrom[link]
+	if !ok {
+		missingFrom = make(map[peer.ID]struct{})
+		rs.missingFrom[link] = missingFrom
+	}
+	missingFrom[p] = struct{}{}
+	rs.missingBlockPeersLk.Lock()
+	rs.missingBlockPeers[link] = p
+	rs.missingBlockPeersLk.Unlock()
+	return rs.checkMissingLink(link)
+}
+
+// addErrorDetails fills in what the request knows about an error loading a
+// link, such as which peer is missing the block
+func (rs *inProgressRequestStatus) addErrorDetails(err error) error {
+	missingBlockErr, ok := err.(requesterrors.MissingBlockError)
+	if !ok {
+		return err
+	}
+	rs.missingBlockPeersLk.Lock()
+	missingBlockErr.Peer = rs.missingBlockPeers[missingBlockErr.Link]
+	rs.missingBlockPeersLk.Unlock()
+	return missingBlockErr
+}
+
+func (rs *inProgressRequestStatus) checkMissingLink(link ipld.Link) bool {
+	// a peer we fail over to may still have it
+	if len(rs.failoverPeers) > 0 {
+		return false
+	}
+	missingFrom := rs.missingFrom[link]
+	for _, rp := range rs.peers {
+		if _, ok := missingFrom[rp]; !ok {
+			return false
+		}
+	}
+	delete(rs.missingFrom, link)
+	rs.isMissing[link] = struct{}{}
+	rs.result.MissingLinks = append(rs.result.MissingLinks, link)
+	return true
+}
+
+// RequestResult is the outcome of a request as reported by the responder
+type RequestResult struct {
+	// Status is the terminal status the responder sent, or zero if the request
+	// ended before one was received
+	Status gsmsg.GraphSyncResponseStatusCode
+	// MissingLinks are the links the responder reported it did not have
+	MissingLinks []ipld.Link
+	// Extensions is the extension data the responder sent with the response
+	Extensions []gsmsg.GraphSyncExtension
+	// AdditionalPeers are other peers the responder said may be able to
+	// satisfy the request
+	AdditionalPeers []pstore.PeerInfo
 }
 
 // PeerHandler is an interface that can send requests to peers
@@ -35,13 +155,19 @@ type PeerHandler interface {
 	SendRequest(p peer.ID, graphSyncRequest gsmsg.GraphSyncRequest)
 }
 
+// AddressBook is an interface that records addresses peers can be reached at
+type AddressBook interface {
+	AddAddrs(p peer.ID, addrs []ma.Multiaddr)
+}
+
 // AsyncLoader is an interface for loading links asynchronously, returning
 // results as new responses are processed
 type AsyncLoader interface {
-	StartRequest(requestID gsmsg.GraphSyncRequestID)
-	ProcessResponse(responses map[gsmsg.GraphSyncRequestID]metadata.Metadata,
+	StartRequest(requestID gsmsg.GraphSyncRequestID, priority gsmsg.GraphSyncPriority,
+		loader ipldbridge.ContextLoader, storer ipldbridge.ContextStorer)
+	ProcessResponse(p peer.ID, responses map[gsmsg.GraphSyncRequestID]metadata.Metadata,
 		blks []blocks.Block)
-	AsyncLoad(requestID gsmsg.GraphSyncRequestID, link ipld.Link) <-chan types.AsyncLoadResult
+	AsyncLoad(requestCtx context.Context, requestID gsmsg.GraphSyncRequestID, link ipld.Link, linkCtx ipldbridge.LinkContext) <-chan types.AsyncLoadResult
 	CompleteResponsesFor(requestID gsmsg.GraphSyncRequestID)
 	CleanupRequest(requestID gsmsg.GraphSyncRequestID)
 }
@@ -49,13 +175,18 @@ type AsyncLoader interface {
 // RequestManager tracks outgoing requests and processes incoming reponses
 // to them.
 type RequestManager struct {
-	ctx         context.Context
-	cancel      func()
-	messages    chan requestManagerMessage
-	ipldBridge  ipldbridge.IPLDBridge
-	peerHandler PeerHandler
-	rc          *responseCollector
-	asyncLoader AsyncLoader
+	ctx          context.Context
+	cancel       func()
+	messages     chan requestManagerMessage
+	ipldBridge   ipldbridge.IPLDBridge
+	peerHandler  PeerHandler
+	rc           *responseCollector
+	asyncLoader  AsyncLoader
+	addressBook  AddressBook
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	stopped      chan struct{}
+	traversals   sync.WaitGroup
 	// dont touch out side of run loop
 	nextRequestID             gsmsg.GraphSyncRequestID
 	inProgressRequestStatuses map[gsmsg.GraphSyncRequestID]*inProgressRequestStatus
@@ -65,18 +196,44 @@ type requestManagerMessage interface {
 	handle(rm *RequestManager)
 }
 
+// Option configures a RequestManager
+type Option func(*RequestManager)
+
+// MessageBufferSize sets how many incoming messages the manager buffers before
+// callers block.
+func MessageBufferSize(messageBufferSize int) Option {
+	return func(rm *RequestManager) {
+		rm.messages = make(chan requestManagerMessage, messageBufferSize)
+	}
+}
+
+// UseAddressBook records the addresses of additional peers responders point
+// to, for requests that follow them.
+func UseAddressBook(addressBook AddressBook) Option {
+	return func(rm *RequestManager) {
+		rm.addressBook = addressBook
+	}
+}
+
 // New generates a new request manager from a context, network, and selectorQuerier
-func New(ctx context.Context, asyncLoader AsyncLoader, ipldBridge ipldbridge.IPLDBridge) *RequestManager {
-	ctx, cancel := context.WithCancel(ctx)
-	return &RequestManager{
-		ctx:                       ctx,
-		cancel:                    cancel,
-		ipldBridge:                ipldBridge,
-		asyncLoader:               asyncLoader,
-		rc:                        newResponseCollector(ctx),
-		messages:                  make(chan requestManagerMessage, 16),
+func New(parent context.Context, asyncLoader AsyncLoader, ipldBridge ipldbridge.IPLDBridge, options ...Option) *RequestManager {
+	ctx, cancel := context.WithCancel(parent)
+	rm := &RequestManager{
+		ctx:         ctx,
+		cancel:      cancel,
+		ipldBridge:  ipldBridge,
+		asyncLoader: asyncLoader,
+		// responses and errors are still delivered to callers after Shutdown
+		rc:                        newResponseCollector(parent),
+		messages:                  make(chan requestManagerMessage, defaultMessageBufferSize),
+		shutdown:                  make(chan struct{}),
+		stopped:                   make(chan struct{}),
 		inProgressRequestStatuses: make(map[gsmsg.GraphSyncRequestID]*inProgressRequestStatus),
 	}
+	for _, option := range options {
+		option(rm)
+	}
+	return rm
 }
 
 // SetDelegate specifies who will send messages out to the internet.
@@ -85,29 +242,50 @@ func (rm *RequestManager) SetDelegate(peerHandler PeerHandler) {
 }
 
 type inProgressRequest struct {
-	requestID     gsmsg.GraphSyncRequestID
-	incoming      chan types.ResponseProgress
-	incomingError chan error
+	requestID       gsmsg.GraphSyncRequestID
+	incoming        chan types.ResponseProgress
+	incomingError   chan error
+	incomingNotices chan error
 }
 
 type newRequestMessage struct {
-	p                     peer.ID
+	peers                 []peer.ID
 	selector              ipld.Node
+	options               requestOptions
 	inProgressRequestChan chan<- inProgressRequest
 }
 
 // SendRequest initiates a new GraphSync request to the given peer.
 func (rm *RequestManager) SendRequest(ctx context.Context,
 	p peer.ID,
-	cidRootedSelector ipld.Node) (<-chan types.ResponseProgress, <-chan error) {
+	cidRootedSelector ipld.Node,
+	options ...RequestOption) (<-chan types.ResponseProgress, <-chan error) {
+	return rm.RequestFromPeers(ctx, []peer.ID{p}, cidRootedSelector, options...)
+}
+
+// RequestFromPeers initiates a new GraphSync request, sending it to all of the
+// given peers at once. Blocks are loaded from whichever peer sends them first,
+// and a link is only reported missing once every peer still responding to the
+// request is missing it. The request completes when one peer sends a full
+// response, or fails when every peer has stopped responding.
+func (rm *RequestManager) RequestFromPeers(ctx context.Context,
+	peers []peer.ID,
+	cidRootedSelector ipld.Node,
+	options ...RequestOption) (<-chan types.ResponseProgress, <-chan error) {
+	if rm.isShutdown() {
+		return rm.singleErrorResponse(requesterrors.ErrShutdown)
+	}
+	if len(peers) == 0 {
+		return rm.singleErrorResponse(requesterrors.ErrNoPeers)
+	}
 	if len(rm.ipldBridge.ValidateSelectorSpec(cidRootedSelector)) != 0 {
-		return rm.singleErrorResponse(fmt.Errorf("Invalid Selector Spec"))
+		return rm.singleErrorResponse(requesterrors.ErrInvalidSelector)
 	}
 
 	inProgressRequestChan := make(chan inProgressRequest)
 
 	select {
-	case rm.messages <- &newRequestMessage{p, cidRootedSelector, inProgressRequestChan}:
+	case rm.messages <- &newRequestMessage{peers, cidRootedSelector, collectRequestOptions(options), inProgressRequestChan}:
 	case <-rm.ctx.Done():
 		return rm.emptyResponse()
 	case <-ctx.Done():
@@ -123,6 +301,7 @@ func (rm *RequestManager) SendRequest(ctx context.Context,
 	return rm.rc.collectResponses(ctx,
 		receivedInProgressRequest.incoming,
 		receivedInProgressRequest.incomingError,
+		receivedInProgressRequest.incomingNotices,
 		func() {
 			rm.cancelRequest(receivedInProgressRequest.requestID,
 				receivedInProgressRequest.incoming,
@@ -130,6 +309,15 @@ func (rm *RequestManager) SendRequest(ctx context.Context,
 		})
 }
 
+func (rm *RequestManager) isShutdown() bool {
+	select {
+	case <-rm.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
 func (rm *RequestManager) emptyResponse() (chan types.ResponseProgress, chan error) {
 	ch := make(chan types.ResponseProgress)
 	close(ch)
@@ -175,6 +363,41 @@ func (rm *RequestManager) cancelRequest(requestID gsmsg.GraphSyncRequestID,
 	}
 }
 
+type updateRequestMessage struct {
+	requestID  gsmsg.GraphSyncRequestID
+	extensions []gsmsg.GraphSyncExtension
+	response   chan error
+}
+
+// UpdateRequest sends new extension data to the responder for a request
+// that is in progress.
+func (rm *RequestManager) UpdateRequest(requestID gsmsg.GraphSyncRequestID, extensions ...gsmsg.GraphSyncExtension) error {
+	response := make(chan error, 1)
+	select {
+	case rm.messages <- &updateRequestMessage{requestID, extensions, response}:
+	case <-rm.ctx.Done():
+		return errors.New("Context Cancelled")
+	}
+	select {
+	case err := <-response:
+		return err
+	case <-rm.ctx.Done():
+		return errors.New("Context Cancelled")
+	}
+}
+
+// PauseRequest asks the responder to pause its response to a request that is
+// in progress.
+func (rm *RequestManager) PauseRequest(requestID gsmsg.GraphSyncRequestID) error {
+	return rm.UpdateRequest(requestID, gsmsg.GraphSyncExtension{Name: gsmsg.ExtensionPause, Data: []byte{1}})
+}
+
+// UnpauseRequest asks the responder to resume its response to a request that
+// was paused with PauseRequest.
+func (rm *RequestManager) UnpauseRequest(requestID gsmsg.GraphSyncRequestID) error {
+	return rm.UpdateRequest(requestID, gsmsg.GraphSyncExtension{Name: gsmsg.ExtensionPause, Data: []byte{0}})
+}
+
 type processResponseMessage struct {
 	p         peer.ID
 	responses []gsmsg.GraphSyncResponse
@@ -191,19 +414,114 @@ func (rm *RequestManager) ProcessResponses(p peer.ID, responses []gsmsg.GraphSyn
 	}
 }
 
+type peerDisconnectedMessage struct {
+	p peer.ID
+}
+
+// Disconnected terminates all in progress requests to the given peer, which
+// has disconnected.
+func (rm *RequestManager) Disconnected(p peer.ID) {
+	select {
+	case rm.messages <- &peerDisconnectedMessage{p}:
+	case <-rm.ctx.Done():
+	}
+}
+
+type deliveryFailureMessage struct {
+	p          peer.ID
+	requestIDs []gsmsg.GraphSyncRequestID
+	err        error
+}
+
+// ProcessDeliveryFailure terminates the given requests, which could not be
+// sent to the given peer.
+func (rm *RequestManager) ProcessDeliveryFailure(p peer.ID, requestIDs []gsmsg.GraphSyncRequestID, err error) {
+	select {
+	case rm.messages <- &deliveryFailureMessage{p, requestIDs, err}:
+	case <-rm.ctx.Done():
+	}
+}
+
+type requestTimedOutMessage struct {
+	requestID gsmsg.GraphSyncRequestID
+}
+
+type checkStallMessage struct {
+	requestID gsmsg.GraphSyncRequestID
+}
+
+type retryBusyRequestMessage struct {
+	requestID gsmsg.GraphSyncRequestID
+	p         peer.ID
+}
+
+func (rm *RequestManager) sendTimerMessage(message requestManagerMessage) {
+	select {
+	case rm.messages <- message:
+	case <-rm.ctx.Done():
+	}
+}
+
+func (rm *RequestManager) scheduleStallCheck(requestID gsmsg.GraphSyncRequestID, after time.Duration) {
+	time.AfterFunc(after, func() {
+		rm.sendTimerMessage(&checkStallMessage{requestID})
+	})
+}
+
 // Startup starts processing for the WantManager.
 func (rm *RequestManager) Startup() {
 	go rm.run()
 }
 
-// Shutdown ends processing for the want manager.
-func (rm *RequestManager) Shutdown() {
+type shutdownMessage struct {
+	done chan struct{}
+}
+
+// Shutdown cancels all in progress requests with their peers, failing them
+// with ErrShutdown, and ends processing for the request manager. It returns
+// once the request traversals and the manager have stopped, or the context
+// ends. Requests made after Shutdown fail with ErrShutdown.
+func (rm *RequestManager) Shutdown(ctx context.Context) error {
+	defer rm.cancel()
+	rm.shutdownOnce.Do(func() { close(rm.shutdown) })
+	done := make(chan struct{})
+	select {
+	case rm.messages <- &shutdownMessage{done}:
+	case <-rm.ctx.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+	case <-rm.ctx.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	traversalsDone := make(chan struct{})
+	go func() {
+		rm.traversals.Wait()
+		close(traversalsDone)
+	}()
+	select {
+	case <-traversalsDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 	rm.cancel()
+	select {
+	case <-rm.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (rm *RequestManager) run() {
 	// NOTE: Do not open any streams or connections from anywhere in this
 	// event loop. Really, just don't do anything likely to block.
+	defer close(rm.stopped)
 	defer rm.cleanupInProcessRequests()
 
 	for {
@@ -223,20 +541,34 @@ func (rm *RequestManager) cleanupInProcessRequests() {
 }
 
 type terminateRequestMessage struct {
-	requestID gsmsg.GraphSyncRequestID
+	requestID     gsmsg.GraphSyncRequestID
+	requestStatus *inProgressRequestStatus
+	result        chan<- RequestResult
 }
 
 func (nrm *newRequestMessage) handle(rm *RequestManager) {
 	requestID := rm.nextRequestID
 	rm.nextRequestID++
 
-	inProgressChan, inProgressErr := rm.setupRequest(requestID, nrm.p, nrm.selector)
+	var inProgressChan chan types.ResponseProgress
+	var inProgressErr chan error
+	if rm.isShutdown() {
+		inProgressChan, inProgressErr = rm.singleErrorResponse(requesterrors.ErrShutdown)
+	} else {
+		inProgressChan, inProgressErr = rm.setupRequest(requestID, nrm.peers, nrm.selector, nrm.options)
+	}
+	var inProgressNotices chan error
+	requestStatus, ok := rm.inProgressRequestStatuses[requestID]
+	if ok {
+		inProgressNotices = requestStatus.notices
+	}
 
 	select {
 	case nrm.inProgressRequestChan <- inProgressRequest{
-		requestID:     requestID,
-		incoming:      inProgressChan,
-		incomingError: inProgressErr,
+		requestID:       requestID,
+		incoming:        inProgressChan,
+		incomingError:   inProgressErr,
+		incomingNotices: inProgressNotices,
 	}:
 	case <-rm.ctx.Done():
 	}
@@ -245,6 +577,7 @@ func (nrm *newRequestMessage) handle(rm *RequestManager) {
 func (trm *terminateRequestMessage) handle(rm *RequestManager) {
 	delete(rm.inProgressRequestStatuses, trm.requestID)
 	rm.asyncLoader.CleanupRequest(trm.requestID)
+	trm.result <- trm.requestStatus.result
 }
 
 func (crm *cancelRequestMessage) handle(rm *RequestManager) {
@@ -253,23 +586,153 @@ func (crm *cancelRequestMessage) handle(rm *RequestManager) {
 		return
 	}
 
-	rm.peerHandler.SendRequest(inProgressRequestStatus.p, gsmsg.CancelRequest(crm.requestID))
+	rm.sendToPeers(inProgressRequestStatus, gsmsg.CancelRequest(crm.requestID))
 	delete(rm.inProgressRequestStatuses, crm.requestID)
 	inProgressRequestStatus.cancelFn()
 }
 
+func (sm *shutdownMessage) handle(rm *RequestManager) {
+	for requestID, requestStatus := range rm.inProgressRequestStatuses {
+		rm.sendToPeers(requestStatus, gsmsg.CancelRequest(requestID))
+		rm.terminateWithError(requestID, requestStatus, requesterrors.ErrShutdown)
+	}
+	close(sm.done)
+}
+
+func (urm *updateRequestMessage) handle(rm *RequestManager) {
+	inProgressRequestStatus, ok := rm.inProgressRequestStatuses[urm.requestID]
+	if !ok {
+		urm.response <- errors.New("could not find request")
+		return
+	}
+
+	rm.sendToPeers(inProgressRequestStatus, gsmsg.UpdateRequest(urm.requestID, urm.extensions...))
+	urm.response <- nil
+}
+
+func (pdm *peerDisconnectedMessage) handle(rm *RequestManager) {
+	for requestID, requestStatus := range rm.inProgressRequestStatuses {
+		if !requestStatus.hasPeer(pdm.p) {
+			continue
+		}
+		rm.terminateWithNetworkError(requestID, requestStatus, pdm.p, requesterrors.ErrPeerDisconnected)
+	}
+}
+
+func (dfm *deliveryFailureMessage) handle(rm *RequestManager) {
+	for _, requestID := range dfm.requestIDs {
+		requestStatus, ok := rm.inProgressRequestStatuses[requestID]
+		if !ok || !requestStatus.hasPeer(dfm.p) {
+			continue
+		}
+		rm.terminateWithNetworkError(requestID, requestStatus, dfm.p, dfm.err)
+	}
+}
+
+func (rtm *requestTimedOutMessage) handle(rm *RequestManager) {
+	requestStatus, ok := rm.inProgressRequestStatuses[rtm.requestID]
+	if !ok {
+		return
+	}
+	rm.sendToPeers(requestStatus, gsmsg.CancelRequest(rtm.requestID))
+	rm.terminateWithError(rtm.requestID, requestStatus, requesterrors.ErrTimedOut)
+}
+
+func (csm *checkStallMessage) handle(rm *RequestManager) {
+	requestStatus, ok := rm.inProgressRequestStatuses[csm.requestID]
+	if !ok {
+		return
+	}
+	// a paused responder is not expected to make progress
+	if requestStatus.isPaused {
+		rm.scheduleStallCheck(csm.requestID, requestStatus.stallTimeout)
+		return
+	}
+	sinceProgress := time.Since(requestStatus.lastProgress)
+	if sinceProgress < requestStatus.stallTimeout {
+		rm.scheduleStallCheck(csm.requestID, requestStatus.stallTimeout-sinceProgress)
+		return
+	}
+	rm.sendToPeers(requestStatus, gsmsg.CancelRequest(csm.requestID))
+	rm.terminateWithError(csm.requestID, requestStatus, requesterrors.ErrStalled)
+}
+
+func (rm *RequestManager) sendToPeers(requestStatus *inProgressRequestStatus, request gsmsg.GraphSyncRequest) {
+	for _, p := range requestStatus.peers {
+		rm.peerHandler.SendRequest(p, request)
+	}
+}
+
+func (rbrm *retryBusyRequestMessage) handle(rm *RequestManager) {
+	requestStatus, ok := rm.inProgressRequestStatuses[rbrm.requestID]
+	if !ok || !requestStatus.hasPeer(rbrm.p) {
+		return
+	}
+	requestStatus.lastProgress = time.Now()
+	requestStatus.isPaused = false
+	rm.peerHandler.SendRequest(rbrm.p, requestStatus.request)
+}
+
+// terminateWithNetworkError fails a request because the given peer could not be
+// reached, unless other peers are still responding to it or can take over
+func (rm *RequestManager) terminateWithNetworkError(requestID gsmsg.GraphSyncRequestID, requestStatus *inProgressRequestStatus, p peer.ID, err error) {
+	if len(requestStatus.peers) > 1 || len(requestStatus.failoverPeers) > 0 {
+		rm.removePeer(requestID, requestStatus, p)
+		return
+	}
+	rm.terminateWithError(requestID, requestStatus, requesterrors.NetworkError{Peer: p, RequestID: requestID, Err: err})
+}
+
+// removePeer stops waiting on the given peer for a request, failing over to the
+// next peer when none are left, and reports any links that the remaining peers
+// have all said they are missing
+func (rm *RequestManager) removePeer(requestID gsmsg.GraphSyncRequestID, requestStatus *inProgressRequestStatus, p peer.ID) {
+	requestStatus.removePeer(p)
+	if len(requestStatus.peers) == 0 && len(requestStatus.failoverPeers) > 0 {
+		nextPeer := requestStatus.failoverPeers[0]
+		requestStatus.failoverPeers = requestStatus.failoverPeers[1:]
+		requestStatus.peers = append(requestStatus.peers, nextPeer)
+		rm.peerHandler.SendRequest(nextPeer, requestStatus.request)
+	}
+	var md metadata.Metadata
+	for link := range requestStatus.missingFrom {
+		if requestStatus.checkMissingLink(link) {
+			md = append(md, metadata.Item{Link: link, BlockPresent: false})
+		}
+	}
+	if len(md) > 0 {
+		rm.asyncLoader.ProcessResponse(p, map[gsmsg.GraphSyncRequestID]metadata.Metadata{requestID: md}, nil)
+	}
+}
+
+func (rm *RequestManager) terminateWithError(requestID gsmsg.GraphSyncRequestID, requestStatus *inProgressRequestStatus, err error) {
+	select {
+	case requestStatus.networkError <- err:
+	case <-requestStatus.ctx.Done():
+	}
+	requestStatus.cancelFn()
+	rm.asyncLoader.CompleteResponsesFor(requestID)
+	rm.asyncLoader.CleanupRequest(requestID)
+	delete(rm.inProgressRequestStatuses, requestID)
+}
+
 func (prm *processResponseMessage) handle(rm *RequestManager) {
 	filteredResponses := rm.filterResponsesForPeer(prm.responses, prm.p)
+	rm.processAdditionalPeers(filteredResponses)
 	responseMetadata := metadataForResponses(filteredResponses, rm.ipldBridge)
-	rm.asyncLoader.ProcessResponse(responseMetadata, prm.blks)
-	rm.processTerminations(filteredResponses)
+	rm.filterMissingLinks(responseMetadata, prm.p)
+	rm.asyncLoader.ProcessResponse(prm.p, responseMetadata, prm.blks)
+	rm.recordProgress(filteredResponses)
+	rm.recordResults(filteredResponses)
+	rm.processPauses(filteredResponses)
+	rm.processTerminations(filteredResponses, prm.p)
 }
 
 func (rm *RequestManager) filterResponsesForPeer(responses []gsmsg.GraphSyncResponse, p peer.ID) []gsmsg.GraphSyncResponse {
 	responsesForPeer := make([]gsmsg.GraphSyncResponse, 0, len(responses))
 	for _, response := range responses {
 		requestStatus, ok := rm.inProgressRequestStatuses[response.RequestID()]
-		if !ok || requestStatus.p != p {
+		if !ok || !requestStatus.hasPeer(p) {
 			continue
 		}
 		responsesForPeer = append(responsesForPeer, response)
@@ -277,56 +740,186 @@ func (rm *RequestManager) filterResponsesForPeer(responses []gsmsg.GraphSyncResp
 	return responsesForPeer
 }
 
-func (rm *RequestManager) processTerminations(responses []gsmsg.GraphSyncResponse) {
+func (rm *RequestManager) recordProgress(responses []gsmsg.GraphSyncResponse) {
+	now := time.Now()
+	for _, response := range responses {
+		requestStatus := rm.inProgressRequestStatuses[response.RequestID()]
+		requestStatus.lastProgress = now
+		requestStatus.isPaused = response.Status() == gsmsg.RequestPaused
+	}
+}
+
+// filterMissingLinks holds back links a peer is missing until no peer
+// responding to the request has the block for them
+func (rm *RequestManager) filterMissingLinks(responseMetadata map[gsmsg.GraphSyncRequestID]metadata.Metadata, p peer.ID) {
+	for requestID, md := range responseMetadata {
+		requestStatus := rm.inProgressRequestStatuses[requestID]
+		filteredMetadata := make(metadata.Metadata, 0, len(md))
+		for _, item := range md {
+			if item.BlockPresent || requestStatus.recordMissingLink(p, item.Link) {
+				filteredMetadata = append(filteredMetadata, item)
+			}
+		}
+		responseMetadata[requestID] = filteredMetadata
+	}
+}
+
+func (rm *RequestManager) processAdditionalPeers(responses []gsmsg.GraphSyncResponse) {
+	for _, response := range responses {
+		requestStatus := rm.inProgressRequestStatuses[response.RequestID()]
+		if !requestStatus.followAdditionalPeers {
+			continue
+		}
+		additionalPeers, _ := response.AdditionalPeers()
+		for _, pi := range additionalPeers {
+			if rm.addressBook != nil && len(pi.Addrs) > 0 {
+				rm.addressBook.AddAddrs(pi.ID, pi.Addrs)
+			}
+			requestStatus.addFailoverPeer(pi.ID)
+		}
+	}
+}
+
+func (rm *RequestManager) recordResults(responses []gsmsg.GraphSyncResponse) {
 	for _, response := range responses {
+		result := &rm.inProgressRequestStatuses[response.RequestID()].result
+		result.Extensions = append(result.Extensions, response.Extensions()...)
+		additionalPeers, _ := response.AdditionalPeers()
+		result.AdditionalPeers = append(result.AdditionalPeers, additionalPeers...)
 		if gsmsg.IsTerminalResponseCode(response.Status()) {
-			if gsmsg.IsTerminalFailureCode(response.Status()) {
-				requestStatus := rm.inProgressRequestStatuses[response.RequestID()]
-				responseError := rm.generateResponseErrorFromStatus(response.Status())
-				select {
-				case requestStatus.networkError <- responseError:
-				case <-requestStatus.ctx.Done():
-				}
-				requestStatus.cancelFn()
+			result.Status = response.Status()
+		}
+	}
+}
+
+func (rm *RequestManager) processPauses(responses []gsmsg.GraphSyncResponse) {
+	for _, response := range responses {
+		if response.Status() != gsmsg.RequestPaused {
+			continue
+		}
+		requestStatus := rm.inProgressRequestStatuses[response.RequestID()]
+		// a notice that has not been read yet already says the request is paused
+		select {
+		case requestStatus.notices <- types.ErrRequestPaused:
+		default:
+		}
+	}
+}
+
+func (rm *RequestManager) processTerminations(responses []gsmsg.GraphSyncResponse, p peer.ID) {
+	for _, response := range responses {
+		if !gsmsg.IsTerminalResponseCode(response.Status()) {
+			continue
+		}
+		requestStatus := rm.inProgressRequestStatuses[response.RequestID()]
+		_, isRedirected := response.AdditionalPeers()
+		canFailover := isFailoverStatus(response.Status()) || (isRedirected && requestStatus.followAdditionalPeers)
+		// any other peer may still have what this one did not
+		if response.Status() != gsmsg.RequestCompletedFull &&
+			(len(requestStatus.peers) > 1 || (canFailover && len(requestStatus.failoverPeers) > 0)) {
+			rm.removePeer(response.RequestID(), requestStatus, p)
+			continue
+		}
+		if response.Status() == gsmsg.RequestFailedBusy && requestStatus.busyRetries > 0 {
+			rm.retryBusyRequest(response, requestStatus, p)
+			continue
+		}
+		if gsmsg.IsTerminalFailureCode(response.Status()) {
+			retryAfter, _ := response.RetryAfter()
+			responseError := requesterrors.RequestFailedError{
+				Peer:       p,
+				RequestID:  response.RequestID(),
+				Status:     response.Status(),
+				RetryAfter: retryAfter,
 			}
-			rm.asyncLoader.CompleteResponsesFor(response.RequestID())
-			delete(rm.inProgressRequestStatuses, response.RequestID())
+			select {
+			case requestStatus.networkError <- responseError:
+			case <-requestStatus.ctx.Done():
+			}
+			requestStatus.cancelFn()
 		}
+		requestStatus.removePeer(p)
+		rm.sendToPeers(requestStatus, gsmsg.CancelRequest(response.RequestID()))
+		rm.asyncLoader.CompleteResponsesFor(response.RequestID())
+		delete(rm.inProgressRequestStatuses, response.RequestID())
+	}
+}
+
+// retryBusyRequest sends a request again once a busy peer's backoff has
+// passed. The request counts as paused until then, so it does not stall.
+func (rm *RequestManager) retryBusyRequest(response gsmsg.GraphSyncResponse, requestStatus *inProgressRequestStatus, p peer.ID) {
+	requestStatus.busyRetries--
+	requestStatus.isPaused = true
+	retryAfter, ok := response.RetryAfter()
+	if !ok {
+		retryAfter = defaultBusyRetryAfter
 	}
+	requestID := response.RequestID()
+	time.AfterFunc(retryAfter, func() {
+		rm.sendTimerMessage(&retryBusyRequestMessage{requestID, p})
+	})
 }
 
-func (rm *RequestManager) generateResponseErrorFromStatus(status gsmsg.GraphSyncResponseStatusCode) error {
+func isFailoverStatus(status gsmsg.GraphSyncResponseStatusCode) bool {
 	switch status {
-	case gsmsg.RequestFailedBusy:
-		return fmt.Errorf("Request Failed - Peer Is Busy")
-	case gsmsg.RequestFailedContentNotFound:
-		return fmt.Errorf("Request Failed - Content Not Found")
-	case gsmsg.RequestFailedLegal:
-		return fmt.Errorf("Request Failed - For Legal Reasons")
-	case gsmsg.RequestFailedUnknown:
-		return fmt.Errorf("Request Failed - Unknown Reason")
+	case gsmsg.RequestCompletedPartial, gsmsg.RequestFailedBusy, gsmsg.RequestFailedContentNotFound:
+		return true
 	default:
-		return fmt.Errorf("Unknown")
+		return false
 	}
 }
 
-func (rm *RequestManager) setupRequest(requestID gsmsg.GraphSyncRequestID, p peer.ID, selectorSpec ipld.Node) (chan types.ResponseProgress, chan error) {
+func (rm *RequestManager) setupRequest(requestID gsmsg.GraphSyncRequestID, peers []peer.ID, selectorSpec ipld.Node, options requestOptions) (chan types.ResponseProgress, chan error) {
 	selectorBytes, err := rm.ipldBridge.EncodeNode(selectorSpec)
 	if err != nil {
-		return rm.singleErrorResponse(err)
+		return rm.singleErrorResponse(requesterrors.SelectorSpecError{Err: err})
 	}
 	root, selector, err := rm.ipldBridge.DecodeSelectorSpec(selectorSpec)
 	if err != nil {
-		return rm.singleErrorResponse(err)
+		return rm.singleErrorResponse(requesterrors.SelectorSpecError{Err: err})
 	}
-	networkErrorChan := make(chan error, 1)
 	ctx, cancel := context.WithCancel(rm.ctx)
-	rm.inProgressRequestStatuses[requestID] = &inProgressRequestStatus{
-		ctx, cancel, p, networkErrorChan,
+	// links are loaded and stored in the context of the first peer asked
+	ctx = requestcontext.New(ctx, peers[0], requestID)
+	request := gsmsg.NewRequest(requestID, selectorBytes, options.priority, options.extensions...)
+	requestStatus := &inProgressRequestStatus{
+		ctx:                   ctx,
+		cancelFn:              cancel,
+		request:               request,
+		peers:                 append([]peer.ID(nil), peers...),
+		failoverPeers:         options.failoverPeers,
+		busyRetries:           options.busyRetries,
+		followAdditionalPeers: options.followAdditionalPeers,
+		seenPeers:             make(map[peer.ID]struct{}),
+		networkError:          make(chan error, 1),
+		notices:               make(chan error, 1),
+		stallTimeout:          options.stallTimeout,
+		lastProgress:          time.Now(),
+		missingFrom:           make(map[ipld.Link]map[peer.ID]struct{}),
+		isMissing:             make(map[ipld.Link]struct{}),
+		missingBlockPeers:     make(map[ipld.Link]peer.ID),
+	}
+	for _, p := range peers {
+		requestStatus.seenPeers[p] = struct{}{}
+	}
+	for _, p := range options.failoverPeers {
+		requestStatus.seenPeers[p] = struct{}{}
+	}
+	rm.inProgressRequestStatuses[requestID] = requestStatus
+	rm.asyncLoader.StartRequest(requestID, options.priority, options.loader, options.storer)
+	if options.timeout > 0 {
+		time.AfterFunc(options.timeout, func() {
+			rm.sendTimerMessage(&requestTimedOutMessage{requestID})
+		})
 	}
-	rm.asyncLoader.StartRequest(requestID)
-	rm.peerHandler.SendRequest(p, gsmsg.NewRequest(requestID, selectorBytes, maxPriority))
-	return rm.executeTraversal(ctx, requestID, root, selector, networkErrorChan)
+	if options.stallTimeout > 0 {
+		rm.scheduleStallCheck(requestID, options.stallTimeout)
+	}
+	if options.requestIDCallback != nil {
+		options.requestIDCallback(requestID)
+	}
+	rm.sendToPeers(requestStatus, request)
+	return rm.executeTraversal(ctx, requestID, root, selector, requestStatus, options.resultCallback)
 }
 
 func (rm *RequestManager) executeTraversal(
@@ -334,25 +927,36 @@ func (rm *RequestManager) executeTraversal(
 	requestID gsmsg.GraphSyncRequestID,
 	root ipld.Node,
 	selector ipldbridge.Selector,
-	networkErrorChan chan error,
+	requestStatus *inProgressRequestStatus,
+	resultCallback func(RequestResult),
 ) (chan types.ResponseProgress, chan error) {
 	inProgressChan := make(chan types.ResponseProgress)
 	inProgressErr := make(chan error)
-	loaderFn := loader.WrapAsyncLoader(ctx, rm.asyncLoader.AsyncLoad, requestID, inProgressErr)
+	loaderFn := loader.WrapAsyncLoader(ctx, rm.asyncLoader.AsyncLoad, requestID, inProgressErr, requestStatus.addErrorDetails)
 	visitor := visitToChannel(ctx, inProgressChan)
+	rm.traversals.Add(1)
 	go func() {
+		defer rm.traversals.Done()
 		rm.ipldBridge.Traverse(ctx, loaderFn, root, selector, visitor)
 		select {
-		case networkError := <-networkErrorChan:
+		case networkError := <-requestStatus.networkError:
 			select {
 			case <-rm.ctx.Done():
 			case inProgressErr <- networkError:
 			}
 		default:
 		}
+		result := make(chan RequestResult, 1)
 		select {
-		case <-ctx.Done():
-		case rm.messages <- &terminateRequestMessage{requestID}:
+		case <-rm.ctx.Done():
+		case rm.messages <- &terminateRequestMessage{requestID, requestStatus, result}:
+		}
+		if resultCallback != nil {
+			select {
+			case <-rm.ctx.Done():
+			case requestResult := <-result:
+				resultCallback(requestResult)
+			}
 		}
 		close(inProgressChan)
 		close(inProgressErr)
@@ -2,6 +2,7 @@ package requestmanager
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"sync"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/ipfs/go-graphsync/ipldbridge"
 
+	"github.com/ipfs/go-graphsync/requestmanager/requesterrors"
 	"github.com/ipfs/go-graphsync/requestmanager/types"
 
 	"github.com/ipfs/go-graphsync/metadata"
@@ -24,6 +26,8 @@ import (
 	"github.com/ipfs/go-graphsync/testbridge"
 	"github.com/ipfs/go-graphsync/testutil"
 	"github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 type requestRecord struct {
@@ -43,6 +47,14 @@ func (fph *fakePeerHandler) SendRequest(p peer.ID,
 	}
 }
 
+type fakeAddressBook struct {
+	recordedAddrs chan pstore.PeerInfo
+}
+
+func (fab *fakeAddressBook) AddAddrs(p peer.ID, addrs []ma.Multiaddr) {
+	fab.recordedAddrs <- pstore.PeerInfo{ID: p, Addrs: addrs}
+}
+
 type requestKey struct {
 	requestID gsmsg.GraphSyncRequestID
 	link      ipld.Link
@@ -62,9 +74,10 @@ func newFakeAsyncLoader() *fakeAsyncLoader {
 		blks:             make(chan []blocks.Block, 1),
 	}
 }
-func (fal *fakeAsyncLoader) StartRequest(requestID gsmsg.GraphSyncRequestID) {
+func (fal *fakeAsyncLoader) StartRequest(requestID gsmsg.GraphSyncRequestID, priority gsmsg.GraphSyncPriority,
+	loader ipldbridge.ContextLoader, storer ipldbridge.ContextStorer) {
 }
-func (fal *fakeAsyncLoader) ProcessResponse(responses map[gsmsg.GraphSyncRequestID]metadata.Metadata,
+func (fal *fakeAsyncLoader) ProcessResponse(p peer.ID, responses map[gsmsg.GraphSyncRequestID]metadata.Metadata,
 	blks []blocks.Block) {
 	fal.responses <- responses
 	fal.blks <- blks
@@ -120,7 +133,7 @@ func (fal *fakeAsyncLoader) asyncLoad(requestID gsmsg.GraphSyncRequestID, link i
 	return responseChannel
 }
 
-func (fal *fakeAsyncLoader) AsyncLoad(requestID gsmsg.GraphSyncRequestID, link ipld.Link) <-chan types.AsyncLoadResult {
+func (fal *fakeAsyncLoader) AsyncLoad(requestCtx context.Context, requestID gsmsg.GraphSyncRequestID, link ipld.Link, linkCtx ipldbridge.LinkContext) <-chan types.AsyncLoadResult {
 	return fal.asyncLoad(requestID, link)
 }
 func (fal *fakeAsyncLoader) CompleteResponsesFor(requestID gsmsg.GraphSyncRequestID) {}
@@ -295,6 +308,31 @@ func TestNormalSimultaneousFetch(t *testing.T) {
 	testutil.VerifyEmptyErrors(requestCtx, t, returnedErrorChan2)
 }
 
+func TestRequestPriority(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(1)
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	priority := gsmsg.GraphSyncPriority(7)
+	requestManager.SendRequest(requestCtx, peers[0], s, WithPriority(priority))
+
+	rr := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+	if rr.gsr.Priority() != priority {
+		t.Fatal("did not send request with requested priority")
+	}
+}
+
 func TestCancelRequestInProgress(t *testing.T) {
 	requestRecordChan := make(chan requestRecord, 2)
 	fph := &fakePeerHandler{requestRecordChan}
@@ -436,7 +474,13 @@ func TestUnencodableSelector(t *testing.T) {
 	s := testbridge.NewUnencodableSelectorSpec(testutil.GenerateCids(5))
 	returnedResponseChan, returnedErrorChan := requestManager.SendRequest(requestCtx, peers[0], s)
 
-	testutil.VerifySingleTerminalError(requestCtx, t, returnedErrorChan)
+	errs := testutil.CollectErrors(requestCtx, t, returnedErrorChan)
+	if len(errs) != 1 {
+		t.Fatal("should have terminated request with an error")
+	}
+	if _, ok := errs[0].(requesterrors.SelectorSpecError); !ok {
+		t.Fatal("should have terminated request with a selector spec error")
+	}
 	testutil.VerifyEmptyResponse(requestCtx, t, returnedResponseChan)
 }
 
@@ -464,10 +508,184 @@ func TestFailedRequest(t *testing.T) {
 	}
 	requestManager.ProcessResponses(peers[0], failedResponses, nil)
 
-	testutil.VerifySingleTerminalError(requestCtx, t, returnedErrorChan)
+	errs := testutil.CollectErrors(requestCtx, t, returnedErrorChan)
+	if len(errs) != 1 {
+		t.Fatal("should have sent a single error")
+	}
+	requestFailedError, ok := errs[0].(requesterrors.RequestFailedError)
+	if !ok || requestFailedError.Peer != peers[0] ||
+		requestFailedError.RequestID != rr.gsr.ID() ||
+		requestFailedError.Status != gsmsg.RequestFailedContentNotFound {
+		t.Fatal("should have sent request failed error with status")
+	}
 	testutil.VerifyEmptyResponse(requestCtx, t, returnedResponseChan)
 }
 
+func TestRequestFromMultiplePeers(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(2)
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	returnedResponseChan, returnedErrorChan := requestManager.RequestFromPeers(requestCtx, peers, s)
+
+	requestRecords := readNNetworkRequests(requestCtx, t, requestRecordChan, 2)
+	if requestRecords[0].p != peers[0] || requestRecords[1].p != peers[1] ||
+		requestRecords[0].gsr.ID() != requestRecords[1].gsr.ID() {
+		t.Fatal("did not send the same request to all peers")
+	}
+	requestID := requestRecords[0].gsr.ID()
+
+	// the first peer is missing everything, but the second peer may still have it
+	firstResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(requestID, gsmsg.RequestCompletedPartial, encodedMetadataForBlocks(t, fakeIPLDBridge, blocks, false)),
+	}
+	requestManager.ProcessResponses(peers[0], firstResponses, nil)
+	fal.verifyLastProcessedResponses(requestCtx, t, map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		requestID: metadata.Metadata{},
+	})
+	fal.verifyLastProcessedBlocks(requestCtx, t, nil)
+
+	secondResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(requestID, gsmsg.RequestCompletedFull, encodedMetadataForBlocks(t, fakeIPLDBridge, blocks, true)),
+	}
+	requestManager.ProcessResponses(peers[1], secondResponses, blocks)
+	fal.verifyLastProcessedResponses(requestCtx, t, map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		requestID: metadataForBlocks(blocks, true),
+	})
+	fal.verifyLastProcessedBlocks(requestCtx, t, blocks)
+	fal.successResponseOn(requestID, blocks)
+
+	responses := testutil.CollectResponses(requestCtx, t, returnedResponseChan)
+	verifyMatchedResponses(t, responses, blocks)
+	testutil.VerifyEmptyErrors(requestCtx, t, returnedErrorChan)
+}
+
+func TestRequestFromMultiplePeersAllFail(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(2)
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	returnedResponseChan, returnedErrorChan := requestManager.RequestFromPeers(requestCtx, peers, s)
+
+	requestID := readNNetworkRequests(requestCtx, t, requestRecordChan, 2)[0].gsr.ID()
+
+	noMetadata := encodedMetadataForBlocks(t, fakeIPLDBridge, nil, true)
+	firstResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(requestID, gsmsg.PartialResponse, encodedMetadataForBlocks(t, fakeIPLDBridge, blocks[:1], false)),
+	}
+	requestManager.ProcessResponses(peers[1], firstResponses, nil)
+	fal.verifyLastProcessedResponses(requestCtx, t, map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		requestID: metadata.Metadata{},
+	})
+	fal.verifyLastProcessedBlocks(requestCtx, t, nil)
+
+	// once the first peer is done, what the second peer is missing is missing
+	secondResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(requestID, gsmsg.RequestCompletedPartial, noMetadata),
+	}
+	requestManager.ProcessResponses(peers[0], secondResponses, nil)
+	fal.verifyLastProcessedResponses(requestCtx, t, map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		requestID: metadata.Metadata{},
+	})
+	fal.verifyLastProcessedBlocks(requestCtx, t, nil)
+	fal.verifyLastProcessedResponses(requestCtx, t, map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		requestID: metadataForBlocks(blocks[:1], false),
+	})
+	fal.verifyLastProcessedBlocks(requestCtx, t, nil)
+
+	thirdResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(requestID, gsmsg.RequestFailedBusy, noMetadata),
+	}
+	requestManager.ProcessResponses(peers[1], thirdResponses, nil)
+
+	errs := testutil.CollectErrors(requestCtx, t, returnedErrorChan)
+	if len(errs) != 1 {
+		t.Fatal("should have sent a single error")
+	}
+	requestFailedError, ok := errs[0].(requesterrors.RequestFailedError)
+	if !ok || requestFailedError.Status != gsmsg.RequestFailedBusy || requestFailedError.Peer != peers[1] {
+		t.Fatal("did not fail with the last peer's status")
+	}
+	testutil.VerifyEmptyResponse(requestCtx, t, returnedResponseChan)
+}
+
+func TestFailoverToAlternatePeer(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(2)
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	returnedResponseChan, returnedErrorChan := requestManager.SendRequest(requestCtx, peers[0], s, WithFailoverPeers(peers[1]))
+
+	rr := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+
+	// the first peer only has some of the blocks, so fail over for the rest
+	md := append(metadataForBlocks(blocks[:2], true), metadataForBlocks(blocks[2:], false)...)
+	mdEncoded, err := metadata.EncodeMetadata(md, fakeIPLDBridge)
+	if err != nil {
+		t.Fatal("did not encode metadata")
+	}
+	firstResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(rr.gsr.ID(), gsmsg.RequestCompletedPartial, mdEncoded),
+	}
+	requestManager.ProcessResponses(peers[0], firstResponses, blocks[:2])
+	fal.verifyLastProcessedResponses(requestCtx, t, map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		rr.gsr.ID(): metadataForBlocks(blocks[:2], true),
+	})
+	fal.verifyLastProcessedBlocks(requestCtx, t, blocks[:2])
+
+	failoverRecord := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+	if failoverRecord.p != peers[1] || !reflect.DeepEqual(failoverRecord.gsr, rr.gsr) {
+		t.Fatal("did not send request to failover peer")
+	}
+
+	secondResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(rr.gsr.ID(), gsmsg.RequestCompletedFull, encodedMetadataForBlocks(t, fakeIPLDBridge, blocks, true)),
+	}
+	requestManager.ProcessResponses(peers[1], secondResponses, blocks)
+	fal.verifyLastProcessedResponses(requestCtx, t, map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		rr.gsr.ID(): metadataForBlocks(blocks, true),
+	})
+	fal.verifyLastProcessedBlocks(requestCtx, t, blocks)
+	fal.successResponseOn(rr.gsr.ID(), blocks)
+
+	responses := testutil.CollectResponses(requestCtx, t, returnedResponseChan)
+	verifyMatchedResponses(t, responses, blocks)
+	testutil.VerifyEmptyErrors(requestCtx, t, returnedErrorChan)
+}
+
 func TestLocallyFulfilledFirstRequestFailsLater(t *testing.T) {
 	requestRecordChan := make(chan requestRecord, 2)
 	fph := &fakePeerHandler{requestRecordChan}
@@ -565,13 +783,665 @@ func TestRequestReturnsMissingBlocks(t *testing.T) {
 		gsmsg.NewResponse(rr.gsr.ID(), gsmsg.RequestCompletedPartial, md),
 	}
 	requestManager.ProcessResponses(peers[0], firstResponses, nil)
+	fal.verifyLastProcessedResponses(requestCtx, t, map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		rr.gsr.ID(): metadataForBlocks(blocks, false),
+	})
+	fal.verifyLastProcessedBlocks(requestCtx, t, nil)
 	for _, block := range blocks {
-		fal.responseOn(rr.gsr.ID(), cidlink.Link{Cid: block.Cid()}, types.AsyncLoadResult{Data: nil, Err: fmt.Errorf("Terrible Thing")})
+		link := cidlink.Link{Cid: block.Cid()}
+		fal.responseOn(rr.gsr.ID(), link, types.AsyncLoadResult{Data: nil, Err: requesterrors.MissingBlockError{RequestID: rr.gsr.ID(), Link: link}})
 	}
 	testutil.VerifyEmptyResponse(ctx, t, returnedResponseChan)
 	errs := testutil.CollectErrors(ctx, t, returnedErrorChan)
 	if len(errs) != len(blocks) {
 		t.Fatal("did not send all errors")
 	}
+	for _, err := range errs {
+		missingBlockError, ok := err.(requesterrors.MissingBlockError)
+		if !ok || missingBlockError.Peer != peers[0] {
+			t.Fatal("did not report which peer is missing the block")
+		}
+	}
+}
+
+func TestRequestResult(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(1)
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	resultChan := make(chan RequestResult, 1)
+	returnedResponseChan, returnedErrorChan := requestManager.SendRequest(requestCtx, peers[0], s,
+		WithResultCallback(func(result RequestResult) {
+			resultChan <- result
+		}))
+
+	rr := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+
+	presentBlocks := blocks[:3]
+	missingBlocks := blocks[3:]
+	md := append(metadataForBlocks(presentBlocks, true), metadataForBlocks(missingBlocks, false)...)
+	mdEncoded, err := metadata.EncodeMetadata(md, fakeIPLDBridge)
+	if err != nil {
+		t.Fatal("did not encode metadata")
+	}
+	extension := gsmsg.GraphSyncExtension{
+		Name: gsmsg.GraphSyncExtensionName("graphsync/awesome"),
+		Data: testutil.RandomBytes(100),
+	}
+	firstResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(rr.gsr.ID(), gsmsg.RequestCompletedPartial, mdEncoded, extension),
+	}
+	requestManager.ProcessResponses(peers[0], firstResponses, presentBlocks)
+	fal.successResponseOn(rr.gsr.ID(), presentBlocks)
+	for _, block := range missingBlocks {
+		fal.responseOn(rr.gsr.ID(), cidlink.Link{Cid: block.Cid()}, types.AsyncLoadResult{Data: nil, Err: fmt.Errorf("Terrible Thing")})
+	}
+	responses := testutil.CollectResponses(requestCtx, t, returnedResponseChan)
+	verifyMatchedResponses(t, responses, presentBlocks)
+	errs := testutil.CollectErrors(requestCtx, t, returnedErrorChan)
+	if len(errs) != len(missingBlocks) {
+		t.Fatal("did not send all errors")
+	}
+
+	var result RequestResult
+	select {
+	case <-requestCtx.Done():
+		t.Fatal("did not receive request result")
+	case result = <-resultChan:
+	}
+	if result.Status != gsmsg.RequestCompletedPartial {
+		t.Fatal("did not record terminal status")
+	}
+	if len(result.MissingLinks) != len(missingBlocks) {
+		t.Fatal("did not record missing links")
+	}
+	for i, link := range result.MissingLinks {
+		if link.(cidlink.Link).Cid != missingBlocks[i].Cid() {
+			t.Fatal("recorded wrong missing link")
+		}
+	}
+	if len(result.Extensions) != 1 || !reflect.DeepEqual(result.Extensions[0], extension) {
+		t.Fatal("did not record responder extensions")
+	}
+}
+
+func TestRequestWithExtensions(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(1)
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	extensionName1 := gsmsg.GraphSyncExtensionName("graphsync/awesome")
+	extension1 := gsmsg.GraphSyncExtension{
+		Name: extensionName1,
+		Data: testutil.RandomBytes(100),
+	}
+	extensionName2 := gsmsg.GraphSyncExtensionName("graphsync/even-more-awesome")
+	extension2 := gsmsg.GraphSyncExtension{
+		Name: extensionName2,
+		Data: testutil.RandomBytes(100),
+	}
+	returnedResponseChan, returnedErrorChan := requestManager.SendRequest(requestCtx, peers[0], s, WithExtensions(extension1, extension2))
+
+	rr := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+
+	gsr := rr.gsr
+	returnedData1, found := gsr.Extension(extensionName1)
+	if !found || !reflect.DeepEqual(extension1.Data, returnedData1) {
+		t.Fatal("Failed to encode first extension")
+	}
+
+	returnedData2, found := gsr.Extension(extensionName2)
+	if !found || !reflect.DeepEqual(extension2.Data, returnedData2) {
+		t.Fatal("Failed to encode second extension")
+	}
+
+	md := encodedMetadataForBlocks(t, fakeIPLDBridge, blocks, true)
+	firstResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(gsr.ID(), gsmsg.RequestCompletedFull, md),
+	}
+	requestManager.ProcessResponses(peers[0], firstResponses, blocks)
+	fal.successResponseOn(gsr.ID(), blocks)
+	testutil.CollectResponses(requestCtx, t, returnedResponseChan)
+	testutil.VerifyEmptyErrors(requestCtx, t, returnedErrorChan)
+}
+
+func TestPausedResponse(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(1)
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	returnedResponseChan, returnedErrorChan := requestManager.SendRequest(requestCtx, peers[0], s)
+
+	rr := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
 
+	firstBlocks := blocks[:2]
+	firstResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(rr.gsr.ID(), gsmsg.RequestPaused, encodedMetadataForBlocks(t, fakeIPLDBridge, firstBlocks, true)),
+	}
+	requestManager.ProcessResponses(peers[0], firstResponses, firstBlocks)
+	fal.successResponseOn(rr.gsr.ID(), firstBlocks)
+
+	responses := testutil.ReadNResponses(requestCtx, t, returnedResponseChan, 2)
+	verifyMatchedResponses(t, responses, firstBlocks)
+	select {
+	case <-requestCtx.Done():
+		t.Fatal("should have notified request was paused")
+	case err := <-returnedErrorChan:
+		if err != types.ErrRequestPaused {
+			t.Fatal("should have sent paused notice")
+		}
+	}
+
+	moreBlocks := blocks[2:]
+	moreResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(rr.gsr.ID(), gsmsg.RequestCompletedFull, encodedMetadataForBlocks(t, fakeIPLDBridge, moreBlocks, true)),
+	}
+	requestManager.ProcessResponses(peers[0], moreResponses, moreBlocks)
+	fal.successResponseOn(rr.gsr.ID(), moreBlocks)
+
+	responses = testutil.CollectResponses(requestCtx, t, returnedResponseChan)
+	verifyMatchedResponses(t, responses, moreBlocks)
+	testutil.VerifyEmptyErrors(requestCtx, t, returnedErrorChan)
+}
+
+func TestPauseAndUpdateRequest(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(1)
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	var requestID gsmsg.GraphSyncRequestID
+	returnedResponseChan, returnedErrorChan := requestManager.SendRequest(requestCtx, peers[0], s,
+		WithRequestIDCallback(func(id gsmsg.GraphSyncRequestID) { requestID = id }))
+
+	rr := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+	if rr.gsr.ID() != requestID {
+		t.Fatal("Did not report request id for request")
+	}
+
+	err := requestManager.PauseRequest(requestID)
+	if err != nil {
+		t.Fatal("Should be able to pause in progress request")
+	}
+	rr = readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+	pauseData, has := rr.gsr.Extension(gsmsg.ExtensionPause)
+	if rr.p != peers[0] || rr.gsr.ID() != requestID || !rr.gsr.IsUpdate() ||
+		!has || !reflect.DeepEqual(pauseData, []byte{1}) {
+		t.Fatal("Did not send pause update to peer")
+	}
+
+	err = requestManager.UnpauseRequest(requestID)
+	if err != nil {
+		t.Fatal("Should be able to unpause in progress request")
+	}
+	rr = readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+	pauseData, has = rr.gsr.Extension(gsmsg.ExtensionPause)
+	if !rr.gsr.IsUpdate() || !has || !reflect.DeepEqual(pauseData, []byte{0}) {
+		t.Fatal("Did not send unpause update to peer")
+	}
+
+	extension := gsmsg.GraphSyncExtension{
+		Name: gsmsg.GraphSyncExtensionName("graphsync/awesome"),
+		Data: testutil.RandomBytes(100),
+	}
+	err = requestManager.UpdateRequest(requestID, extension)
+	if err != nil {
+		t.Fatal("Should be able to update in progress request")
+	}
+	rr = readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+	extensionData, has := rr.gsr.Extension(extension.Name)
+	if !rr.gsr.IsUpdate() || !has || !reflect.DeepEqual(extensionData, extension.Data) {
+		t.Fatal("Did not send extension update to peer")
+	}
+
+	responses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(requestID, gsmsg.RequestCompletedFull, encodedMetadataForBlocks(t, fakeIPLDBridge, blocks, true)),
+	}
+	requestManager.ProcessResponses(peers[0], responses, blocks)
+	fal.successResponseOn(requestID, blocks)
+	testutil.CollectResponses(requestCtx, t, returnedResponseChan)
+	testutil.VerifyEmptyErrors(requestCtx, t, returnedErrorChan)
+
+	err = requestManager.PauseRequest(requestID)
+	if err == nil {
+		t.Fatal("Should not be able to pause completed request")
+	}
+}
+
+func TestDisconnectedPeerTerminatesRequests(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(2)
+
+	blocks1 := testutil.GenerateBlocksOfSize(5, 100)
+	s1 := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks1))
+	blocks2 := testutil.GenerateBlocksOfSize(5, 100)
+	s2 := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks2))
+
+	returnedResponseChan1, returnedErrorChan1 := requestManager.SendRequest(requestCtx, peers[0], s1)
+	returnedResponseChan2, returnedErrorChan2 := requestManager.SendRequest(requestCtx, peers[1], s2)
+
+	requestRecords := readNNetworkRequests(requestCtx, t, requestRecordChan, 2)
+
+	requestManager.Disconnected(peers[0])
+
+	errs := testutil.CollectErrors(requestCtx, t, returnedErrorChan1)
+	if len(errs) != 1 {
+		t.Fatal("should have terminated request with an error")
+	}
+	networkError, ok := errs[0].(requesterrors.NetworkError)
+	if !ok || networkError.Peer != peers[0] ||
+		networkError.RequestID != requestRecords[0].gsr.ID() ||
+		networkError.Err != requesterrors.ErrPeerDisconnected {
+		t.Fatal("should have terminated request with a network error")
+	}
+	testutil.VerifyEmptyResponse(requestCtx, t, returnedResponseChan1)
+
+	// requests to other peers are unaffected
+	responses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(requestRecords[1].gsr.ID(), gsmsg.RequestCompletedFull, encodedMetadataForBlocks(t, fakeIPLDBridge, blocks2, true)),
+	}
+	requestManager.ProcessResponses(peers[1], responses, blocks2)
+	fal.successResponseOn(requestRecords[1].gsr.ID(), blocks2)
+	verifyMatchedResponses(t, testutil.CollectResponses(requestCtx, t, returnedResponseChan2), blocks2)
+	testutil.VerifyEmptyErrors(requestCtx, t, returnedErrorChan2)
+}
+
+func TestDeliveryFailureTerminatesRequests(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(1)
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	returnedResponseChan, returnedErrorChan := requestManager.SendRequest(requestCtx, peers[0], s)
+
+	rr := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+
+	sendError := errors.New("unable to send")
+	requestManager.ProcessDeliveryFailure(peers[0], []gsmsg.GraphSyncRequestID{rr.gsr.ID()}, sendError)
+
+	errs := testutil.CollectErrors(requestCtx, t, returnedErrorChan)
+	if len(errs) != 1 {
+		t.Fatal("should have terminated request with an error")
+	}
+	networkError, ok := errs[0].(requesterrors.NetworkError)
+	if !ok || networkError.Peer != peers[0] || networkError.RequestID != rr.gsr.ID() ||
+		networkError.Err != sendError {
+		t.Fatal("should have terminated request with a network error")
+	}
+	testutil.VerifyEmptyResponse(requestCtx, t, returnedResponseChan)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(1)
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	returnedResponseChan, returnedErrorChan := requestManager.SendRequest(requestCtx, peers[0], s,
+		WithTimeout(20*time.Millisecond))
+
+	rr := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+
+	// progress does not extend the deadline
+	firstBlocks := blocks[:2]
+	firstResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(rr.gsr.ID(), gsmsg.PartialResponse, encodedMetadataForBlocks(t, fakeIPLDBridge, firstBlocks, true)),
+	}
+	requestManager.ProcessResponses(peers[0], firstResponses, firstBlocks)
+	fal.successResponseOn(rr.gsr.ID(), firstBlocks)
+
+	responses := testutil.CollectResponses(requestCtx, t, returnedResponseChan)
+	verifyMatchedResponses(t, responses, firstBlocks)
+	errs := testutil.CollectErrors(requestCtx, t, returnedErrorChan)
+	if len(errs) != 1 || errs[0] != requesterrors.ErrTimedOut {
+		t.Fatal("should have terminated request with timeout error")
+	}
+
+	cancelRecord := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+	if !cancelRecord.gsr.IsCancel() || cancelRecord.gsr.ID() != rr.gsr.ID() {
+		t.Fatal("should have sent cancel request to peer")
+	}
+}
+
+func TestShutdownCancelsRequests(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(1)
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	returnedResponseChan, returnedErrorChan := requestManager.SendRequest(requestCtx, peers[0], s)
+
+	rr := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- requestManager.Shutdown(requestCtx)
+	}()
+
+	responses := testutil.CollectResponses(requestCtx, t, returnedResponseChan)
+	if len(responses) != 0 {
+		t.Fatal("should not have received responses")
+	}
+	errs := testutil.CollectErrors(requestCtx, t, returnedErrorChan)
+	if len(errs) != 1 || errs[0] != requesterrors.ErrShutdown {
+		t.Fatal("should have terminated request with shutdown error")
+	}
+
+	cancelRecord := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+	if !cancelRecord.gsr.IsCancel() || cancelRecord.gsr.ID() != rr.gsr.ID() {
+		t.Fatal("should have sent cancel request to peer")
+	}
+
+	select {
+	case <-requestCtx.Done():
+		t.Fatal("shutdown did not complete")
+	case err := <-shutdownErr:
+		if err != nil {
+			t.Fatal("shutdown should have completed without error")
+		}
+	}
+
+	_, returnedErrorChan = requestManager.SendRequest(requestCtx, peers[0], s)
+	errs = testutil.CollectErrors(requestCtx, t, returnedErrorChan)
+	if len(errs) != 1 || errs[0] != requesterrors.ErrShutdown {
+		t.Fatal("should not accept requests after shutting down")
+	}
+}
+
+func TestStalledRequest(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(1)
+	stallTimeout := 20 * time.Millisecond
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	returnedResponseChan, returnedErrorChan := requestManager.SendRequest(requestCtx, peers[0], s,
+		WithStallTimeout(stallTimeout))
+
+	rr := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+
+	// a paused request does not stall
+	firstBlocks := blocks[:2]
+	firstResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(rr.gsr.ID(), gsmsg.RequestPaused, encodedMetadataForBlocks(t, fakeIPLDBridge, firstBlocks, true)),
+	}
+	requestManager.ProcessResponses(peers[0], firstResponses, firstBlocks)
+	fal.verifyLastProcessedBlocks(requestCtx, t, firstBlocks)
+	fal.verifyLastProcessedResponses(requestCtx, t, map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		rr.gsr.ID(): metadataForBlocks(firstBlocks, true),
+	})
+	fal.successResponseOn(rr.gsr.ID(), firstBlocks)
+
+	responses := testutil.ReadNResponses(requestCtx, t, returnedResponseChan, 2)
+	verifyMatchedResponses(t, responses, firstBlocks)
+	select {
+	case <-requestCtx.Done():
+		t.Fatal("should have notified request was paused")
+	case err := <-returnedErrorChan:
+		if err != types.ErrRequestPaused {
+			t.Fatal("should have sent paused notice")
+		}
+	}
+	select {
+	case <-requestCtx.Done():
+		t.Fatal("request context ended")
+	case <-returnedErrorChan:
+		t.Fatal("paused request should not stall")
+	case <-time.After(4 * stallTimeout):
+	}
+
+	// after resuming, a request with no progress stalls
+	moreBlocks := blocks[2:3]
+	moreResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(rr.gsr.ID(), gsmsg.PartialResponse, encodedMetadataForBlocks(t, fakeIPLDBridge, moreBlocks, true)),
+	}
+	requestManager.ProcessResponses(peers[0], moreResponses, moreBlocks)
+	fal.successResponseOn(rr.gsr.ID(), moreBlocks)
+
+	responses = testutil.CollectResponses(requestCtx, t, returnedResponseChan)
+	verifyMatchedResponses(t, responses, moreBlocks)
+	errs := testutil.CollectErrors(requestCtx, t, returnedErrorChan)
+	if len(errs) != 1 || errs[0] != requesterrors.ErrStalled {
+		t.Fatal("should have terminated request with stalled error")
+	}
+
+	cancelRecord := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+	if !cancelRecord.gsr.IsCancel() || cancelRecord.gsr.ID() != rr.gsr.ID() {
+		t.Fatal("should have sent cancel request to peer")
+	}
+}
+
+func TestBusyRequestRetries(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	requestManager := New(ctx, fal, fakeIPLDBridge)
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(1)
+	retryAfter := 20 * time.Millisecond
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	returnedResponseChan, returnedErrorChan := requestManager.SendRequest(requestCtx, peers[0], s,
+		WithBusyRetries(1))
+
+	rr := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+	busyResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(rr.gsr.ID(), gsmsg.RequestFailedBusy, nil, gsmsg.RetryAfterExtension(retryAfter)),
+	}
+	requestManager.ProcessResponses(peers[0], busyResponses, nil)
+	fal.verifyLastProcessedBlocks(requestCtx, t, nil)
+	fal.verifyLastProcessedResponses(requestCtx, t, map[gsmsg.GraphSyncRequestID]metadata.Metadata{})
+	sentAt := time.Now()
+
+	retryRecord := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+	if time.Since(sentAt) < retryAfter/2 {
+		t.Fatal("did not wait for backoff before retrying")
+	}
+	if retryRecord.p != peers[0] || !reflect.DeepEqual(retryRecord.gsr, rr.gsr) {
+		t.Fatal("did not send request again after backoff")
+	}
+
+	// out of retries, the request fails with the hint
+	requestManager.ProcessResponses(peers[0], busyResponses, nil)
+
+	errs := testutil.CollectErrors(requestCtx, t, returnedErrorChan)
+	if len(errs) != 1 {
+		t.Fatal("should have sent a single error")
+	}
+	requestFailedError, ok := errs[0].(requesterrors.RequestFailedError)
+	if !ok || requestFailedError.Status != gsmsg.RequestFailedBusy ||
+		requestFailedError.RetryAfter != retryAfter {
+		t.Fatal("should have sent busy error with retry after hint")
+	}
+	testutil.VerifyEmptyResponse(requestCtx, t, returnedResponseChan)
+}
+
+func TestFollowAdditionalPeers(t *testing.T) {
+	requestRecordChan := make(chan requestRecord, 2)
+	fph := &fakePeerHandler{requestRecordChan}
+	fakeIPLDBridge := testbridge.NewMockIPLDBridge()
+	ctx := context.Background()
+	fal := newFakeAsyncLoader()
+	fab := &fakeAddressBook{make(chan pstore.PeerInfo, 2)}
+	requestManager := New(ctx, fal, fakeIPLDBridge, UseAddressBook(fab))
+	requestManager.SetDelegate(fph)
+	requestManager.Startup()
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(3)
+	addr, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/4001")
+	if err != nil {
+		t.Fatal("unable to create address")
+	}
+
+	blocks := testutil.GenerateBlocksOfSize(5, 100)
+	s := testbridge.NewMockSelectorSpec(cidsForBlocks(blocks))
+	resultChan := make(chan RequestResult, 1)
+	returnedResponseChan, returnedErrorChan := requestManager.SendRequest(requestCtx, peers[0], s,
+		WithFollowAdditionalPeers(),
+		WithResultCallback(func(result RequestResult) {
+			resultChan <- result
+		}))
+
+	rr := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+
+	// a peer the request was not sent to cannot point it elsewhere
+	unsolicitedResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(rr.gsr.ID(), gsmsg.RequestRejected, encodedMetadataForBlocks(t, fakeIPLDBridge, nil, true),
+			gsmsg.AdditionalPeersExtension([]pstore.PeerInfo{{ID: peers[2], Addrs: []ma.Multiaddr{addr}}})),
+	}
+	requestManager.ProcessResponses(peers[1], unsolicitedResponses, nil)
+	fal.verifyLastProcessedBlocks(requestCtx, t, nil)
+	fal.verifyLastProcessedResponses(requestCtx, t, map[gsmsg.GraphSyncRequestID]metadata.Metadata{})
+
+	// the first peer turns the request away, pointing to the second peer
+	additionalPeers := []pstore.PeerInfo{{ID: peers[1], Addrs: []ma.Multiaddr{addr}}}
+	firstResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(rr.gsr.ID(), gsmsg.RequestRejected, encodedMetadataForBlocks(t, fakeIPLDBridge, nil, true),
+			gsmsg.AdditionalPeersExtension(additionalPeers)),
+	}
+	requestManager.ProcessResponses(peers[0], firstResponses, nil)
+	fal.verifyLastProcessedBlocks(requestCtx, t, nil)
+	fal.verifyLastProcessedResponses(requestCtx, t, map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		rr.gsr.ID(): metadata.Metadata{},
+	})
+
+	redirectRecord := readNNetworkRequests(requestCtx, t, requestRecordChan, 1)[0]
+	if redirectRecord.p != peers[1] || !reflect.DeepEqual(redirectRecord.gsr, rr.gsr) {
+		t.Fatal("did not follow redirect to additional peer")
+	}
+
+	select {
+	case <-requestCtx.Done():
+		t.Fatal("did not record additional peer addresses")
+	case recorded := <-fab.recordedAddrs:
+		if !reflect.DeepEqual(recorded, additionalPeers[0]) {
+			t.Fatal("recorded addresses for the wrong peer")
+		}
+	}
+
+	secondResponses := []gsmsg.GraphSyncResponse{
+		gsmsg.NewResponse(rr.gsr.ID(), gsmsg.RequestCompletedFull, encodedMetadataForBlocks(t, fakeIPLDBridge, blocks, true)),
+	}
+	requestManager.ProcessResponses(peers[1], secondResponses, blocks)
+	fal.verifyLastProcessedBlocks(requestCtx, t, blocks)
+	fal.verifyLastProcessedResponses(requestCtx, t, map[gsmsg.GraphSyncRequestID]metadata.Metadata{
+		rr.gsr.ID(): metadataForBlocks(blocks, true),
+	})
+	fal.successResponseOn(rr.gsr.ID(), blocks)
+
+	responses := testutil.CollectResponses(requestCtx, t, returnedResponseChan)
+	verifyMatchedResponses(t, responses, blocks)
+	testutil.VerifyEmptyErrors(requestCtx, t, returnedErrorChan)
+
+	select {
+	case <-requestCtx.Done():
+		t.Fatal("did not receive request result")
+	case result := <-resultChan:
+		if result.Status != gsmsg.RequestCompletedFull ||
+			!reflect.DeepEqual(result.AdditionalPeers, additionalPeers) {
+			t.Fatal("did not report additional peers on result")
+		}
+	}
 }
@@ -0,0 +1,131 @@
+package requestmanager
+
+import (
+	"time"
+
+	"github.com/ipfs/go-graphsync/ipldbridge"
+	gsmsg "github.com/ipfs/go-graphsync/message"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// RequestOption customizes a single outgoing request
+type RequestOption func(*requestOptions)
+
+type requestOptions struct {
+	extensions            []gsmsg.GraphSyncExtension
+	priority              gsmsg.GraphSyncPriority
+	requestIDCallback     func(gsmsg.GraphSyncRequestID)
+	timeout               time.Duration
+	stallTimeout          time.Duration
+	resultCallback        func(RequestResult)
+	failoverPeers         []peer.ID
+	busyRetries           int
+	followAdditionalPeers bool
+	loader                ipldbridge.ContextLoader
+	storer                ipldbridge.ContextStorer
+}
+
+// WithExtensions attaches the given extension data to an outgoing request
+func WithExtensions(extensions ...gsmsg.GraphSyncExtension) RequestOption {
+	return func(ro *requestOptions) {
+		ro.extensions = append(ro.extensions, extensions...)
+	}
+}
+
+// WithPriority sets the priority of an outgoing request. Responders work on a
+// peer's higher priority requests first, and the requester sends them and
+// retries loading their links first. Requests default to the maximum priority.
+func WithPriority(priority gsmsg.GraphSyncPriority) RequestOption {
+	return func(ro *requestOptions) {
+		ro.priority = priority
+	}
+}
+
+// WithRequestIDCallback calls the given function with the ID assigned to an
+// outgoing request, before the request is sent. The ID can be used to pause,
+// unpause or update the request while it is in progress.
+func WithRequestIDCallback(callback func(gsmsg.GraphSyncRequestID)) RequestOption {
+	return func(ro *requestOptions) {
+		ro.requestIDCallback = callback
+	}
+}
+
+// WithTimeout cancels a request that has not completed within the given
+// duration, terminating it with ErrTimedOut
+func WithTimeout(timeout time.Duration) RequestOption {
+	return func(ro *requestOptions) {
+		ro.timeout = timeout
+	}
+}
+
+// WithStallTimeout cancels a request when the responder sends nothing for it
+// within the given duration, terminating it with ErrStalled. Time spent
+// paused by the responder does not count towards the stall timeout.
+func WithStallTimeout(stallTimeout time.Duration) RequestOption {
+	return func(ro *requestOptions) {
+		ro.stallTimeout = stallTimeout
+	}
+}
+
+// WithResultCallback calls the given function with the final result of a
+// request once it finishes, before its response and error channels close
+func WithResultCallback(callback func(RequestResult)) RequestOption {
+	return func(ro *requestOptions) {
+		ro.resultCallback = callback
+	}
+}
+
+// WithFailoverPeers gives peers to try, in order, when every peer responding to
+// a request fails with RequestFailedBusy or RequestFailedContentNotFound,
+// completes it only partially, or cannot be reached. The request is sent again
+// to the next peer, and links are not reported missing until no peers are left
+// to try. The traversal carries on from where it stopped, loading blocks that
+// are already stored locally without waiting on the new peer.
+func WithFailoverPeers(peers ...peer.ID) RequestOption {
+	return func(ro *requestOptions) {
+		ro.failoverPeers = append(ro.failoverPeers, peers...)
+	}
+}
+
+// WithBusyRetries sends a request again, up to the given number of times, when
+// the responder refuses it with RequestFailedBusy. Each retry waits for the
+// backoff the responder asked for, or one second if it did not say.
+func WithBusyRetries(busyRetries int) RequestOption {
+	return func(ro *requestOptions) {
+		ro.busyRetries = busyRetries
+	}
+}
+
+// WithFollowAdditionalPeers adds the peers a responder points the request at
+// with AdditionalPeers to the peers to fail over to. A responder that
+// redirects the request and then ends it, for any reason, is failed over from.
+func WithFollowAdditionalPeers() RequestOption {
+	return func(ro *requestOptions) {
+		ro.followAdditionalPeers = true
+	}
+}
+
+// WithLoader loads the links of a request that are not in responses from the
+// given loader, in place of the local store
+func WithLoader(loader ipldbridge.Loader) RequestOption {
+	return func(ro *requestOptions) {
+		ro.loader = ipldbridge.LoaderWithContext(loader)
+	}
+}
+
+// WithStorer stores the blocks received for a request with the given storer,
+// in place of the local store. It is usually given with WithLoader, so links
+// already stored for the request can be loaded again.
+func WithStorer(storer ipldbridge.Storer) RequestOption {
+	return func(ro *requestOptions) {
+		ro.storer = ipldbridge.StorerWithContext(storer)
+	}
+}
+
+func collectRequestOptions(options []RequestOption) requestOptions {
+	ro := requestOptions{priority: maxPriority}
+	for _, option := range options {
+		option(&ro)
+	}
+	return ro
+}
@@ -18,6 +18,7 @@ func (rc *responseCollector) collectResponses(
 	requestCtx context.Context,
 	incomingResponses <-chan types.ResponseProgress,
 	incomingErrors <-chan error,
+	incomingNotices <-chan error,
 	cancelRequest func()) (<-chan types.ResponseProgress, <-chan error) {
 
 	returnedResponses := make(chan types.ResponseProgress)
@@ -87,6 +88,8 @@ func (rc *responseCollector) collectResponses(
 				} else {
 					receivedErrors = append(receivedErrors, err)
 				}
+			case notice := <-incomingNotices:
+				receivedErrors = append(receivedErrors, notice)
 			case outgoingErrors() <- nextError():
 				receivedErrors = receivedErrors[1:]
 			}
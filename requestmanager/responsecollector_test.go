@@ -24,10 +24,11 @@ func TestBufferingResponseProgress(t *testing.T) {
 	defer requestCancel()
 	incomingResponses := make(chan types.ResponseProgress)
 	incomingErrors := make(chan error)
+	incomingNotices := make(chan error)
 	cancelRequest := func() {}
 
 	outgoingResponses, outgoingErrors := rc.collectResponses(
-		requestCtx, incomingResponses, incomingErrors, cancelRequest)
+		requestCtx, incomingResponses, incomingErrors, incomingNotices, cancelRequest)
 
 	blocks := testutil.GenerateBlocksOfSize(10, 100)
 
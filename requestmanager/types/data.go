@@ -1,6 +1,15 @@
 package types
 
-import ipld "github.com/ipld/go-ipld-prime"
+import (
+	"errors"
+
+	ipld "github.com/ipld/go-ipld-prime"
+)
+
+// ErrRequestPaused is sent on a request's error channel when the responder
+// pauses its response. The request stays open and resumes when the
+// responder unpauses it.
+var ErrRequestPaused = errors.New("Request Paused By Peer")
 
 // AsyncLoadResult is sent once over the channel returned by an async load.
 type AsyncLoadResult struct {
@@ -0,0 +1,143 @@
+package bandwidth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// Limiter decides how fast block data is sent to peers. Implementations can
+// give peers different service levels.
+type Limiter interface {
+	// WaitN blocks until n bytes of block data may be sent to the given peer,
+	// returning an error if the context ends first
+	WaitN(ctx context.Context, p peer.ID, n int) error
+	// Disconnected is called once nothing more is being sent to the given
+	// peer, so anything kept to limit it can be dropped
+	Disconnected(p peer.ID)
+}
+
+// Rate is a sustained rate at which bytes may be sent, and a burst that may
+// be sent at once after a quiet period. A zero BytesPerSecond means no limit.
+type Rate struct {
+	BytesPerSecond uint64
+	Burst          uint64
+}
+
+func (r Rate) isLimited() bool {
+	return r.BytesPerSecond > 0
+}
+
+type tokenBucket struct {
+	rate   Rate
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate Rate, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: float64(rate.Burst), last: now}
+}
+
+// reserve takes n tokens from the bucket and returns how long to wait until
+// they have been earned. The bucket can go into debt, so blocks larger than
+// the burst are still sent.
+func (tb *tokenBucket) reserve(now time.Time, n int) time.Duration {
+	tb.tokens += now.Sub(tb.last).Seconds() * float64(tb.rate.BytesPerSecond)
+	if tb.tokens > float64(tb.rate.Burst) {
+		tb.tokens = float64(tb.rate.Burst)
+	}
+	tb.last = now
+	tb.tokens -= float64(n)
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / float64(tb.rate.BytesPerSecond) * float64(time.Second))
+}
+
+// TokenBucketLimiter is a Limiter that enforces a limit on the total rate sent
+// to all peers, and a limit on the rate sent to each peer, with token buckets.
+type TokenBucketLimiter struct {
+	lk        sync.Mutex
+	global    *tokenBucket
+	peerRate  Rate
+	peerRates map[peer.ID]Rate
+	peers     map[peer.ID]*tokenBucket
+}
+
+// NewTokenBucketLimiter returns a limiter that sends to all peers together at
+// no more than the global rate, and to each peer at no more than the per peer
+// rate.
+func NewTokenBucketLimiter(global Rate, perPeer Rate) *TokenBucketLimiter {
+	tbl := &TokenBucketLimiter{
+		peerRate:  perPeer,
+		peerRates: make(map[peer.ID]Rate),
+		peers:     make(map[peer.ID]*tokenBucket),
+	}
+	if global.isLimited() {
+		tbl.global = newTokenBucket(global, time.Now())
+	}
+	return tbl
+}
+
+// SetPeerRate sets the rate for the given peer in place of the per peer rate
+func (tbl *TokenBucketLimiter) SetPeerRate(p peer.ID, rate Rate) {
+	tbl.lk.Lock()
+	defer tbl.lk.Unlock()
+	tbl.peerRates[p] = rate
+	delete(tbl.peers, p)
+}
+
+// WaitN blocks until n bytes may be sent to the given peer within both the
+// global and the peer's rate. Bytes are counted against the limits even if
+// the context ends while waiting.
+func (tbl *TokenBucketLimiter) WaitN(ctx context.Context, p peer.ID, n int) error {
+	wait := tbl.reserve(p, n)
+	if wait == 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Disconnected drops the peer's token bucket. A peer that reconnects starts
+// with a full burst again. Rates set with SetPeerRate are kept.
+func (tbl *TokenBucketLimiter) Disconnected(p peer.ID) {
+	tbl.lk.Lock()
+	defer tbl.lk.Unlock()
+	delete(tbl.peers, p)
+}
+
+func (tbl *TokenBucketLimiter) reserve(p peer.ID, n int) time.Duration {
+	tbl.lk.Lock()
+	defer tbl.lk.Unlock()
+	now := time.Now()
+	var wait time.Duration
+	if tbl.global != nil {
+		wait = tbl.global.reserve(now, n)
+	}
+	bucket, ok := tbl.peers[p]
+	if !ok {
+		rate, ok := tbl.peerRates[p]
+		if !ok {
+			rate = tbl.peerRate
+		}
+		if !rate.isLimited() {
+			return wait
+		}
+		bucket = newTokenBucket(rate, now)
+		tbl.peers[p] = bucket
+	}
+	peerWait := bucket.reserve(now, n)
+	if peerWait > wait {
+		wait = peerWait
+	}
+	return wait
+}
@@ -0,0 +1,99 @@
+package bandwidth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-graphsync/testutil"
+)
+
+func TestTokenBucketRefillsAtRate(t *testing.T) {
+	now := time.Now()
+	tb := newTokenBucket(Rate{BytesPerSecond: 1000, Burst: 100}, now)
+
+	if wait := tb.reserve(now, 100); wait != 0 {
+		t.Fatal("Should send burst without waiting")
+	}
+	if wait := tb.reserve(now, 50); wait != 50*time.Millisecond {
+		t.Fatal("Should wait for tokens to be earned once burst is spent")
+	}
+	now = now.Add(time.Second)
+	if wait := tb.reserve(now, 100); wait != 0 {
+		t.Fatal("Should refill bucket after waiting")
+	}
+	if wait := tb.reserve(now, 300); wait != 300*time.Millisecond {
+		t.Fatal("Should not refill bucket past burst")
+	}
+}
+
+func TestTokenBucketLimiterRates(t *testing.T) {
+	peers := testutil.GeneratePeers(3)
+
+	tbl := NewTokenBucketLimiter(Rate{}, Rate{BytesPerSecond: 1000, Burst: 100})
+	tbl.SetPeerRate(peers[2], Rate{})
+	if wait := tbl.reserve(peers[0], 100); wait != 0 {
+		t.Fatal("Should send burst to peer without waiting")
+	}
+	if wait := tbl.reserve(peers[0], 100); wait == 0 {
+		t.Fatal("Should wait once peer has spent its burst")
+	}
+	if wait := tbl.reserve(peers[1], 100); wait != 0 {
+		t.Fatal("Should limit each peer separately")
+	}
+	for i := 0; i < 10; i++ {
+		if wait := tbl.reserve(peers[2], 100); wait != 0 {
+			t.Fatal("Should not limit peer whose rate is set to unlimited")
+		}
+	}
+
+	tbl = NewTokenBucketLimiter(Rate{BytesPerSecond: 1000, Burst: 100}, Rate{})
+	if wait := tbl.reserve(peers[0], 100); wait != 0 {
+		t.Fatal("Should send global burst without waiting")
+	}
+	if wait := tbl.reserve(peers[1], 100); wait == 0 {
+		t.Fatal("Should wait once all peers together have spent the global burst")
+	}
+}
+
+func TestTokenBucketLimiterWaitN(t *testing.T) {
+	ctx := context.Background()
+	p := testutil.GeneratePeers(1)[0]
+	tbl := NewTokenBucketLimiter(Rate{}, Rate{BytesPerSecond: 1000, Burst: 10})
+
+	start := time.Now()
+	err := tbl.WaitN(ctx, p, 60)
+	if err != nil {
+		t.Fatal("Should wait until bytes can be sent")
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Fatal("Did not wait for bytes to be earned")
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err = tbl.WaitN(timeoutCtx, p, 1000)
+	if err != context.DeadlineExceeded {
+		t.Fatal("Should return error when context ends while waiting")
+	}
+}
+
+func TestTokenBucketLimiterDropsDisconnectedPeers(t *testing.T) {
+	peers := testutil.GeneratePeers(2)
+	tbl := NewTokenBucketLimiter(Rate{}, Rate{BytesPerSecond: 1000, Burst: 100})
+	tbl.SetPeerRate(peers[1], Rate{BytesPerSecond: 1000, Burst: 200})
+
+	tbl.reserve(peers[0], 100)
+	tbl.reserve(peers[1], 200)
+	tbl.Disconnected(peers[0])
+	tbl.Disconnected(peers[1])
+	if len(tbl.peers) != 0 {
+		t.Fatal("Should drop buckets for disconnected peers")
+	}
+	if wait := tbl.reserve(peers[1], 200); wait != 0 {
+		t.Fatal("Should keep rate set for peer after it disconnects")
+	}
+	if wait := tbl.reserve(peers[1], 1); wait == 0 {
+		t.Fatal("Should limit reconnected peer at the rate set for it")
+	}
+}
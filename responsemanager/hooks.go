@@ -0,0 +1,157 @@
+package responsemanager
+
+import (
+	"errors"
+
+	"github.com/ipfs/go-graphsync/ipldbridge"
+	gsmsg "github.com/ipfs/go-graphsync/message"
+	"github.com/ipfs/go-graphsync/responsemanager/loader"
+	"github.com/ipfs/go-graphsync/responsemanager/peerresponsemanager"
+	ipld "github.com/ipld/go-ipld-prime"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+)
+
+var errPausedResponse = errors.New("response paused")
+var errTerminatedResponse = errors.New("response terminated")
+
+// RequestReceivedHookActions are actions that a request hook can take to
+// change the response to an incoming request
+type RequestReceivedHookActions interface {
+	// SendExtensionData attaches the given extension data to the response
+	SendExtensionData(extension gsmsg.GraphSyncExtension)
+	// RejectRequest refuses the request, terminating it with the given status,
+	// which should be a terminal failure code like RequestRejected or
+	// RequestFailedLegal
+	RejectRequest(status gsmsg.GraphSyncResponseStatusCode)
+	// SendAdditionalPeers points the requester at other peers, with the
+	// addresses they can be reached at, that may be able to satisfy the request
+	SendAdditionalPeers(peers ...pstore.PeerInfo)
+	// SetBudget limits the traversal for the request, overriding any budget
+	// set for the peer or by default
+	SetBudget(budget loader.Budget)
+	// UseLoader serves the request from the given loader instead of the
+	// response manager's loader. The loader receives the request's context,
+	// from which the requesting peer and request ID can be read.
+	UseLoader(loader ipldbridge.ContextLoader)
+}
+
+// RequestReceivedHook is run when a new request is received from a peer,
+// before it is queued for processing. It receives the raw request as well as
+// its decoded selector spec, from which the root can be read with the IPLD
+// bridge's DecodeSelectorSpec. Hooks run on the response manager's event loop,
+// so they should not block.
+type RequestReceivedHook func(p peer.ID, request gsmsg.GraphSyncRequest, selectorSpec ipld.Node, hookActions RequestReceivedHookActions)
+
+type requestHookActions struct {
+	isRejected bool
+	status     gsmsg.GraphSyncResponseStatusCode
+	extensions []gsmsg.GraphSyncExtension
+	budget     *loader.Budget
+	loader     ipldbridge.ContextLoader
+}
+
+func (rha *requestHookActions) SendExtensionData(extension gsmsg.GraphSyncExtension) {
+	rha.extensions = append(rha.extensions, extension)
+}
+
+func (rha *requestHookActions) SendAdditionalPeers(peers ...pstore.PeerInfo) {
+	rha.extensions = append(rha.extensions, gsmsg.AdditionalPeersExtension(peers))
+}
+
+func (rha *requestHookActions) RejectRequest(status gsmsg.GraphSyncResponseStatusCode) {
+	rha.isRejected = true
+	rha.status = status
+}
+
+func (rha *requestHookActions) SetBudget(budget loader.Budget) {
+	rha.budget = &budget
+}
+
+func (rha *requestHookActions) UseLoader(loader ipldbridge.ContextLoader) {
+	rha.loader = loader
+}
+
+// RequestUpdatedHookActions are actions that an update hook can take in
+// response to new extension data for an in progress request
+type RequestUpdatedHookActions interface {
+	// SendExtensionData attaches the given extension data to the response
+	SendExtensionData(extension gsmsg.GraphSyncExtension)
+	// PauseResponse stops sending blocks until the response is unpaused
+	PauseResponse()
+	// UnpauseResponse resumes a paused response
+	UnpauseResponse()
+}
+
+// RequestUpdatedHook is run when a requester sends an update for an in
+// progress request. It receives the original request along with the update.
+// Hooks run on the response manager's event loop, so they should not block.
+type RequestUpdatedHook func(p peer.ID, request gsmsg.GraphSyncRequest, update gsmsg.GraphSyncRequest, hookActions RequestUpdatedHookActions)
+
+type updateHookActions struct {
+	extensions []gsmsg.GraphSyncExtension
+	isPaused   bool
+	isUnpaused bool
+}
+
+func (uha *updateHookActions) SendExtensionData(extension gsmsg.GraphSyncExtension) {
+	uha.extensions = append(uha.extensions, extension)
+}
+
+func (uha *updateHookActions) PauseResponse() {
+	uha.isPaused = true
+	uha.isUnpaused = false
+}
+
+func (uha *updateHookActions) UnpauseResponse() {
+	uha.isUnpaused = true
+	uha.isPaused = false
+}
+
+// OutgoingBlockHookActions are actions that an outgoing block hook can take
+// to change the course of a response
+type OutgoingBlockHookActions interface {
+	// SendExtensionData attaches the given extension data to the response
+	SendExtensionData(extension gsmsg.GraphSyncExtension)
+	// TerminateWithError ends the response with the given status, which should
+	// be a terminal failure code, without sending any more blocks
+	TerminateWithError(status gsmsg.GraphSyncResponseStatusCode)
+	// PauseResponse stops sending blocks until the response is unpaused
+	PauseResponse()
+}
+
+// OutgoingBlockHook is run on the responder each time a block is sent for a
+// request, with the size of the block in bytes. Hooks run on the goroutine
+// performing the traversal, so a slow hook slows the response.
+type OutgoingBlockHook func(p peer.ID, requestID gsmsg.GraphSyncRequestID, link ipld.Link, blockSize uint64, hookActions OutgoingBlockHookActions)
+
+type blockHookActions struct {
+	requestID          gsmsg.GraphSyncRequestID
+	peerResponseSender peerresponsemanager.PeerResponseSender
+	isTerminated       bool
+	status             gsmsg.GraphSyncResponseStatusCode
+	isPaused           bool
+}
+
+func (bha *blockHookActions) SendExtensionData(extension gsmsg.GraphSyncExtension) {
+	bha.peerResponseSender.SendExtensionData(bha.requestID, extension)
+}
+
+func (bha *blockHookActions) TerminateWithError(status gsmsg.GraphSyncResponseStatusCode) {
+	bha.isTerminated = true
+	bha.status = status
+}
+
+func (bha *blockHookActions) PauseResponse() {
+	bha.isPaused = true
+}
+
+func (bha *blockHookActions) haltError() error {
+	if bha.isTerminated {
+		return errTerminatedResponse
+	}
+	if bha.isPaused {
+		return errPausedResponse
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-graphsync/ipldbridge"
+)
+
+// Budget limits how much work a responder does traversing for a single
+// request. A zero value for any field means that limit is not enforced.
+type Budget struct {
+	// MaxBlocks is the most blocks sent for the request
+	MaxBlocks uint64
+	// MaxBytes is the most block data, in bytes, sent for the request
+	MaxBytes uint64
+	// MaxLinkDepth is the most links followed below the root to reach a block
+	MaxLinkDepth int
+	// MaxDuration is the longest the traversal runs, not counting time paused
+	MaxDuration time.Duration
+}
+
+// BudgetLimit names one of the limits in a budget
+type BudgetLimit string
+
+const (
+	// BlocksLimit is the limit set by Budget.MaxBlocks
+	BlocksLimit = BudgetLimit("blocks")
+	// BytesLimit is the limit set by Budget.MaxBytes
+	BytesLimit = BudgetLimit("bytes")
+	// LinkDepthLimit is the limit set by Budget.MaxLinkDepth
+	LinkDepthLimit = BudgetLimit("link-depth")
+	// DurationLimit is the limit set by Budget.MaxDuration
+	DurationLimit = BudgetLimit("duration")
+	// PeerBlocksLimit is the limit set by MaxBlocks in a peer's shared budget
+	PeerBlocksLimit = BudgetLimit("peer-blocks")
+	// PeerBytesLimit is the limit set by MaxBytes in a peer's shared budget
+	PeerBytesLimit = BudgetLimit("peer-bytes")
+)
+
+// BudgetExceededError is returned from a wrapped loader to halt a traversal
+// that has gone over its budget
+type BudgetExceededError struct {
+	Limit BudgetLimit
+}
+
+func (e BudgetExceededError) Error() string {
+	return fmt.Sprintf("traversal budget exceeded: %s", e.Limit)
+}
+
+// PeerBudgetTracker tracks what all of a peer's traversals in progress spend
+// against a budget they share, so a peer cannot get more sent by making more
+// requests at once. Only MaxBlocks and MaxBytes are shared; link depth and
+// duration only limit single traversals. It is safe for concurrent use.
+type PeerBudgetTracker struct {
+	budgetLk sync.Mutex
+	budget   Budget
+	blocks   uint64
+	bytes    uint64
+}
+
+// NewPeerBudgetTracker returns a tracker that enforces the given budget
+// across a peer's traversals
+func NewPeerBudgetTracker(budget Budget) *PeerBudgetTracker {
+	return &PeerBudgetTracker{budget: budget}
+}
+
+// SetBudget changes the budget the peer's traversals share
+func (pbt *PeerBudgetTracker) SetBudget(budget Budget) {
+	pbt.budgetLk.Lock()
+	pbt.budget = budget
+	pbt.budgetLk.Unlock()
+}
+
+// spend adds a block to what the peer's traversals have spent, unless it
+// would take them over the shared budget
+func (pbt *PeerBudgetTracker) spend(data []byte) (BudgetLimit, bool) {
+	pbt.budgetLk.Lock()
+	defer pbt.budgetLk.Unlock()
+	if pbt.budget.MaxBlocks > 0 && pbt.blocks >= pbt.budget.MaxBlocks {
+		return PeerBlocksLimit, false
+	}
+	if pbt.budget.MaxBytes > 0 && pbt.bytes+uint64(len(data)) > pbt.budget.MaxBytes {
+		return PeerBytesLimit, false
+	}
+	pbt.blocks++
+	pbt.bytes += uint64(len(data))
+	return "", true
+}
+
+func (pbt *PeerBudgetTracker) release(blocks uint64, bytes uint64) {
+	pbt.budgetLk.Lock()
+	pbt.blocks -= blocks
+	pbt.bytes -= bytes
+	pbt.budgetLk.Unlock()
+}
+
+// BudgetTracker tracks what a single traversal has spent against its budget.
+// It persists across pauses of the traversal, and is not safe for concurrent
+// use.
+type BudgetTracker struct {
+	budget     Budget
+	peerBudget *PeerBudgetTracker
+	blocks     uint64
+	bytes      uint64
+	elapsed    time.Duration
+	startedAt  time.Time
+	linkDepths map[string]int
+	exceeded   BudgetLimit
+}
+
+// NewBudgetTracker returns a tracker that enforces the given budget, and the
+// budget shared by the peer's traversals if a peer budget tracker is given
+func NewBudgetTracker(budget Budget, peerBudget *PeerBudgetTracker) *BudgetTracker {
+	return &BudgetTracker{
+		budget:     budget,
+		peerBudget: peerBudget,
+		linkDepths: make(map[string]int),
+	}
+}
+
+// Start marks the beginning of a run of the traversal
+func (bt *BudgetTracker) Start() {
+	if bt == nil {
+		return
+	}
+	bt.startedAt = time.Now()
+}
+
+// Stop marks the end of a run of the traversal, when it pauses or finishes
+func (bt *BudgetTracker) Stop() {
+	if bt == nil {
+		return
+	}
+	bt.elapsed += time.Since(bt.startedAt)
+}
+
+// Exceeded returns the limit the traversal went over, if any. Links deeper
+// than the depth limit are skipped rather than halting the traversal, so this
+// may be set even though the traversal ran to completion.
+func (bt *BudgetTracker) Exceeded() (BudgetLimit, bool) {
+	if bt == nil || bt.exceeded == "" {
+		return "", false
+	}
+	return bt.exceeded, true
+}
+
+// Release gives what the traversal spent back to the budget it shares with the
+// peer's other traversals, once it is no longer in progress
+func (bt *BudgetTracker) Release() {
+	if bt == nil || bt.peerBudget == nil {
+		return
+	}
+	bt.peerBudget.release(bt.blocks, bt.bytes)
+	bt.peerBudget = nil
+}
+
+func (bt *BudgetTracker) exceed(limit BudgetLimit) error {
+	bt.exceeded = limit
+	return BudgetExceededError{limit}
+}
+
+// checkLink is called before a link is loaded, and returns the link's depth
+// below the root, or an error if the link should not be loaded
+func (bt *BudgetTracker) checkLink(lnkCtx ipldbridge.LinkContext) (int, error) {
+	if bt == nil {
+		return 0, nil
+	}
+	if bt.budget.MaxDuration > 0 && bt.elapsed+time.Since(bt.startedAt) > bt.budget.MaxDuration {
+		return 0, bt.exceed(DurationLimit)
+	}
+	if bt.budget.MaxBlocks > 0 && bt.blocks >= bt.budget.MaxBlocks {
+		return 0, bt.exceed(BlocksLimit)
+	}
+	if bt.IsTooDeep(lnkCtx) {
+		bt.exceeded = LinkDepthLimit
+		return 0, ipldbridge.ErrDoNotFollow()
+	}
+	return bt.linkDepth(lnkCtx), nil
+}
+
+// IsTooDeep returns whether a link is deeper than the depth limit, and so is
+// skipped rather than loaded. A traversal resumed after a pause uses it to
+// skip the same links again while replaying the links it already traversed.
+func (bt *BudgetTracker) IsTooDeep(lnkCtx ipldbridge.LinkContext) bool {
+	if bt == nil {
+		return false
+	}
+	return bt.budget.MaxLinkDepth > 0 && bt.linkDepth(lnkCtx) > bt.budget.MaxLinkDepth
+}
+
+// spend is called after a link is loaded, before its block is sent
+func (bt *BudgetTracker) spend(lnkCtx ipldbridge.LinkContext, depth int, data []byte) error {
+	if bt == nil {
+		return nil
+	}
+	if bt.budget.MaxBytes > 0 && bt.bytes+uint64(len(data)) > bt.budget.MaxBytes {
+		return bt.exceed(BytesLimit)
+	}
+	if bt.peerBudget != nil {
+		if limit, ok := bt.peerBudget.spend(data); !ok {
+			return bt.exceed(limit)
+		}
+	}
+	bt.blocks++
+	bt.bytes += uint64(len(data))
+	bt.linkDepths[lnkCtx.LinkPath.String()] = depth
+	return nil
+}
+
+// linkDepth is one more than the depth of the nearest block loaded above the
+// link on its path, or zero for the first block on the path. The link's own
+// path is not considered, so a link replayed on resume keeps its depth.
+func (bt *BudgetTracker) linkDepth(lnkCtx ipldbridge.LinkContext) int {
+	segments := lnkCtx.LinkPath.Segments()
+	for i := len(segments) - 1; i >= 0; i-- {
+		if depth, ok := bt.linkDepths[strings.Join(segments[:i], "/")]; ok {
+			return depth + 1
+		}
+	}
+	return 0
+}
@@ -2,6 +2,7 @@ package loader
 
 import (
 	"bytes"
+	"context"
 	"io"
 
 	"github.com/ipfs/go-graphsync/ipldbridge"
@@ -12,19 +13,35 @@ import (
 // ResponseSender sends responses over the network
 type ResponseSender interface {
 	SendResponse(
+		ctx context.Context,
 		requestID gsmsg.GraphSyncRequestID,
 		link ipld.Link,
 		data []byte,
 	)
 }
 
+// BlockHook is called after a loaded block is sent. Returning an error
+// halts the traversal.
+type BlockHook func(link ipld.Link, data []byte) error
+
 // WrapLoader wraps a given loader with an interceptor that sends loaded
-// blocks out to the network with the given response sender.
-func WrapLoader(loader ipldbridge.Loader,
+// blocks out to the network with the given response sender, and then calls
+// the given block hook for each block that was present. Blocks are only
+// loaded and sent while the traversal stays within the given budget tracker's
+// budget; a nil tracker means no budget is enforced. The given request context
+// is passed to the loader for every link.
+func WrapLoader(ctx context.Context,
+	loader ipldbridge.ContextLoader,
 	requestID gsmsg.GraphSyncRequestID,
-	responseSender ResponseSender) ipldbridge.Loader {
+	responseSender ResponseSender,
+	budget *BudgetTracker,
+	blockHook BlockHook) ipldbridge.Loader {
 	return func(lnk ipld.Link, lnkCtx ipldbridge.LinkContext) (io.Reader, error) {
-		result, err := loader(lnk, lnkCtx)
+		depth, err := budget.checkLink(lnkCtx)
+		if err != nil {
+			return nil, err
+		}
+		result, err := loader(ctx, lnk, lnkCtx)
 		var data []byte
 		var blockBuffer bytes.Buffer
 		if err == nil {
@@ -34,10 +51,20 @@ func WrapLoader(loader ipldbridge.Loader,
 				data = blockBuffer.Bytes()
 			}
 		}
-		responseSender.SendResponse(requestID, lnk, data)
+		if data != nil {
+			err = budget.spend(lnkCtx, depth, data)
+			if err != nil {
+				return nil, err
+			}
+		}
+		responseSender.SendResponse(ctx, requestID, lnk, data)
 		if data == nil {
-			err = ipldbridge.ErrDoNotFollow()
+			return result, ipldbridge.ErrDoNotFollow()
+		}
+		err = blockHook(lnk, data)
+		if err != nil {
+			return nil, err
 		}
-		return result, err
+		return result, nil
 	}
 }
@@ -2,12 +2,14 @@ package loader
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-graphsync/testbridge"
 	"github.com/ipfs/go-graphsync/testutil"
@@ -24,6 +26,7 @@ type fakeResponseSender struct {
 }
 
 func (frs *fakeResponseSender) SendResponse(
+	ctx context.Context,
 	requestID gsmsg.GraphSyncRequestID,
 	link ipld.Link,
 	data []byte,
@@ -39,15 +42,25 @@ func TestWrappedLoaderSendsResponses(t *testing.T) {
 	link2 := testbridge.NewMockLink()
 	sourceBytes := testutil.RandomBytes(100)
 	byteBuffer := bytes.NewReader(sourceBytes)
+	type ctxKey struct{}
+	requestCtx := context.WithValue(context.Background(), ctxKey{}, "request")
 
-	loader := func(ipldLink ipld.Link, lnkCtx ipldbridge.LinkContext) (io.Reader, error) {
+	loader := func(ctx context.Context, ipldLink ipld.Link, lnkCtx ipldbridge.LinkContext) (io.Reader, error) {
+		if ctx.Value(ctxKey{}) != "request" {
+			t.Fatal("Should pass request context to underlying loader")
+		}
 		if ipldLink == link1 {
 			return byteBuffer, nil
 		}
 		return nil, fmt.Errorf("unable to load block")
 	}
 	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
-	wrappedLoader := WrapLoader(loader, requestID, frs)
+	var hookedLinks []ipld.Link
+	blockHook := func(link ipld.Link, data []byte) error {
+		hookedLinks = append(hookedLinks, link)
+		return nil
+	}
+	wrappedLoader := WrapLoader(requestCtx, loader, requestID, frs, nil, blockHook)
 
 	reader, err := wrappedLoader(link1, ipldbridge.LinkContext{})
 	if err != nil {
@@ -62,6 +75,9 @@ func TestWrappedLoaderSendsResponses(t *testing.T) {
 		!reflect.DeepEqual(frs.lastData, sourceBytes) {
 		t.Fatal("Should have sent block to response sender with correct params but did not")
 	}
+	if len(hookedLinks) != 1 || hookedLinks[0] != link1 {
+		t.Fatal("Should have called block hook for sent block")
+	}
 
 	reader, err = wrappedLoader(link2, ipldbridge.LinkContext{})
 
@@ -78,4 +94,130 @@ func TestWrappedLoaderSendsResponses(t *testing.T) {
 		frs.lastData != nil {
 		t.Fatal("Should sent metadata for link but no block, but did not")
 	}
+	if len(hookedLinks) != 1 {
+		t.Fatal("Should not call block hook for missing block")
+	}
+}
+
+func TestWrappedLoaderHaltsOnBlockHookError(t *testing.T) {
+	ctx := context.Background()
+	frs := &fakeResponseSender{}
+	link := testbridge.NewMockLink()
+	sourceBytes := testutil.RandomBytes(100)
+	byteBuffer := bytes.NewReader(sourceBytes)
+
+	loader := func(ipldLink ipld.Link, lnkCtx ipldbridge.LinkContext) (io.Reader, error) {
+		return byteBuffer, nil
+	}
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	hookErr := fmt.Errorf("stop here")
+	blockHook := func(link ipld.Link, data []byte) error {
+		return hookErr
+	}
+	wrappedLoader := WrapLoader(ctx, ipldbridge.LoaderWithContext(loader), requestID, frs, nil, blockHook)
+
+	reader, err := wrappedLoader(link, ipldbridge.LinkContext{})
+	if reader != nil || err != hookErr {
+		t.Fatal("Should return error from block hook")
+	}
+	if frs.lastRequestID != requestID ||
+		frs.lastLink != link ||
+		!reflect.DeepEqual(frs.lastData, sourceBytes) {
+		t.Fatal("Should have sent block before calling block hook")
+	}
+}
+
+func TestWrappedLoaderEnforcesBudget(t *testing.T) {
+	ctx := context.Background()
+	frs := &fakeResponseSender{}
+	sourceBytes := testutil.RandomBytes(100)
+	loader := func(ipldLink ipld.Link, lnkCtx ipldbridge.LinkContext) (io.Reader, error) {
+		return bytes.NewReader(sourceBytes), nil
+	}
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	blockHook := func(link ipld.Link, data []byte) error {
+		return nil
+	}
+	atPath := func(path string) ipldbridge.LinkContext {
+		return ipldbridge.LinkContext{LinkPath: ipld.ParsePath(path)}
+	}
+
+	budget := NewBudgetTracker(Budget{MaxLinkDepth: 1, MaxBlocks: 3}, nil)
+	budget.Start()
+	wrappedLoader := WrapLoader(ctx, ipldbridge.LoaderWithContext(loader), requestID, frs, budget, blockHook)
+	_, err := wrappedLoader(testbridge.NewMockLink(), atPath(""))
+	if err != nil {
+		t.Fatal("Should load root within budget")
+	}
+	_, err = wrappedLoader(testbridge.NewMockLink(), atPath("Links/0/Hash"))
+	if err != nil {
+		t.Fatal("Should load link within depth limit")
+	}
+	link := testbridge.NewMockLink()
+	_, err = wrappedLoader(link, atPath("Links/0/Hash/Links/0/Hash"))
+	if err != ipldbridge.ErrDoNotFollow() {
+		t.Fatal("Should not follow link deeper than depth limit")
+	}
+	if frs.lastLink == link {
+		t.Fatal("Should not send link deeper than depth limit")
+	}
+	if limit, exceeded := budget.Exceeded(); !exceeded || limit != LinkDepthLimit {
+		t.Fatal("Should record that depth limit was exceeded")
+	}
+	_, err = wrappedLoader(testbridge.NewMockLink(), atPath("Links/1/Hash"))
+	if err != nil {
+		t.Fatal("Should continue loading links within depth limit")
+	}
+	_, err = wrappedLoader(testbridge.NewMockLink(), atPath("Links/2/Hash"))
+	if budgetErr, ok := err.(BudgetExceededError); !ok || budgetErr.Limit != BlocksLimit {
+		t.Fatal("Should halt traversal once block limit is reached")
+	}
+
+	budget = NewBudgetTracker(Budget{MaxBytes: 150}, nil)
+	budget.Start()
+	wrappedLoader = WrapLoader(ctx, ipldbridge.LoaderWithContext(loader), requestID, frs, budget, blockHook)
+	_, err = wrappedLoader(testbridge.NewMockLink(), atPath(""))
+	if err != nil {
+		t.Fatal("Should load block within byte limit")
+	}
+	link = testbridge.NewMockLink()
+	_, err = wrappedLoader(link, atPath("Links/0/Hash"))
+	if budgetErr, ok := err.(BudgetExceededError); !ok || budgetErr.Limit != BytesLimit {
+		t.Fatal("Should halt traversal when block would exceed byte limit")
+	}
+	if frs.lastLink == link {
+		t.Fatal("Should not send block that would exceed byte limit")
+	}
+
+	budget = NewBudgetTracker(Budget{MaxDuration: time.Millisecond}, nil)
+	budget.Start()
+	time.Sleep(2 * time.Millisecond)
+	budget.Stop()
+	wrappedLoader = WrapLoader(ctx, ipldbridge.LoaderWithContext(loader), requestID, frs, budget, blockHook)
+	budget.Start()
+	_, err = wrappedLoader(testbridge.NewMockLink(), atPath(""))
+	if budgetErr, ok := err.(BudgetExceededError); !ok || budgetErr.Limit != DurationLimit {
+		t.Fatal("Should halt traversal once time limit is spent")
+	}
+
+	peerBudget := NewPeerBudgetTracker(Budget{MaxBytes: 150})
+	budget = NewBudgetTracker(Budget{}, peerBudget)
+	budget.Start()
+	wrappedLoader = WrapLoader(ctx, ipldbridge.LoaderWithContext(loader), requestID, frs, budget, blockHook)
+	_, err = wrappedLoader(testbridge.NewMockLink(), atPath(""))
+	if err != nil {
+		t.Fatal("Should load block within peer byte limit")
+	}
+	otherBudget := NewBudgetTracker(Budget{}, peerBudget)
+	otherBudget.Start()
+	otherLoader := WrapLoader(ctx, ipldbridge.LoaderWithContext(loader), requestID, frs, otherBudget, blockHook)
+	_, err = otherLoader(testbridge.NewMockLink(), atPath(""))
+	if budgetErr, ok := err.(BudgetExceededError); !ok || budgetErr.Limit != PeerBytesLimit {
+		t.Fatal("Should halt traversal when block would exceed peer byte limit")
+	}
+	budget.Release()
+	_, err = otherLoader(testbridge.NewMockLink(), atPath(""))
+	if err != nil {
+		t.Fatal("Should load block once another traversal gives back what it spent")
+	}
 }
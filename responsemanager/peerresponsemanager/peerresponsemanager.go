@@ -15,12 +15,14 @@ type PeerResponseManager struct {
 	*peermanager.PeerManager
 }
 
-// New generates a new peer manager for sending responses
+// New generates a new peer manager for sending responses. Responses only go
+// to connected peers, so a sender asked for after its peer disconnects drops
+// what it is given.
 func New(ctx context.Context, createPeerSender PeerSenderFactory) *PeerResponseManager {
 	return &PeerResponseManager{
 		PeerManager: peermanager.New(ctx, func(ctx context.Context, p peer.ID) peermanager.PeerProcess {
 			return createPeerSender(ctx, p)
-		}),
+		}, peermanager.StopAfterDisconnected()),
 	}
 }
 
@@ -16,6 +16,7 @@ import (
 	"github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-graphsync/linktracker"
 	gsmsg "github.com/ipfs/go-graphsync/message"
+	"github.com/ipfs/go-graphsync/responsemanager/bandwidth"
 	"github.com/ipfs/go-graphsync/responsemanager/responsebuilder"
 	peer "github.com/libp2p/go-libp2p-peer"
 )
@@ -29,17 +30,21 @@ type PeerMessageHandler interface {
 }
 
 type peerResponseSender struct {
-	p            peer.ID
-	ctx          context.Context
-	cancel       context.CancelFunc
-	peerHandler  PeerMessageHandler
-	ipldBridge   ipldbridge.IPLDBridge
-	outgoingWork chan struct{}
+	p              peer.ID
+	ctx            context.Context
+	cancel         context.CancelFunc
+	peerHandler    PeerMessageHandler
+	ipldBridge     ipldbridge.IPLDBridge
+	limiter        bandwidth.Limiter
+	maxMessageSize int
+	outgoingWork   chan struct{}
+	draining       chan struct{}
+	stopped        chan struct{}
 
 	linkTrackerLk     sync.RWMutex
 	linkTracker       *linktracker.LinkTracker
 	responseBuilderLk sync.RWMutex
-	responseBuilder   *responsebuilder.ResponseBuilder
+	responseBuilders  []*responsebuilder.ResponseBuilder
 }
 
 // PeerResponseSender handles batching, deduping, and sending responses for
@@ -47,27 +52,57 @@ type peerResponseSender struct {
 type PeerResponseSender interface {
 	peermanager.PeerProcess
 	SendResponse(
+		ctx context.Context,
 		requestID gsmsg.GraphSyncRequestID,
 		link ipld.Link,
 		data []byte,
 	)
+	SendExtensionData(gsmsg.GraphSyncRequestID, gsmsg.GraphSyncExtension)
+	PauseRequest(requestID gsmsg.GraphSyncRequestID)
 	FinishRequest(requestID gsmsg.GraphSyncRequestID)
 	FinishWithError(requestID gsmsg.GraphSyncRequestID, status gsmsg.GraphSyncResponseStatusCode)
 }
 
+// Option configures a PeerResponseSender
+type Option func(*peerResponseSender)
+
+// BandwidthLimiter limits how fast blocks are sent to the peer. Sending a
+// response for a block waits until the limiter allows it.
+func BandwidthLimiter(limiter bandwidth.Limiter) Option {
+	return func(prm *peerResponseSender) {
+		prm.limiter = limiter
+	}
+}
+
+// MaxMessageSize sets the size in bytes at which responses are split into
+// another message. A block is never split, so a message holding a single
+// large block can be larger.
+func MaxMessageSize(maxMessageSize int) Option {
+	return func(prm *peerResponseSender) {
+		prm.maxMessageSize = maxMessageSize
+	}
+}
+
 // NewResponseSender generates a new PeerResponseSender for the given context, peer ID,
 // using the given peer message handler and bridge to IPLD.
-func NewResponseSender(ctx context.Context, p peer.ID, peerHandler PeerMessageHandler, ipldBridge ipldbridge.IPLDBridge) PeerResponseSender {
+func NewResponseSender(ctx context.Context, p peer.ID, peerHandler PeerMessageHandler, ipldBridge ipldbridge.IPLDBridge, options ...Option) PeerResponseSender {
 	ctx, cancel := context.WithCancel(ctx)
-	return &peerResponseSender{
-		p:            p,
-		ctx:          ctx,
-		cancel:       cancel,
-		peerHandler:  peerHandler,
-		ipldBridge:   ipldBridge,
-		outgoingWork: make(chan struct{}, 1),
-		linkTracker:  linktracker.New(),
+	prm := &peerResponseSender{
+		p:              p,
+		ctx:            ctx,
+		cancel:         cancel,
+		peerHandler:    peerHandler,
+		ipldBridge:     ipldBridge,
+		maxMessageSize: gsmsg.DefaultMaxMessageSize,
+		outgoingWork:   make(chan struct{}, 1),
+		draining:       make(chan struct{}),
+		stopped:        make(chan struct{}),
+		linkTracker:    linktracker.New(),
+	}
+	for _, option := range options {
+		option(prm)
 	}
+	return prm
 }
 
 // Startup initiates message sending for a peer
@@ -80,21 +115,55 @@ func (prm *peerResponseSender) Shutdown() {
 	prm.cancel()
 }
 
+// Drain hands the responses waiting to go out, if any, to the peer's message
+// queue and then stops sending messages for a peer. It returns once sending
+// has stopped or the context ends.
+func (prm *peerResponseSender) Drain(ctx context.Context) error {
+	close(prm.draining)
+	select {
+	case <-prm.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // SendResponse sends a given link for a given
 // requestID across the wire, as well as its corresponding
-// block if the block is present and has not already been sent
+// block if the block is present and has not already been sent. It waits for
+// the bandwidth limiter, if any, before sending a block, and drops the block
+// if the given request context ends first.
 func (prm *peerResponseSender) SendResponse(
+	ctx context.Context,
 	requestID gsmsg.GraphSyncRequestID,
 	link ipld.Link,
 	data []byte,
 ) {
 	hasBlock := data != nil
+	if hasBlock && prm.limiter != nil {
+		prm.linkTrackerLk.RLock()
+		mayNeedBlock := prm.linkTracker.BlockRefCount(link) == 0
+		prm.linkTrackerLk.RUnlock()
+		if mayNeedBlock {
+			err := prm.limiter.WaitN(ctx, prm.p, len(data))
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	// the traversal is only recorded along with adding the block, so other
+	// requests never count on a block that was dropped
 	prm.linkTrackerLk.Lock()
+	defer prm.linkTrackerLk.Unlock()
 	sendBlock := hasBlock && prm.linkTracker.BlockRefCount(link) == 0
 	prm.linkTracker.RecordLinkTraversal(requestID, link, hasBlock)
-	prm.linkTrackerLk.Unlock()
 
-	if prm.buildResponse(func(responseBuilder *responsebuilder.ResponseBuilder) {
+	blockSize := 0
+	if sendBlock {
+		blockSize = len(data)
+	}
+	if prm.buildResponse(blockSize, func(responseBuilder *responsebuilder.ResponseBuilder) {
 		if sendBlock {
 			cidLink := link.(cidlink.Link)
 			block, err := blocks.NewBlockWithCid(data, cidLink.Cid)
@@ -109,6 +178,29 @@ func (prm *peerResponseSender) SendResponse(
 	}
 }
 
+// SendExtensionData sends extension data for the given requestID across the
+// wire with the next response for that request
+func (prm *peerResponseSender) SendExtensionData(
+	requestID gsmsg.GraphSyncRequestID,
+	extension gsmsg.GraphSyncExtension,
+) {
+	if prm.buildResponse(0, func(responseBuilder *responsebuilder.ResponseBuilder) {
+		responseBuilder.AddExtensionData(requestID, extension)
+	}) {
+		prm.signalWork()
+	}
+}
+
+// PauseRequest notifies the peer that responses for the given requestID are
+// paused
+func (prm *peerResponseSender) PauseRequest(requestID gsmsg.GraphSyncRequestID) {
+	if prm.buildResponse(0, func(responseBuilder *responsebuilder.ResponseBuilder) {
+		responseBuilder.AddPausedRequest(requestID)
+	}) {
+		prm.signalWork()
+	}
+}
+
 // FinishRequest marks the given requestID as having sent all responses
 func (prm *peerResponseSender) FinishRequest(requestID gsmsg.GraphSyncRequestID) {
 	prm.linkTrackerLk.Lock()
@@ -133,20 +225,31 @@ func (prm *peerResponseSender) FinishWithError(requestID gsmsg.GraphSyncRequestI
 }
 
 func (prm *peerResponseSender) finish(requestID gsmsg.GraphSyncRequestID, status gsmsg.GraphSyncResponseStatusCode) {
-	if prm.buildResponse(func(responseBuilder *responsebuilder.ResponseBuilder) {
+	if prm.buildResponse(0, func(responseBuilder *responsebuilder.ResponseBuilder) {
 		responseBuilder.AddCompletedRequest(requestID, status)
 	}) {
 		prm.signalWork()
 	}
 }
-func (prm *peerResponseSender) buildResponse(buildResponseFn func(*responsebuilder.ResponseBuilder)) bool {
+
+// buildResponse adds to the last response waiting to go out, first starting a
+// new one if a block of the given size would take the last one over the
+// maximum message size
+func (prm *peerResponseSender) buildResponse(blockSize int, buildResponseFn func(*responsebuilder.ResponseBuilder)) bool {
 	prm.responseBuilderLk.Lock()
 	defer prm.responseBuilderLk.Unlock()
-	if prm.responseBuilder == nil {
-		prm.responseBuilder = responsebuilder.New()
+	if len(prm.responseBuilders) == 0 ||
+		(blockSize > 0 && prm.lastResponseBuilder().Size() > 0 &&
+			prm.lastResponseBuilder().Size()+blockSize > prm.maxMessageSize) {
+		prm.responseBuilders = append(prm.responseBuilders, responsebuilder.New())
 	}
-	buildResponseFn(prm.responseBuilder)
-	return !prm.responseBuilder.Empty()
+	responseBuilder := prm.lastResponseBuilder()
+	buildResponseFn(responseBuilder)
+	return !responseBuilder.Empty()
+}
+
+func (prm *peerResponseSender) lastResponseBuilder() *responsebuilder.ResponseBuilder {
+	return prm.responseBuilders[len(prm.responseBuilders)-1]
 }
 
 func (prm *peerResponseSender) signalWork() {
@@ -157,23 +260,39 @@ func (prm *peerResponseSender) signalWork() {
 }
 
 func (prm *peerResponseSender) run() {
+	defer close(prm.stopped)
+	if prm.limiter != nil {
+		defer prm.limiter.Disconnected(prm.p)
+	}
 	for {
 		select {
 		case <-prm.ctx.Done():
 			return
 		case <-prm.outgoingWork:
-			prm.sendResponseMessage()
+			prm.sendResponseMessages()
+		case <-prm.draining:
+			prm.sendResponseMessages()
+			return
 		}
 	}
 }
 
-func (prm *peerResponseSender) sendResponseMessage() {
+func (prm *peerResponseSender) sendResponseMessages() {
 	prm.responseBuilderLk.Lock()
-	builder := prm.responseBuilder
-	prm.responseBuilder = nil
+	builders := prm.responseBuilders
+	prm.responseBuilders = nil
 	prm.responseBuilderLk.Unlock()
 
-	if builder == nil || builder.Empty() {
+	for _, builder := range builders {
+		if prm.ctx.Err() != nil {
+			return
+		}
+		prm.sendResponseMessage(builder)
+	}
+}
+
+func (prm *peerResponseSender) sendResponseMessage(builder *responsebuilder.ResponseBuilder) {
+	if builder.Empty() {
 		return
 	}
 	responses, blks, err := builder.Build(prm.ipldBridge)
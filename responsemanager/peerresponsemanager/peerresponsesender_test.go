@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"reflect"
 	"testing"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 
 	"github.com/ipfs/go-block-format"
 	gsmsg "github.com/ipfs/go-graphsync/message"
+	"github.com/ipfs/go-graphsync/metadata"
 	"github.com/ipfs/go-graphsync/testutil"
 	"github.com/ipld/go-ipld-prime"
 	"github.com/ipld/go-ipld-prime/linking/cid"
@@ -54,7 +56,7 @@ func TestPeerResponseManagerSendsResponses(t *testing.T) {
 	peerResponseManager := NewResponseSender(ctx, p, fph, ipldBridge)
 	peerResponseManager.Startup()
 
-	peerResponseManager.SendResponse(requestID1, links[0], blks[0].RawData())
+	peerResponseManager.SendResponse(ctx, requestID1, links[0], blks[0].RawData())
 
 	select {
 	case <-ctx.Done():
@@ -71,9 +73,9 @@ func TestPeerResponseManagerSendsResponses(t *testing.T) {
 		t.Fatal("Did not send correct responses for first message")
 	}
 
-	peerResponseManager.SendResponse(requestID2, links[0], blks[0].RawData())
-	peerResponseManager.SendResponse(requestID1, links[1], blks[1].RawData())
-	peerResponseManager.SendResponse(requestID1, links[2], nil)
+	peerResponseManager.SendResponse(ctx, requestID2, links[0], blks[0].RawData())
+	peerResponseManager.SendResponse(ctx, requestID1, links[1], blks[1].RawData())
+	peerResponseManager.SendResponse(ctx, requestID1, links[2], nil)
 	peerResponseManager.FinishRequest(requestID1)
 
 	// let peer reponse manager know last message was sent so message sending can continue
@@ -107,8 +109,8 @@ func TestPeerResponseManagerSendsResponses(t *testing.T) {
 		t.Fatal("Did not send proper response code in second message")
 	}
 
-	peerResponseManager.SendResponse(requestID2, links[3], blks[3].RawData())
-	peerResponseManager.SendResponse(requestID3, links[4], blks[4].RawData())
+	peerResponseManager.SendResponse(ctx, requestID2, links[3], blks[3].RawData())
+	peerResponseManager.SendResponse(ctx, requestID3, links[4], blks[4].RawData())
 	peerResponseManager.FinishRequest(requestID2)
 
 	// let peer reponse manager know last message was sent so message sending can continue
@@ -144,8 +146,8 @@ func TestPeerResponseManagerSendsResponses(t *testing.T) {
 		t.Fatal("Did not send proper response code in third message")
 	}
 
-	peerResponseManager.SendResponse(requestID3, links[0], blks[0].RawData())
-	peerResponseManager.SendResponse(requestID3, links[4], blks[4].RawData())
+	peerResponseManager.SendResponse(ctx, requestID3, links[0], blks[0].RawData())
+	peerResponseManager.SendResponse(ctx, requestID3, links[4], blks[4].RawData())
 
 	// let peer reponse manager know last message was sent so message sending can continue
 	done <- struct{}{}
@@ -166,6 +168,313 @@ func TestPeerResponseManagerSendsResponses(t *testing.T) {
 	}
 }
 
+func TestPeerResponseManagerSendsExtensionData(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	p := testutil.GeneratePeers(1)[0]
+	requestID1 := gsmsg.GraphSyncRequestID(rand.Int31())
+	blks := testutil.GenerateBlocksOfSize(5, 100)
+	links := make([]ipld.Link, 0, len(blks))
+	for _, block := range blks {
+		links = append(links, cidlink.Link{Cid: block.Cid()})
+	}
+	done := make(chan struct{}, 1)
+	sent := make(chan struct{}, 1)
+	fph := &fakePeerHandler{
+		done: done,
+		sent: sent,
+	}
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	peerResponseManager := NewResponseSender(ctx, p, fph, ipldBridge)
+	peerResponseManager.Startup()
+
+	extensionName := gsmsg.GraphSyncExtensionName("graphsync/awesome")
+	extension := gsmsg.GraphSyncExtension{
+		Name: extensionName,
+		Data: testutil.RandomBytes(100),
+	}
+	peerResponseManager.SendExtensionData(requestID1, extension)
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("Did not send first message")
+	case <-sent:
+	}
+
+	if len(fph.lastResponses) != 1 || fph.lastResponses[0].RequestID() != requestID1 ||
+		fph.lastResponses[0].Status() != gsmsg.PartialResponse {
+		t.Fatal("Did not send correct responses for first message")
+	}
+
+	returnedData, found := fph.lastResponses[0].Extension(extensionName)
+	if !found || !reflect.DeepEqual(extension.Data, returnedData) {
+		t.Fatal("Failed to encode extension")
+	}
+
+	peerResponseManager.SendResponse(ctx, requestID1, links[0], blks[0].RawData())
+	peerResponseManager.FinishRequest(requestID1)
+
+	// let peer reponse manager know last message was sent so message sending can continue
+	done <- struct{}{}
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have sent second message but didn't")
+	case <-sent:
+	}
+
+	if len(fph.lastResponses) != 1 || fph.lastResponses[0].Status() != gsmsg.RequestCompletedFull {
+		t.Fatal("Did not send correct responses for second message")
+	}
+
+	_, found = fph.lastResponses[0].Extension(extensionName)
+	if found {
+		t.Fatal("Should only send extension data once")
+	}
+}
+
+func TestPeerResponseManagerSendsPausedStatus(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	p := testutil.GeneratePeers(1)[0]
+	requestID1 := gsmsg.GraphSyncRequestID(rand.Int31())
+	blks := testutil.GenerateBlocksOfSize(5, 100)
+	links := make([]ipld.Link, 0, len(blks))
+	for _, block := range blks {
+		links = append(links, cidlink.Link{Cid: block.Cid()})
+	}
+	done := make(chan struct{}, 1)
+	sent := make(chan struct{}, 1)
+	fph := &fakePeerHandler{
+		done: done,
+		sent: sent,
+	}
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	peerResponseManager := NewResponseSender(ctx, p, fph, ipldBridge)
+	peerResponseManager.Startup()
+
+	peerResponseManager.SendResponse(ctx, requestID1, links[0], blks[0].RawData())
+	peerResponseManager.PauseRequest(requestID1)
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("Did not send first message")
+	case <-sent:
+	}
+
+	if len(fph.lastBlocks) != 1 || fph.lastBlocks[0].Cid() != blks[0].Cid() {
+		t.Fatal("Did not send correct blocks for first message")
+	}
+
+	if len(fph.lastResponses) != 1 || fph.lastResponses[0].RequestID() != requestID1 ||
+		fph.lastResponses[0].Status() != gsmsg.RequestPaused {
+		t.Fatal("Did not send paused status for first message")
+	}
+
+	peerResponseManager.SendResponse(ctx, requestID1, links[1], blks[1].RawData())
+
+	// let peer reponse manager know last message was sent so message sending can continue
+	done <- struct{}{}
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have sent second message but didn't")
+	case <-sent:
+	}
+
+	if len(fph.lastResponses) != 1 || fph.lastResponses[0].Status() != gsmsg.PartialResponse {
+		t.Fatal("Should send partial responses once request resumes")
+	}
+}
+
+func TestPeerResponseManagerSplitsLargeMessages(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	p := testutil.GeneratePeers(1)[0]
+	requestID1 := gsmsg.GraphSyncRequestID(rand.Int31())
+	blks := testutil.GenerateBlocksOfSize(3, 100)
+	links := make([]ipld.Link, 0, len(blks))
+	for _, block := range blks {
+		links = append(links, cidlink.Link{Cid: block.Cid()})
+	}
+	done := make(chan struct{}, 1)
+	sent := make(chan struct{}, 1)
+	fph := &fakePeerHandler{
+		done: done,
+		sent: sent,
+	}
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	peerResponseManager := NewResponseSender(ctx, p, fph, ipldBridge, MaxMessageSize(250))
+	peerResponseManager.Startup()
+
+	for i := range blks {
+		peerResponseManager.SendResponse(ctx, requestID1, links[i], blks[i].RawData())
+	}
+	peerResponseManager.FinishRequest(requestID1)
+
+	for i := range blks {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Did not send message for each block")
+		case <-sent:
+		}
+		if len(fph.lastBlocks) != 1 || fph.lastBlocks[0].Cid() != blks[i].Cid() {
+			t.Fatal("Did not send one block per message")
+		}
+		if len(fph.lastResponses) != 1 || fph.lastResponses[0].RequestID() != requestID1 {
+			t.Fatal("Did not send response with block")
+		}
+		linkMetadata, err := metadata.DecodeMetadata(fph.lastResponses[0].Extra(), ipldBridge)
+		if err != nil || len(linkMetadata) != 1 || linkMetadata[0].Link != links[i] {
+			t.Fatal("Did not send metadata for block in same message")
+		}
+		done <- struct{}{}
+	}
+	if fph.lastResponses[0].Status() != gsmsg.RequestCompletedFull {
+		t.Fatal("Did not complete request in last message")
+	}
+}
+
+type limitedBytes struct {
+	ctx context.Context
+	p   peer.ID
+	n   int
+}
+
+type fakeLimiter struct {
+	waits        chan limitedBytes
+	disconnected chan peer.ID
+}
+
+func (fl *fakeLimiter) WaitN(ctx context.Context, p peer.ID, n int) error {
+	fl.waits <- limitedBytes{ctx, p, n}
+	return ctx.Err()
+}
+
+func (fl *fakeLimiter) Disconnected(p peer.ID) {
+	fl.disconnected <- p
+}
+
+func TestPeerResponseManagerWaitsForBandwidthLimiter(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	p := testutil.GeneratePeers(1)[0]
+	requestID1 := gsmsg.GraphSyncRequestID(rand.Int31())
+	requestID2 := gsmsg.GraphSyncRequestID(rand.Int31())
+	blks := testutil.GenerateBlocksOfSize(5, 100)
+	links := make([]ipld.Link, 0, len(blks))
+	for _, block := range blks {
+		links = append(links, cidlink.Link{Cid: block.Cid()})
+	}
+	done := make(chan struct{}, 1)
+	sent := make(chan struct{}, 1)
+	fph := &fakePeerHandler{
+		done: done,
+		sent: sent,
+	}
+	fl := &fakeLimiter{
+		waits:        make(chan limitedBytes, len(blks)),
+		disconnected: make(chan peer.ID, 1),
+	}
+	type ctxKey struct{}
+	requestCtx := context.WithValue(ctx, ctxKey{}, "request")
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	peerResponseManager := NewResponseSender(ctx, p, fph, ipldBridge, BandwidthLimiter(fl))
+	peerResponseManager.Startup()
+
+	peerResponseManager.SendResponse(requestCtx, requestID1, links[0], blks[0].RawData())
+	peerResponseManager.SendResponse(requestCtx, requestID2, links[0], blks[0].RawData())
+	peerResponseManager.SendResponse(requestCtx, requestID1, links[1], nil)
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("Did not send first message")
+	case <-sent:
+	}
+
+	select {
+	case waited := <-fl.waits:
+		if waited.p != p || waited.n != len(blks[0].RawData()) {
+			t.Fatal("Did not wait for bandwidth for block sent")
+		}
+		if waited.ctx.Value(ctxKey{}) != "request" {
+			t.Fatal("Did not wait for bandwidth with request context")
+		}
+	default:
+		t.Fatal("Did not wait for bandwidth before sending block")
+	}
+	select {
+	case <-fl.waits:
+		t.Fatal("Should only wait for bandwidth for blocks that are sent")
+	default:
+	}
+
+	peerResponseManager.Shutdown()
+	select {
+	case <-ctx.Done():
+		t.Fatal("Did not tell limiter peer disconnected")
+	case disconnectedPeer := <-fl.disconnected:
+		if disconnectedPeer != p {
+			t.Fatal("Told limiter wrong peer disconnected")
+		}
+	}
+}
+
+func TestPeerResponseManagerSendsBlockDroppedByCancelledWait(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	p := testutil.GeneratePeers(1)[0]
+	requestID1 := gsmsg.GraphSyncRequestID(rand.Int31())
+	requestID2 := gsmsg.GraphSyncRequestID(rand.Int31())
+	blks := testutil.GenerateBlocksOfSize(1, 100)
+	link := cidlink.Link{Cid: blks[0].Cid()}
+	done := make(chan struct{}, 1)
+	sent := make(chan struct{}, 1)
+	fph := &fakePeerHandler{
+		done: done,
+		sent: sent,
+	}
+	fl := &fakeLimiter{
+		waits:        make(chan limitedBytes, 2),
+		disconnected: make(chan peer.ID, 1),
+	}
+	cancelledCtx, cancelRequest := context.WithCancel(ctx)
+	cancelRequest()
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	peerResponseManager := NewResponseSender(ctx, p, fph, ipldBridge, BandwidthLimiter(fl))
+	peerResponseManager.Startup()
+
+	// the first request's wait fails, so the block is not sent for it
+	peerResponseManager.SendResponse(cancelledCtx, requestID1, link, blks[0].RawData())
+	peerResponseManager.SendResponse(ctx, requestID2, link, blks[0].RawData())
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("Did not send message")
+	case <-sent:
+	}
+
+	if len(fph.lastBlocks) != 1 || fph.lastBlocks[0].Cid() != blks[0].Cid() {
+		t.Fatal("Did not send block for second request after first request's wait failed")
+	}
+	response, err := findResponseForRequestID(fph.lastResponses, requestID2)
+	if err != nil {
+		t.Fatal("Did not send response for second request")
+	}
+	md, err := metadata.DecodeMetadata(response.Extra(), ipldBridge)
+	if err != nil || len(md) != 1 || md[0].Link != link || !md[0].BlockPresent {
+		t.Fatal("Did not send block present metadata for second request")
+	}
+	if _, err := findResponseForRequestID(fph.lastResponses, requestID1); err == nil {
+		t.Fatal("Should not send metadata for a block the first request dropped")
+	}
+}
+
 func findResponseForRequestID(responses []gsmsg.GraphSyncResponse, requestID gsmsg.GraphSyncRequestID) (gsmsg.GraphSyncResponse, error) {
 	for _, response := range responses {
 		if response.RequestID() == requestID {
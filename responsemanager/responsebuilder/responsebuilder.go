@@ -8,6 +8,10 @@ import (
 	"github.com/ipld/go-ipld-prime"
 )
 
+// linkMetadataSize is a generous estimate of the encoded size of the metadata
+// for one link: a CID and whether its block is present
+const linkMetadataSize = 64
+
 // ResponseBuilder captures componenst of a response message across multiple
 // requests for a given peer and then generates the corresponding
 // GraphSync message components once responses are ready to send.
@@ -15,6 +19,9 @@ type ResponseBuilder struct {
 	outgoingBlocks     []blocks.Block
 	completedResponses map[gsmsg.GraphSyncRequestID]gsmsg.GraphSyncResponseStatusCode
 	outgoingResponses  map[gsmsg.GraphSyncRequestID]metadata.Metadata
+	extensions         map[gsmsg.GraphSyncRequestID][]gsmsg.GraphSyncExtension
+	pausedRequests     map[gsmsg.GraphSyncRequestID]struct{}
+	size               int
 }
 
 // New generates a new ResponseBuilder.
@@ -22,18 +29,34 @@ func New() *ResponseBuilder {
 	return &ResponseBuilder{
 		completedResponses: make(map[gsmsg.GraphSyncRequestID]gsmsg.GraphSyncResponseStatusCode),
 		outgoingResponses:  make(map[gsmsg.GraphSyncRequestID]metadata.Metadata),
+		extensions:         make(map[gsmsg.GraphSyncRequestID][]gsmsg.GraphSyncExtension),
+		pausedRequests:     make(map[gsmsg.GraphSyncRequestID]struct{}),
 	}
 }
 
 // AddBlock adds the given block to the response.
 func (rb *ResponseBuilder) AddBlock(block blocks.Block) {
 	rb.outgoingBlocks = append(rb.outgoingBlocks, block)
+	rb.size += len(block.RawData())
 }
 
 // AddLink adds the given link and whether its block is present
 // to the response for the given request ID.
 func (rb *ResponseBuilder) AddLink(requestID gsmsg.GraphSyncRequestID, link ipld.Link, blockPresent bool) {
 	rb.outgoingResponses[requestID] = append(rb.outgoingResponses[requestID], metadata.Item{Link: link, BlockPresent: blockPresent})
+	rb.size += linkMetadataSize
+}
+
+// AddExtensionData adds the given extension data to the response for the
+// given request ID.
+func (rb *ResponseBuilder) AddExtensionData(requestID gsmsg.GraphSyncRequestID, extension gsmsg.GraphSyncExtension) {
+	rb.extensions[requestID] = append(rb.extensions[requestID], extension)
+	rb.size += len(extension.Name) + len(extension.Data)
+	// make sure this extension goes out in next response even if no links are sent
+	_, ok := rb.outgoingResponses[requestID]
+	if !ok {
+		rb.outgoingResponses[requestID] = nil
+	}
 }
 
 // AddCompletedRequest marks the given request as completed in the response,
@@ -48,11 +71,28 @@ func (rb *ResponseBuilder) AddCompletedRequest(requestID gsmsg.GraphSyncRequestI
 	}
 }
 
+// AddPausedRequest marks the given request as paused in the response, unless
+// it is also completed.
+func (rb *ResponseBuilder) AddPausedRequest(requestID gsmsg.GraphSyncRequestID) {
+	rb.pausedRequests[requestID] = struct{}{}
+	// make sure the pause goes out in next response even if no links are sent
+	_, ok := rb.outgoingResponses[requestID]
+	if !ok {
+		rb.outgoingResponses[requestID] = nil
+	}
+}
+
 // Empty returns true if there is no content to send
 func (rb *ResponseBuilder) Empty() bool {
 	return len(rb.outgoingBlocks) == 0 && len(rb.outgoingResponses) == 0
 }
 
+// Size estimates the size in bytes of the blocks, link metadata and extension
+// data added to the response
+func (rb *ResponseBuilder) Size() int {
+	return rb.size
+}
+
 // Build assembles and encodes response data from the added requests, links, and blocks.
 func (rb *ResponseBuilder) Build(ipldBridge ipldbridge.IPLDBridge) ([]gsmsg.GraphSyncResponse, []blocks.Block, error) {
 	responses := make([]gsmsg.GraphSyncResponse, 0, len(rb.outgoingResponses))
@@ -62,13 +102,30 @@ func (rb *ResponseBuilder) Build(ipldBridge ipldbridge.IPLDBridge) ([]gsmsg.Grap
 			return nil, nil, err
 		}
 		status, isComplete := rb.completedResponses[requestID]
-		responses = append(responses, gsmsg.NewResponse(requestID, responseCode(status, isComplete), extra))
+		_, isPaused := rb.pausedRequests[requestID]
+		hasAdditionalPeers := hasExtension(rb.extensions[requestID], gsmsg.ExtensionAdditionalPeers)
+		responses = append(responses, gsmsg.NewResponse(requestID, responseCode(status, isComplete, isPaused, hasAdditionalPeers), extra, rb.extensions[requestID]...))
 	}
 	return responses, rb.outgoingBlocks, nil
 }
 
-func responseCode(status gsmsg.GraphSyncResponseStatusCode, isComplete bool) gsmsg.GraphSyncResponseStatusCode {
+func hasExtension(extensions []gsmsg.GraphSyncExtension, name gsmsg.GraphSyncExtensionName) bool {
+	for _, extension := range extensions {
+		if extension.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func responseCode(status gsmsg.GraphSyncResponseStatusCode, isComplete bool, isPaused bool, hasAdditionalPeers bool) gsmsg.GraphSyncResponseStatusCode {
 	if !isComplete {
+		if isPaused {
+			return gsmsg.RequestPaused
+		}
+		if hasAdditionalPeers {
+			return gsmsg.AdditionalPeers
+		}
 		return gsmsg.PartialResponse
 	}
 	return status
@@ -12,6 +12,7 @@ import (
 	"github.com/ipfs/go-graphsync/testutil"
 	"github.com/ipld/go-ipld-prime"
 	"github.com/ipld/go-ipld-prime/linking/cid"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
 )
 
 func TestMessageBuilding(t *testing.T) {
@@ -26,6 +27,8 @@ func TestMessageBuilding(t *testing.T) {
 	requestID2 := gsmsg.GraphSyncRequestID(rand.Int31())
 	requestID3 := gsmsg.GraphSyncRequestID(rand.Int31())
 	requestID4 := gsmsg.GraphSyncRequestID(rand.Int31())
+	requestID5 := gsmsg.GraphSyncRequestID(rand.Int31())
+	requestID6 := gsmsg.GraphSyncRequestID(rand.Int31())
 
 	rb.AddLink(requestID1, links[0], true)
 	rb.AddLink(requestID1, links[1], false)
@@ -44,6 +47,23 @@ func TestMessageBuilding(t *testing.T) {
 
 	rb.AddCompletedRequest(requestID4, gsmsg.RequestCompletedFull)
 
+	rb.AddLink(requestID5, links[2], true)
+	rb.AddPausedRequest(requestID5)
+
+	extensionName1 := gsmsg.GraphSyncExtensionName("graphsync/awesome")
+	extension1 := gsmsg.GraphSyncExtension{
+		Name: extensionName1,
+		Data: testutil.RandomBytes(100),
+	}
+	extensionName2 := gsmsg.GraphSyncExtensionName("graphsync/even-more-awesome")
+	extension2 := gsmsg.GraphSyncExtension{
+		Name: extensionName2,
+		Data: testutil.RandomBytes(100),
+	}
+	rb.AddExtensionData(requestID1, extension1)
+	rb.AddExtensionData(requestID3, extension2)
+	rb.AddExtensionData(requestID6, gsmsg.AdditionalPeersExtension([]pstore.PeerInfo{{ID: testutil.GeneratePeers(1)[0]}}))
+
 	for _, block := range blocks {
 		rb.AddBlock(block)
 	}
@@ -54,7 +74,7 @@ func TestMessageBuilding(t *testing.T) {
 		t.Fatal("Error building responses")
 	}
 
-	if len(responses) != 4 {
+	if len(responses) != 6 {
 		t.Fatal("Assembled wrong number of responses")
 	}
 
@@ -72,6 +92,11 @@ func TestMessageBuilding(t *testing.T) {
 		t.Fatal("Metadata did not match expected")
 	}
 
+	response1ReturnedExtensionData, found := response1.Extension(extensionName1)
+	if !found || !reflect.DeepEqual(extension1.Data, response1ReturnedExtensionData) {
+		t.Fatal("Failed to encode first extension")
+	}
+
 	response2, err := findResponseForRequestID(responses, requestID2)
 	if err != nil || response2.Status() != gsmsg.RequestCompletedFull {
 		t.Fatal("did not generate completed partial response")
@@ -97,11 +122,26 @@ func TestMessageBuilding(t *testing.T) {
 		t.Fatal("Metadata did not match expected")
 	}
 
+	response3ReturnedExtensionData, found := response3.Extension(extensionName2)
+	if !found || !reflect.DeepEqual(extension2.Data, response3ReturnedExtensionData) {
+		t.Fatal("Failed to encode second extension")
+	}
+
 	response4, err := findResponseForRequestID(responses, requestID4)
 	if err != nil || response4.Status() != gsmsg.RequestCompletedFull {
 		t.Fatal("did not generate completed partial response")
 	}
 
+	response5, err := findResponseForRequestID(responses, requestID5)
+	if err != nil || response5.Status() != gsmsg.RequestPaused {
+		t.Fatal("did not generate paused response")
+	}
+
+	response6, err := findResponseForRequestID(responses, requestID6)
+	if err != nil || response6.Status() != gsmsg.AdditionalPeers {
+		t.Fatal("did not generate additional peers response")
+	}
+
 	if len(sentBlocks) != len(blocks) {
 		t.Fatal("Did not send all blocks")
 	}
@@ -121,3 +161,33 @@ func findResponseForRequestID(responses []gsmsg.GraphSyncResponse, requestID gsm
 	}
 	return gsmsg.GraphSyncResponse{}, fmt.Errorf("Response Not Found")
 }
+
+func TestResponseBuilderSize(t *testing.T) {
+	rb := New()
+	blocks := testutil.GenerateBlocksOfSize(2, 100)
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	if rb.Size() != 0 {
+		t.Fatal("Empty builder should have no size")
+	}
+
+	rb.AddBlock(blocks[0])
+	rb.AddLink(requestID, cidlink.Link{Cid: blocks[0].Cid()}, true)
+	blockSize := rb.Size()
+	if blockSize <= 100 {
+		t.Fatal("Size should include block data and link metadata")
+	}
+
+	rb.AddLink(requestID, cidlink.Link{Cid: blocks[1].Cid()}, false)
+	if rb.Size() <= blockSize {
+		t.Fatal("Size should grow with link metadata")
+	}
+
+	sizeWithLinks := rb.Size()
+	rb.AddExtensionData(requestID, gsmsg.GraphSyncExtension{
+		Name: gsmsg.GraphSyncExtensionName("graphsync/awesome"),
+		Data: testutil.RandomBytes(100),
+	})
+	if rb.Size() <= sizeWithLinks+100 {
+		t.Fatal("Size should include extension data")
+	}
+}
@@ -2,8 +2,12 @@ package responsemanager
 
 import (
 	"context"
+	"errors"
+	"io"
+	"sync"
 	"time"
 
+	"github.com/ipfs/go-graphsync/requestcontext"
 	"github.com/ipfs/go-graphsync/responsemanager/loader"
 	ipld "github.com/ipld/go-ipld-prime"
 
@@ -15,14 +19,21 @@ import (
 )
 
 const (
-	maxInProcessRequests = 6
-	thawSpeed            = time.Millisecond * 100
+	defaultMaxInProcessRequests = 6
+	defaultThawSpeed            = time.Millisecond * 100
+	defaultMessageBufferSize    = 16
 )
 
 type inProgressResponseStatus struct {
-	ctx      context.Context
-	cancelFn func()
-	selector []byte
+	ctx            context.Context
+	cancelFn       func()
+	request        gsmsg.GraphSyncRequest
+	isRunning      bool
+	isPaused       bool
+	pauseSignal    chan struct{}
+	traversedLinks int
+	budget         *loader.BudgetTracker
+	loader         ipldbridge.ContextLoader
 }
 
 type responseKey struct {
@@ -31,8 +42,13 @@ type responseKey struct {
 }
 
 type responseTaskData struct {
-	ctx      context.Context
-	selector []byte
+	ctx            context.Context
+	selector       []byte
+	traversedLinks int
+	pauseSignal    chan struct{}
+	blockHooks     []OutgoingBlockHook
+	budget         *loader.BudgetTracker
+	loader         ipldbridge.ContextLoader
 }
 
 // QueryQueue is an interface that can receive new selector query tasks
@@ -58,7 +74,7 @@ type responseManagerMessage interface {
 type ResponseManager struct {
 	ctx         context.Context
 	cancelFn    context.CancelFunc
-	loader      ipldbridge.Loader
+	loader      ipldbridge.ContextLoader
 	ipldBridge  ipldbridge.IPLDBridge
 	peerManager PeerManager
 	queryQueue  QueryQueue
@@ -67,28 +83,101 @@ type ResponseManager struct {
 	workSignal          chan struct{}
 	ticker              *time.Ticker
 	inProgressResponses map[responseKey]inProgressResponseStatus
+	requestHooks        []RequestReceivedHook
+	updateHooks         []RequestUpdatedHook
+	blockHooks          []OutgoingBlockHook
+	maxQueuedResponses  int
+	busyRetryAfter      time.Duration
+	defaultBudget       loader.Budget
+	peerDefaultBudgets  map[peer.ID]loader.Budget
+	defaultPeerBudget   loader.Budget
+	peerBudgets         map[peer.ID]loader.Budget
+	peerBudgetTrackers  map[peer.ID]*loader.PeerBudgetTracker
+
+	maxInProcessRequests int
+	thawSpeed            time.Duration
+	running              sync.WaitGroup
+	isShuttingDown       bool
+}
+
+// Option configures a ResponseManager
+type Option func(*ResponseManager)
+
+// MaxInProcessRequests sets how many responses are worked on at once.
+func MaxInProcessRequests(maxInProcessRequests int) Option {
+	return func(rm *ResponseManager) {
+		rm.maxInProcessRequests = maxInProcessRequests
+	}
+}
+
+// ThawSpeed sets how often peers that have been frozen in the query queue,
+// after receiving their share of work, are thawed a round.
+func ThawSpeed(thawSpeed time.Duration) Option {
+	return func(rm *ResponseManager) {
+		rm.thawSpeed = thawSpeed
+	}
+}
+
+// MaxQueuedResponses limits how many responses can wait in the queue for a
+// worker, as SetMaxQueuedResponses does.
+func MaxQueuedResponses(maxQueuedResponses int, retryAfter time.Duration) Option {
+	return func(rm *ResponseManager) {
+		rm.maxQueuedResponses = maxQueuedResponses
+		rm.busyRetryAfter = retryAfter
+	}
+}
+
+// MessageBufferSize sets how many incoming messages the manager buffers before
+// callers block.
+func MessageBufferSize(messageBufferSize int) Option {
+	return func(rm *ResponseManager) {
+		rm.messages = make(chan responseManagerMessage, messageBufferSize)
+	}
+}
+
+// DefaultBudget sets the budget for each traversal for peers that have no
+// default of their own, as set with SetPeerDefaultBudget.
+func DefaultBudget(budget loader.Budget) Option {
+	return func(rm *ResponseManager) {
+		rm.defaultBudget = budget
+	}
+}
+
+// DefaultPeerBudget sets the budget shared by all the responses in progress to
+// each peer that has no shared budget of its own, as set with SetPeerBudget.
+func DefaultPeerBudget(budget loader.Budget) Option {
+	return func(rm *ResponseManager) {
+		rm.defaultPeerBudget = budget
+	}
 }
 
 // New creates a new response manager from the given context, loader,
 // bridge to IPLD interface, peerManager, and queryQueue.
 func New(ctx context.Context,
-	loader ipldbridge.Loader,
+	loader ipldbridge.ContextLoader,
 	ipldBridge ipldbridge.IPLDBridge,
 	peerManager PeerManager,
-	queryQueue QueryQueue) *ResponseManager {
+	queryQueue QueryQueue,
+	options ...Option) *ResponseManager {
 	ctx, cancelFn := context.WithCancel(ctx)
-	return &ResponseManager{
-		ctx:                 ctx,
-		cancelFn:            cancelFn,
-		loader:              loader,
-		ipldBridge:          ipldBridge,
-		peerManager:         peerManager,
-		queryQueue:          queryQueue,
-		messages:            make(chan responseManagerMessage, 16),
-		workSignal:          make(chan struct{}, 1),
-		ticker:              time.NewTicker(thawSpeed),
-		inProgressResponses: make(map[responseKey]inProgressResponseStatus),
+	rm := &ResponseManager{
+		ctx:                  ctx,
+		cancelFn:             cancelFn,
+		loader:               loader,
+		ipldBridge:           ipldBridge,
+		peerManager:          peerManager,
+		queryQueue:           queryQueue,
+		messages:             make(chan responseManagerMessage, defaultMessageBufferSize),
+		workSignal:           make(chan struct{}, 1),
+		inProgressResponses:  make(map[responseKey]inProgressResponseStatus),
+		maxInProcessRequests: defaultMaxInProcessRequests,
+		thawSpeed:            defaultThawSpeed,
+	}
+	for _, option := range options {
+		option(rm)
 	}
+	rm.ticker = time.NewTicker(rm.thawSpeed)
+	return rm
 }
 
 type processRequestMessage struct {
@@ -105,6 +194,147 @@ func (rm *ResponseManager) ProcessRequests(ctx context.Context, p peer.ID, reque
 	}
 }
 
+type registerRequestHookMessage struct {
+	hook RequestReceivedHook
+}
+
+// RegisterRequestHook registers a hook that runs when a new request is received,
+// before it is queued for processing
+func (rm *ResponseManager) RegisterRequestHook(hook RequestReceivedHook) {
+	select {
+	case rm.messages <- &registerRequestHookMessage{hook}:
+	case <-rm.ctx.Done():
+	}
+}
+
+type registerUpdateHookMessage struct {
+	hook RequestUpdatedHook
+}
+
+// RegisterUpdateHook registers a hook that runs when an update is received
+// for an in progress response
+func (rm *ResponseManager) RegisterUpdateHook(hook RequestUpdatedHook) {
+	select {
+	case rm.messages <- &registerUpdateHookMessage{hook}:
+	case <-rm.ctx.Done():
+	}
+}
+
+type registerBlockHookMessage struct {
+	hook OutgoingBlockHook
+}
+
+// RegisterBlockHook registers a hook that runs each time a block is sent
+// for a response
+func (rm *ResponseManager) RegisterBlockHook(hook OutgoingBlockHook) {
+	select {
+	case rm.messages <- &registerBlockHookMessage{hook}:
+	case <-rm.ctx.Done():
+	}
+}
+
+type setMaxQueuedResponsesMessage struct {
+	maxQueuedResponses int
+	retryAfter         time.Duration
+}
+
+// SetMaxQueuedResponses limits how many responses can wait in the queue for a
+// worker. Requests received while the queue is full are refused with
+// RequestFailedBusy, asking the requester to retry after the given duration.
+// Zero means no limit.
+func (rm *ResponseManager) SetMaxQueuedResponses(maxQueuedResponses int, retryAfter time.Duration) {
+	select {
+	case rm.messages <- &setMaxQueuedResponsesMessage{maxQueuedResponses, retryAfter}:
+	case <-rm.ctx.Done():
+	}
+}
+
+type setPeerDefaultBudgetMessage struct {
+	p      peer.ID
+	budget loader.Budget
+}
+
+// SetPeerDefaultBudget sets the budget given to each request from the given
+// peer, in place of the default budget. Every request gets the full budget;
+// SetPeerBudget limits the peer's requests as a whole. Request hooks can still
+// set a budget for a single request. It applies to requests received after it
+// is set.
+func (rm *ResponseManager) SetPeerDefaultBudget(p peer.ID, budget loader.Budget) {
+	select {
+	case rm.messages <- &setPeerDefaultBudgetMessage{p, budget}:
+	case <-rm.ctx.Done():
+	}
+}
+
+type setPeerBudgetMessage struct {
+	p      peer.ID
+	budget loader.Budget
+}
+
+// SetPeerBudget sets the budget shared by all the responses in progress to the
+// given peer, in place of the default peer budget. What a response spent is
+// given back when it finishes. Each response is still limited by its own
+// budget as well.
+func (rm *ResponseManager) SetPeerBudget(p peer.ID, budget loader.Budget) {
+	select {
+	case rm.messages <- &setPeerBudgetMessage{p, budget}:
+	case <-rm.ctx.Done():
+	}
+}
+
+type pauseRequestMessage struct {
+	p         peer.ID
+	requestID gsmsg.GraphSyncRequestID
+	response  chan error
+}
+
+// PauseResponse stops sending blocks for a response, without holding a
+// worker while paused. An in progress traversal pauses after the next block
+// is sent.
+func (rm *ResponseManager) PauseResponse(p peer.ID, requestID gsmsg.GraphSyncRequestID) error {
+	response := make(chan error, 1)
+	return rm.sendSyncMessage(&pauseRequestMessage{p, requestID, response}, response)
+}
+
+type unpauseRequestMessage struct {
+	p         peer.ID
+	requestID gsmsg.GraphSyncRequestID
+	response  chan error
+}
+
+// UnpauseResponse resumes sending blocks for a response that was paused
+func (rm *ResponseManager) UnpauseResponse(p peer.ID, requestID gsmsg.GraphSyncRequestID) error {
+	response := make(chan error, 1)
+	return rm.sendSyncMessage(&unpauseRequestMessage{p, requestID, response}, response)
+}
+
+func (rm *ResponseManager) sendSyncMessage(message responseManagerMessage, response chan error) error {
+	select {
+	case rm.messages <- message:
+	case <-rm.ctx.Done():
+		return errors.New("Context Cancelled")
+	}
+	select {
+	case err := <-response:
+		return err
+	case <-rm.ctx.Done():
+		return errors.New("Context Cancelled")
+	}
+}
+
+type peerDisconnectedMessage struct {
+	p peer.ID
+}
+
+// Disconnected cancels all responses to the given peer, which has
+// disconnected.
+func (rm *ResponseManager) Disconnected(p peer.ID) {
+	select {
+	case rm.messages <- &peerDisconnectedMessage{p}:
+	case <-rm.ctx.Done():
+	}
+}
+
 type synchronizeMessage struct {
 	sync chan struct{}
 }
@@ -128,7 +358,9 @@ type responseDataRequest struct {
 }
 
 type finishResponseRequest struct {
-	key responseKey
+	key            responseKey
+	isPaused       bool
+	traversedLinks int
 }
 
 func (rm *ResponseManager) processQueriesWorker() {
@@ -159,9 +391,12 @@ func (rm *ResponseManager) processQueriesWorker() {
 			case <-rm.ctx.Done():
 				return
 			}
-			rm.executeQuery(taskData.ctx, key.p, key.requestID, taskData.selector)
+			if taskData == nil {
+				continue
+			}
+			isPaused, traversedLinks := rm.executeQuery(key, taskData)
 			select {
-			case rm.messages <- &finishResponseRequest{key}:
+			case rm.messages <- &finishResponseRequest{key, isPaused, traversedLinks}:
 			case <-rm.ctx.Done():
 			}
 		}
@@ -175,38 +410,129 @@ func noopVisitor(ipldbridge.TraversalProgress, ipld.Node, ipldbridge.TraversalRe
 	return nil
 }
 
-func (rm *ResponseManager) executeQuery(ctx context.Context,
-	p peer.ID,
-	requestID gsmsg.GraphSyncRequestID,
-	selector []byte) {
+// executeQuery runs the traversal for a response, returning whether the
+// response was paused and how many links have been traversed so far
+func (rm *ResponseManager) executeQuery(key responseKey, taskData *responseTaskData) (bool, int) {
+	p := key.p
+	requestID := key.requestID
 	peerResponseSender := rm.peerManager.SenderForPeer(p)
-	selectorSpec, err := rm.ipldBridge.DecodeNode(selector)
+	selectorSpec, err := rm.ipldBridge.DecodeNode(taskData.selector)
 	if err != nil {
 		peerResponseSender.FinishWithError(requestID, gsmsg.RequestFailedUnknown)
-		return
+		return false, 0
 	}
 	root, reifiedSelector, err := rm.ipldBridge.DecodeSelectorSpec(selectorSpec)
 	if err != nil {
 		peerResponseSender.FinishWithError(requestID, gsmsg.RequestFailedUnknown)
-		return
+		return false, 0
+	}
+	hookActions := &blockHookActions{requestID: requestID, peerResponseSender: peerResponseSender}
+	blockHook := func(link ipld.Link, data []byte) error {
+		for _, outgoingBlockHook := range taskData.blockHooks {
+			outgoingBlockHook(p, requestID, link, uint64(len(data)), hookActions)
+			if hookActions.isTerminated {
+				break
+			}
+		}
+		select {
+		case <-taskData.pauseSignal:
+			hookActions.PauseResponse()
+		default:
+		}
+		return hookActions.haltError()
+	}
+	requestCtx := requestcontext.New(taskData.ctx, p, requestID)
+	wrappedLoader := loader.WrapLoader(requestCtx, taskData.loader, requestID, peerResponseSender, taskData.budget, blockHook)
+
+	// links traversed before the response was paused were already sent, so
+	// they are loaded but not sent again when the traversal resumes. Links the
+	// depth limit skipped are counted too, and are skipped again here so the
+	// replay follows the same links. Since the replay starts from the root, a
+	// response paused many times loads its early blocks again on each resume.
+	skipLinks := taskData.traversedLinks
+	traversedLinks := taskData.traversedLinks
+	resumingLoader := func(lnk ipld.Link, lnkCtx ipldbridge.LinkContext) (io.Reader, error) {
+		if skipLinks > 0 {
+			skipLinks--
+			if taskData.budget.IsTooDeep(lnkCtx) {
+				return nil, ipldbridge.ErrDoNotFollow()
+			}
+			result, err := taskData.loader(requestCtx, lnk, lnkCtx)
+			if err != nil {
+				return nil, ipldbridge.ErrDoNotFollow()
+			}
+			return result, nil
+		}
+		traversedLinks++
+		return wrappedLoader(lnk, lnkCtx)
+	}
+	taskData.budget.Start()
+	err = rm.ipldBridge.Traverse(taskData.ctx, resumingLoader, root, reifiedSelector, noopVisitor)
+	taskData.budget.Stop()
+	if hookActions.isTerminated {
+		peerResponseSender.FinishWithError(requestID, hookActions.status)
+		return false, traversedLinks
+	}
+	if hookActions.isPaused {
+		peerResponseSender.PauseRequest(requestID)
+		return true, traversedLinks
+	}
+	if limit, exceeded := taskData.budget.Exceeded(); exceeded && taskData.ctx.Err() == nil {
+		peerResponseSender.SendExtensionData(requestID, gsmsg.BudgetExceededExtension(string(limit)))
+		peerResponseSender.FinishWithError(requestID, gsmsg.RequestCompletedPartial)
+		return false, traversedLinks
 	}
-	wrappedLoader := loader.WrapLoader(rm.loader, requestID, peerResponseSender)
-	err = rm.ipldBridge.Traverse(ctx, wrappedLoader, root, reifiedSelector, noopVisitor)
 	if err != nil {
 		peerResponseSender.FinishWithError(requestID, gsmsg.RequestFailedUnknown)
-		return
+		return false, traversedLinks
 	}
 	peerResponseSender.FinishRequest(requestID)
+	return false, traversedLinks
 }
 
 // Startup starts processing for the WantManager.
 func (rm *ResponseManager) Startup() {
+	rm.running.Add(1)
 	go rm.run()
 }
 
-// Shutdown ends processing for the want manager.
-func (rm *ResponseManager) Shutdown() {
+type shutdownMessage struct {
+	done chan struct{}
+}
+
+// Shutdown fails all in progress responses with RequestFailedUnknown and ends
+// processing for the response manager. It returns once the manager and its
+// workers have stopped, or the context ends. Requests received after Shutdown
+// are failed with RequestFailedUnknown.
+func (rm *ResponseManager) Shutdown(ctx context.Context) error {
+	defer rm.cancelFn()
+	done := make(chan struct{})
+	select {
+	case rm.messages <- &shutdownMessage{done}:
+	case <-rm.ctx.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+	case <-rm.ctx.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 	rm.cancelFn()
+	stopped := make(chan struct{})
+	go func() {
+		rm.running.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (rm *ResponseManager) cleanupInProcessResponses() {
@@ -216,9 +542,14 @@ func (rm *ResponseManager) cleanupInProcessResponses() {
 }
 
 func (rm *ResponseManager) run() {
+	defer rm.running.Done()
 	defer rm.cleanupInProcessResponses()
-	for i := 0; i < maxInProcessRequests; i++ {
-		go rm.processQueriesWorker()
+	for i := 0; i < rm.maxInProcessRequests; i++ {
+		rm.running.Add(1)
+		go func() {
+			defer rm.running.Done()
+			rm.processQueriesWorker()
+		}()
 	}
 
 	for {
@@ -231,16 +562,139 @@ func (rm *ResponseManager) run() {
 	}
 }
 
+func (rm *ResponseManager) isBusy() bool {
+	if rm.maxQueuedResponses <= 0 {
+		return false
+	}
+	queuedResponses := 0
+	for _, response := range rm.inProgressResponses {
+		if !response.isRunning && !response.isPaused {
+			queuedResponses++
+		}
+	}
+	return queuedResponses >= rm.maxQueuedResponses
+}
+
+// validateRequest runs request hooks for a new request, returning whether
+// it was accepted, and the budget and loader for its traversal
+func (rm *ResponseManager) validateRequest(p peer.ID, request gsmsg.GraphSyncRequest) (loader.Budget, ipldbridge.ContextLoader, bool) {
+	budget, ok := rm.peerDefaultBudgets[p]
+	if !ok {
+		budget = rm.defaultBudget
+	}
+	if len(rm.requestHooks) == 0 {
+		return budget, rm.loader, true
+	}
+	peerResponseSender := rm.peerManager.SenderForPeer(p)
+	selectorSpec, err := rm.ipldBridge.DecodeNode(request.Selector())
+	if err != nil {
+		peerResponseSender.FinishWithError(request.ID(), gsmsg.RequestFailedUnknown)
+		return budget, nil, false
+	}
+	hookActions := &requestHookActions{}
+	for _, requestHook := range rm.requestHooks {
+		requestHook(p, request, selectorSpec, hookActions)
+		if hookActions.isRejected {
+			break
+		}
+	}
+	for _, extension := range hookActions.extensions {
+		peerResponseSender.SendExtensionData(request.ID(), extension)
+	}
+	if hookActions.isRejected {
+		peerResponseSender.FinishWithError(request.ID(), hookActions.status)
+		return budget, nil, false
+	}
+	if hookActions.budget != nil {
+		budget = *hookActions.budget
+	}
+	if hookActions.loader != nil {
+		return budget, hookActions.loader, true
+	}
+	return budget, rm.loader, true
+}
+
+// peerBudgetTracker returns the tracker for the budget shared by the peer's
+// responses, or nil if the peer has no shared budget
+func (rm *ResponseManager) peerBudgetTracker(p peer.ID) *loader.PeerBudgetTracker {
+	if peerBudgetTracker, ok := rm.peerBudgetTrackers[p]; ok {
+		return peerBudgetTracker
+	}
+	budget, ok := rm.peerBudgets[p]
+	if !ok {
+		budget = rm.defaultPeerBudget
+	}
+	if budget == (loader.Budget{}) {
+		return nil
+	}
+	if rm.peerBudgetTrackers == nil {
+		rm.peerBudgetTrackers = make(map[peer.ID]*loader.PeerBudgetTracker)
+	}
+	peerBudgetTracker := loader.NewPeerBudgetTracker(budget)
+	rm.peerBudgetTrackers[p] = peerBudgetTracker
+	return peerBudgetTracker
+}
+
+func (rm *ResponseManager) processUpdate(key responseKey, update gsmsg.GraphSyncRequest) {
+	response, ok := rm.inProgressResponses[key]
+	if !ok {
+		return
+	}
+	hookActions := &updateHookActions{}
+	for _, updateHook := range rm.updateHooks {
+		updateHook(key.p, response.request, update, hookActions)
+	}
+	peerResponseSender := rm.peerManager.SenderForPeer(key.p)
+	for _, extension := range hookActions.extensions {
+		peerResponseSender.SendExtensionData(key.requestID, extension)
+	}
+	pauseData, hasPause := update.Extension(gsmsg.ExtensionPause)
+	if hasPause && len(pauseData) == 1 {
+		switch pauseData[0] {
+		case 1:
+			hookActions.PauseResponse()
+		case 0:
+			hookActions.UnpauseResponse()
+		}
+	}
+	// updates are not acknowledged, so a pause or unpause that does not
+	// apply to the response's current state is ignored
+	if hookActions.isPaused {
+		_ = rm.pauseResponse(key)
+	} else if hookActions.isUnpaused {
+		_ = rm.unpauseResponse(key)
+	}
+}
+
 func (prm *processRequestMessage) handle(rm *ResponseManager) {
 	for _, request := range prm.requests {
 		key := responseKey{p: prm.p, requestID: request.ID()}
-		if !request.IsCancel() {
+		if request.IsUpdate() {
+			rm.processUpdate(key, request)
+		} else if !request.IsCancel() {
+			if rm.isShuttingDown {
+				rm.peerManager.SenderForPeer(prm.p).FinishWithError(request.ID(), gsmsg.RequestFailedUnknown)
+				continue
+			}
+			if rm.isBusy() {
+				peerResponseSender := rm.peerManager.SenderForPeer(prm.p)
+				peerResponseSender.SendExtensionData(request.ID(), gsmsg.RetryAfterExtension(rm.busyRetryAfter))
+				peerResponseSender.FinishWithError(request.ID(), gsmsg.RequestFailedBusy)
+				continue
+			}
+			budget, responseLoader, ok := rm.validateRequest(prm.p, request)
+			if !ok {
+				continue
+			}
 			ctx, cancelFn := context.WithCancel(rm.ctx)
 			rm.inProgressResponses[key] =
 				inProgressResponseStatus{
-					ctx:      ctx,
-					cancelFn: cancelFn,
-					selector: request.Selector(),
+					ctx:         ctx,
+					cancelFn:    cancelFn,
+					request:     request,
+					pauseSignal: make(chan struct{}, 1),
+					budget:      loader.NewBudgetTracker(budget, rm.peerBudgetTracker(prm.p)),
+					loader:      responseLoader,
 				}
 			rm.queryQueue.PushBlock(prm.p, peertask.Task{Identifier: key, Priority: int(request.Priority())})
 			select {
@@ -252,16 +706,40 @@ func (prm *processRequestMessage) handle(rm *ResponseManager) {
 			response, ok := rm.inProgressResponses[key]
 			if ok {
 				response.cancelFn()
+				// queued and paused responses have no running traversal to
+				// clean them up
+				if !response.isRunning {
+					delete(rm.inProgressResponses, key)
+					response.budget.Release()
+				}
 			}
 		}
 	}
 }
 
+func (pdm *peerDisconnectedMessage) handle(rm *ResponseManager) {
+	for key, response := range rm.inProgressResponses {
+		if key.p != pdm.p {
+			continue
+		}
+		rm.queryQueue.Remove(key, key.p)
+		response.cancelFn()
+		// running traversals clean up their response when they finish
+		if !response.isRunning {
+			delete(rm.inProgressResponses, key)
+			response.budget.Release()
+		}
+	}
+	delete(rm.peerBudgetTrackers, pdm.p)
+}
+
 func (rdr *responseDataRequest) handle(rm *ResponseManager) {
 	response, ok := rm.inProgressResponses[rdr.key]
 	var taskData *responseTaskData
 	if ok {
-		taskData = &responseTaskData{response.ctx, response.selector}
+		response.isRunning = true
+		rm.inProgressResponses[rdr.key] = response
+		taskData = &responseTaskData{response.ctx, response.request.Selector(), response.traversedLinks, response.pauseSignal, rm.blockHooks, response.budget, response.loader}
 	} else {
 		taskData = nil
 	}
@@ -276,8 +754,116 @@ func (frr *finishResponseRequest) handle(rm *ResponseManager) {
 	if !ok {
 		return
 	}
+	if frr.isPaused && response.ctx.Err() == nil {
+		response.isRunning = false
+		response.isPaused = true
+		response.traversedLinks = frr.traversedLinks
+		rm.inProgressResponses[frr.key] = response
+		return
+	}
 	delete(rm.inProgressResponses, frr.key)
 	response.cancelFn()
+	response.budget.Release()
+}
+
+func (rm *ResponseManager) pauseResponse(key responseKey) error {
+	response, ok := rm.inProgressResponses[key]
+	if !ok {
+		return errors.New("could not find request")
+	}
+	if response.isPaused {
+		return errors.New("request is already paused")
+	}
+	if response.isRunning {
+		// the traversal picks up the signal after the next block is sent
+		select {
+		case response.pauseSignal <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	rm.queryQueue.Remove(key, key.p)
+	response.isPaused = true
+	rm.inProgressResponses[key] = response
+	rm.peerManager.SenderForPeer(key.p).PauseRequest(key.requestID)
+	return nil
+}
+
+func (rm *ResponseManager) unpauseResponse(key responseKey) error {
+	response, ok := rm.inProgressResponses[key]
+	if !ok {
+		return errors.New("could not find request")
+	}
+	if response.isRunning {
+		// withdraw a pause the traversal has not picked up yet
+		select {
+		case <-response.pauseSignal:
+			return nil
+		default:
+			return errors.New("request is not paused")
+		}
+	}
+	if !response.isPaused {
+		return errors.New("request is not paused")
+	}
+	response.isPaused = false
+	rm.inProgressResponses[key] = response
+	rm.queryQueue.PushBlock(key.p, peertask.Task{Identifier: key, Priority: int(response.request.Priority())})
+	select {
+	case rm.workSignal <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (prm *pauseRequestMessage) handle(rm *ResponseManager) {
+	err := rm.pauseResponse(responseKey{prm.p, prm.requestID})
+	select {
+	case <-rm.ctx.Done():
+	case prm.response <- err:
+	}
+}
+
+func (urm *unpauseRequestMessage) handle(rm *ResponseManager) {
+	err := rm.unpauseResponse(responseKey{urm.p, urm.requestID})
+	select {
+	case <-rm.ctx.Done():
+	case urm.response <- err:
+	}
+}
+
+func (smqrm *setMaxQueuedResponsesMessage) handle(rm *ResponseManager) {
+	rm.maxQueuedResponses = smqrm.maxQueuedResponses
+	rm.busyRetryAfter = smqrm.retryAfter
+}
+
+func (spdbm *setPeerDefaultBudgetMessage) handle(rm *ResponseManager) {
+	if rm.peerDefaultBudgets == nil {
+		rm.peerDefaultBudgets = make(map[peer.ID]loader.Budget)
+	}
+	rm.peerDefaultBudgets[spdbm.p] = spdbm.budget
+}
+
+func (spbm *setPeerBudgetMessage) handle(rm *ResponseManager) {
+	if rm.peerBudgets == nil {
+		rm.peerBudgets = make(map[peer.ID]loader.Budget)
+	}
+	rm.peerBudgets[spbm.p] = spbm.budget
+	if peerBudgetTracker, ok := rm.peerBudgetTrackers[spbm.p]; ok {
+		peerBudgetTracker.SetBudget(spbm.budget)
+	}
+}
+
+func (rhm *registerRequestHookMessage) handle(rm *ResponseManager) {
+	rm.requestHooks = append(rm.requestHooks, rhm.hook)
+}
+
+func (ruhm *registerUpdateHookMessage) handle(rm *ResponseManager) {
+	rm.updateHooks = append(rm.updateHooks, ruhm.hook)
+}
+
+func (rbhm *registerBlockHookMessage) handle(rm *ResponseManager) {
+	rm.blockHooks = append(rm.blockHooks, rbhm.hook)
 }
 
 func (sm *synchronizeMessage) handle(rm *ResponseManager) {
@@ -286,3 +872,18 @@ func (sm *synchronizeMessage) handle(rm *ResponseManager) {
 	case sm.sync <- struct{}{}:
 	}
 }
+
+func (sm *shutdownMessage) handle(rm *ResponseManager) {
+	rm.isShuttingDown = true
+	for key, response := range rm.inProgressResponses {
+		response.cancelFn()
+		// running traversals fail their own responses once cancelled
+		if response.isRunning {
+			continue
+		}
+		rm.queryQueue.Remove(key, key.p)
+		rm.peerManager.SenderForPeer(key.p).FinishWithError(key.requestID, gsmsg.RequestFailedUnknown)
+		delete(rm.inProgressResponses, key)
+	}
+	close(sm.done)
+}
@@ -2,6 +2,7 @@ package responsemanager
 
 import (
 	"context"
+	"io"
 	"math"
 	"math/rand"
 	"reflect"
@@ -10,7 +11,10 @@ import (
 	"time"
 
 	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-graphsync/ipldbridge"
 	gsmsg "github.com/ipfs/go-graphsync/message"
+	"github.com/ipfs/go-graphsync/requestcontext"
+	"github.com/ipfs/go-graphsync/responsemanager/loader"
 	"github.com/ipfs/go-graphsync/responsemanager/peerresponsemanager"
 	"github.com/ipfs/go-peertaskqueue/peertask"
 	"github.com/ipfs/go-graphsync/testbridge"
@@ -86,15 +90,29 @@ type sentResponse struct {
 	data      []byte
 }
 
+type sentExtension struct {
+	requestID gsmsg.GraphSyncRequestID
+	extension gsmsg.GraphSyncExtension
+}
+
+type completedRequest struct {
+	requestID gsmsg.GraphSyncRequestID
+	status    gsmsg.GraphSyncResponseStatusCode
+}
+
 type fakePeerResponseSender struct {
 	sentResponses        chan sentResponse
-	lastCompletedRequest chan gsmsg.GraphSyncRequestID
+	sentExtensions       chan sentExtension
+	pausedRequests       chan gsmsg.GraphSyncRequestID
+	lastCompletedRequest chan completedRequest
 }
 
-func (fprs *fakePeerResponseSender) Startup()  {}
-func (fprs *fakePeerResponseSender) Shutdown() {}
+func (fprs *fakePeerResponseSender) Startup()                    {}
+func (fprs *fakePeerResponseSender) Shutdown()                   {}
+func (fprs *fakePeerResponseSender) Drain(context.Context) error { return nil }
 
 func (fprs *fakePeerResponseSender) SendResponse(
+	ctx context.Context,
 	requestID gsmsg.GraphSyncRequestID,
 	link ipld.Link,
 	data []byte,
@@ -102,12 +120,23 @@ func (fprs *fakePeerResponseSender) SendResponse(
 	fprs.sentResponses <- sentResponse{requestID, link, data}
 }
 
+func (fprs *fakePeerResponseSender) SendExtensionData(
+	requestID gsmsg.GraphSyncRequestID,
+	extension gsmsg.GraphSyncExtension,
+) {
+	fprs.sentExtensions <- sentExtension{requestID, extension}
+}
+
+func (fprs *fakePeerResponseSender) PauseRequest(requestID gsmsg.GraphSyncRequestID) {
+	fprs.pausedRequests <- requestID
+}
+
 func (fprs *fakePeerResponseSender) FinishRequest(requestID gsmsg.GraphSyncRequestID) {
-	fprs.lastCompletedRequest <- requestID
+	fprs.lastCompletedRequest <- completedRequest{requestID, gsmsg.RequestCompletedFull}
 }
 
 func (fprs *fakePeerResponseSender) FinishWithError(requestID gsmsg.GraphSyncRequestID, status gsmsg.GraphSyncResponseStatusCode) {
-	fprs.lastCompletedRequest <- requestID
+	fprs.lastCompletedRequest <- completedRequest{requestID, status}
 }
 
 func TestIncomingQuery(t *testing.T) {
@@ -117,12 +146,12 @@ func TestIncomingQuery(t *testing.T) {
 	blks := testutil.GenerateBlocksOfSize(5, 20)
 	loader := testbridge.NewMockLoader(blks)
 	ipldBridge := testbridge.NewMockIPLDBridge()
-	requestIDChan := make(chan gsmsg.GraphSyncRequestID, 1)
+	requestIDChan := make(chan completedRequest, 1)
 	sentResponses := make(chan sentResponse, len(blks))
 	fprs := &fakePeerResponseSender{lastCompletedRequest: requestIDChan, sentResponses: sentResponses}
 	peerManager := &fakePeerManager{peerResponseSender: fprs}
 	queryQueue := &fakeQueryQueue{}
-	responseManager := New(ctx, loader, ipldBridge, peerManager, queryQueue)
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(loader), ipldBridge, peerManager, queryQueue)
 	responseManager.Startup()
 
 	cids := make([]cid.Cid, 0, 5)
@@ -172,12 +201,12 @@ func TestCancellationQueryInProgress(t *testing.T) {
 	blks := testutil.GenerateBlocksOfSize(5, 20)
 	loader := testbridge.NewMockLoader(blks)
 	ipldBridge := testbridge.NewMockIPLDBridge()
-	requestIDChan := make(chan gsmsg.GraphSyncRequestID)
+	requestIDChan := make(chan completedRequest)
 	sentResponses := make(chan sentResponse)
 	fprs := &fakePeerResponseSender{lastCompletedRequest: requestIDChan, sentResponses: sentResponses}
 	peerManager := &fakePeerManager{peerResponseSender: fprs}
 	queryQueue := &fakeQueryQueue{}
-	responseManager := New(ctx, loader, ipldBridge, peerManager, queryQueue)
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(loader), ipldBridge, peerManager, queryQueue)
 	responseManager.Startup()
 
 	cids := make([]cid.Cid, 0, 5)
@@ -257,13 +286,13 @@ func TestEarlyCancellation(t *testing.T) {
 	blks := testutil.GenerateBlocksOfSize(5, 20)
 	loader := testbridge.NewMockLoader(blks)
 	ipldBridge := testbridge.NewMockIPLDBridge()
-	requestIDChan := make(chan gsmsg.GraphSyncRequestID)
+	requestIDChan := make(chan completedRequest)
 	sentResponses := make(chan sentResponse)
 	fprs := &fakePeerResponseSender{lastCompletedRequest: requestIDChan, sentResponses: sentResponses}
 	peerManager := &fakePeerManager{peerResponseSender: fprs}
 	queryQueue := &fakeQueryQueue{}
 	queryQueue.popWait.Add(1)
-	responseManager := New(ctx, loader, ipldBridge, peerManager, queryQueue)
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(loader), ipldBridge, peerManager, queryQueue)
 	responseManager.Startup()
 
 	cids := make([]cid.Cid, 0, 5)
@@ -302,3 +331,1127 @@ func TestEarlyCancellation(t *testing.T) {
 		t.Fatal("should not send have completed response")
 	}
 }
+
+func TestValidationAndExtensions(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 40*time.Millisecond)
+	defer cancel()
+	blks := testutil.GenerateBlocksOfSize(5, 20)
+	loader := testbridge.NewMockLoader(blks)
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	completedRequestChan := make(chan completedRequest, 1)
+	sentResponses := make(chan sentResponse, 100)
+	sentExtensions := make(chan sentExtension, 1)
+	fprs := &fakePeerResponseSender{lastCompletedRequest: completedRequestChan, sentResponses: sentResponses, sentExtensions: sentExtensions}
+	peerManager := &fakePeerManager{peerResponseSender: fprs}
+	queryQueue := &fakeQueryQueue{}
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(loader), ipldBridge, peerManager, queryQueue)
+	responseManager.Startup()
+
+	cids := make([]cid.Cid, 0, 5)
+	for _, block := range blks {
+		cids = append(cids, block.Cid())
+	}
+	selectorSpec := testbridge.NewMockSelectorSpec(cids)
+	selector, err := ipldBridge.EncodeNode(selectorSpec)
+	if err != nil {
+		t.Fatal("error encoding selector")
+	}
+	p := testutil.GeneratePeers(1)[0]
+
+	extensionName := gsmsg.GraphSyncExtensionName("graphsync/awesome")
+	extensionData := testutil.RandomBytes(100)
+	extension := gsmsg.GraphSyncExtension{
+		Name: extensionName,
+		Data: extensionData,
+	}
+	extensionResponseData := testutil.RandomBytes(100)
+	extensionResponse := gsmsg.GraphSyncExtension{
+		Name: extensionName,
+		Data: extensionResponseData,
+	}
+
+	// hook rejects requests without the expected extension
+	responseManager.RegisterRequestHook(func(p peer.ID, request gsmsg.GraphSyncRequest, receivedSelectorSpec ipld.Node, hookActions RequestReceivedHookActions) {
+		data, has := request.Extension(extensionName)
+		if !has || !reflect.DeepEqual(data, extensionData) ||
+			!reflect.DeepEqual(receivedSelectorSpec, selectorSpec) {
+			hookActions.RejectRequest(gsmsg.RequestRejected)
+			return
+		}
+		hookActions.SendExtensionData(extensionResponse)
+	})
+
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	requests := []gsmsg.GraphSyncRequest{
+		gsmsg.NewRequest(requestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32)),
+	}
+	responseManager.ProcessRequests(ctx, p, requests)
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have completed request but didn't")
+	case lastRequest := <-completedRequestChan:
+		if lastRequest.requestID != requestID || lastRequest.status != gsmsg.RequestRejected {
+			t.Fatal("Request should have been rejected")
+		}
+	}
+	select {
+	case <-sentResponses:
+		t.Fatal("Rejected request should not send responses")
+	default:
+	}
+
+	requestID = gsmsg.GraphSyncRequestID(rand.Int31())
+	requests = []gsmsg.GraphSyncRequest{
+		gsmsg.NewRequest(requestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32), extension),
+	}
+	responseManager.ProcessRequests(ctx, p, requests)
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have sent extension data but didn't")
+	case receivedExtension := <-sentExtensions:
+		if receivedExtension.requestID != requestID ||
+			!reflect.DeepEqual(receivedExtension.extension, extensionResponse) {
+			t.Fatal("Did not send correct extension data")
+		}
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have completed request but didn't")
+	case lastRequest := <-completedRequestChan:
+		if lastRequest.requestID != requestID || lastRequest.status != gsmsg.RequestCompletedFull {
+			t.Fatal("Request should have succeeded")
+		}
+	}
+}
+
+func TestOutgoingBlockHooks(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blks := testutil.GenerateBlocksOfSize(5, 20)
+	loader := testbridge.NewMockLoader(blks)
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	completedRequestChan := make(chan completedRequest, 1)
+	sentResponses := make(chan sentResponse, 100)
+	sentExtensions := make(chan sentExtension, 100)
+	pausedRequests := make(chan gsmsg.GraphSyncRequestID, 1)
+	fprs := &fakePeerResponseSender{lastCompletedRequest: completedRequestChan, sentResponses: sentResponses, sentExtensions: sentExtensions, pausedRequests: pausedRequests}
+	peerManager := &fakePeerManager{peerResponseSender: fprs}
+	queryQueue := &fakeQueryQueue{}
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(loader), ipldBridge, peerManager, queryQueue)
+	responseManager.Startup()
+
+	cids := make([]cid.Cid, 0, 5)
+	for _, block := range blks {
+		cids = append(cids, block.Cid())
+	}
+	selectorSpec := testbridge.NewMockSelectorSpec(cids)
+	selector, err := ipldBridge.EncodeNode(selectorSpec)
+	if err != nil {
+		t.Fatal("error encoding selector")
+	}
+	p := testutil.GeneratePeers(1)[0]
+
+	extensionName := gsmsg.GraphSyncExtensionName("graphsync/awesome")
+	extension := gsmsg.GraphSyncExtension{
+		Name: extensionName,
+		Data: testutil.RandomBytes(100),
+	}
+
+	var blockCountLk sync.Mutex
+	blockCounts := make(map[gsmsg.GraphSyncRequestID]int)
+	blockSizes := make(map[gsmsg.GraphSyncRequestID]uint64)
+	terminatedRequestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	pausedRequestID := terminatedRequestID + 1
+	responseManager.RegisterBlockHook(func(p peer.ID, requestID gsmsg.GraphSyncRequestID, link ipld.Link, blockSize uint64, hookActions OutgoingBlockHookActions) {
+		blockCountLk.Lock()
+		blockCounts[requestID]++
+		blockSizes[requestID] += blockSize
+		blockCount := blockCounts[requestID]
+		blockCountLk.Unlock()
+		if requestID == terminatedRequestID && blockCount == 3 {
+			hookActions.SendExtensionData(extension)
+			hookActions.TerminateWithError(gsmsg.RequestFailedLegal)
+		}
+		if requestID == pausedRequestID && blockCount == 2 {
+			hookActions.PauseResponse()
+		}
+	})
+	responseManager.synchronize()
+
+	// terminates request after the third block
+	requests := []gsmsg.GraphSyncRequest{
+		gsmsg.NewRequest(terminatedRequestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32)),
+	}
+	responseManager.ProcessRequests(ctx, p, requests)
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have completed request but didn't")
+	case lastRequest := <-completedRequestChan:
+		if lastRequest.requestID != terminatedRequestID || lastRequest.status != gsmsg.RequestFailedLegal {
+			t.Fatal("Request should have been terminated by hook")
+		}
+	}
+	if len(sentResponses) != 3 {
+		t.Fatal("Should have stopped sending blocks once hook terminated request")
+	}
+	for len(sentResponses) > 0 {
+		<-sentResponses
+	}
+	select {
+	case receivedExtension := <-sentExtensions:
+		if receivedExtension.requestID != terminatedRequestID ||
+			!reflect.DeepEqual(receivedExtension.extension, extension) {
+			t.Fatal("Did not send correct extension data")
+		}
+	default:
+		t.Fatal("Should have sent extension data")
+	}
+	blockCountLk.Lock()
+	if blockSizes[terminatedRequestID] != 60 {
+		t.Fatal("Did not report correct block sizes to hook")
+	}
+	blockCountLk.Unlock()
+
+	// pauses request after the second block, then resumes
+	requests = []gsmsg.GraphSyncRequest{
+		gsmsg.NewRequest(pausedRequestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32)),
+	}
+	responseManager.ProcessRequests(ctx, p, requests)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ctx.Done():
+			t.Fatal("did not send enough responses")
+		case sentResponse := <-sentResponses:
+			if sentResponse.link.(cidlink.Link).Cid != blks[i].Cid() {
+				t.Fatal("sent incorrect link")
+			}
+		}
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have paused request but didn't")
+	case requestID := <-pausedRequests:
+		if requestID != pausedRequestID {
+			t.Fatal("Paused wrong request")
+		}
+	}
+	responseManager.synchronize()
+	select {
+	case <-completedRequestChan:
+		t.Fatal("Paused request should not complete")
+	case <-sentResponses:
+		t.Fatal("Paused request should not send more responses")
+	default:
+	}
+
+	err = responseManager.UnpauseResponse(p, terminatedRequestID)
+	if err == nil {
+		t.Fatal("Should not unpause request that is not paused")
+	}
+	err = responseManager.UnpauseResponse(p, pausedRequestID)
+	if err != nil {
+		t.Fatal("Should have unpaused request")
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have completed request but didn't")
+	case lastRequest := <-completedRequestChan:
+		if lastRequest.requestID != pausedRequestID || lastRequest.status != gsmsg.RequestCompletedFull {
+			t.Fatal("Request should have completed after unpausing")
+		}
+	}
+	if len(sentResponses) != 3 {
+		t.Fatal("Should only send remaining blocks after unpausing")
+	}
+	for i := 2; i < 5; i++ {
+		sentResponse := <-sentResponses
+		if sentResponse.link.(cidlink.Link).Cid != blks[i].Cid() {
+			t.Fatal("sent incorrect link")
+		}
+	}
+}
+
+func TestPauseAndUnpauseResponse(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blks := testutil.GenerateBlocksOfSize(5, 20)
+	loader := testbridge.NewMockLoader(blks)
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	completedRequestChan := make(chan completedRequest, 1)
+	sentResponses := make(chan sentResponse)
+	pausedRequests := make(chan gsmsg.GraphSyncRequestID, 1)
+	fprs := &fakePeerResponseSender{lastCompletedRequest: completedRequestChan, sentResponses: sentResponses, pausedRequests: pausedRequests}
+	peerManager := &fakePeerManager{peerResponseSender: fprs}
+	queryQueue := &fakeQueryQueue{}
+	queryQueue.popWait.Add(1)
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(loader), ipldBridge, peerManager, queryQueue)
+	responseManager.Startup()
+
+	cids := make([]cid.Cid, 0, 5)
+	for _, block := range blks {
+		cids = append(cids, block.Cid())
+	}
+	selectorSpec := testbridge.NewMockSelectorSpec(cids)
+	selector, err := ipldBridge.EncodeNode(selectorSpec)
+	if err != nil {
+		t.Fatal("error encoding selector")
+	}
+	p := testutil.GeneratePeers(1)[0]
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	requests := []gsmsg.GraphSyncRequest{
+		gsmsg.NewRequest(requestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32)),
+	}
+	responseManager.ProcessRequests(ctx, p, requests)
+
+	// pause while still queued
+	err = responseManager.PauseResponse(p, requestID)
+	if err != nil {
+		t.Fatal("Should be able to pause queued response")
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have notified peer of pause")
+	case pausedRequestID := <-pausedRequests:
+		if pausedRequestID != requestID {
+			t.Fatal("Paused wrong request")
+		}
+	}
+	err = responseManager.PauseResponse(p, requestID)
+	if err == nil {
+		t.Fatal("Should not pause a response twice")
+	}
+
+	// unblock popping from queue
+	queryQueue.popWait.Done()
+	responseManager.synchronize()
+	select {
+	case <-sentResponses:
+		t.Fatal("Paused response should not send responses")
+	default:
+	}
+
+	err = responseManager.UnpauseResponse(p, requestID)
+	if err != nil {
+		t.Fatal("Should be able to unpause response")
+	}
+
+	// read one block, then pause the running traversal
+	select {
+	case <-ctx.Done():
+		t.Fatal("did not send responses")
+	case sentResponse := <-sentResponses:
+		if sentResponse.link.(cidlink.Link).Cid != blks[0].Cid() {
+			t.Fatal("sent incorrect link")
+		}
+	}
+	err = responseManager.PauseResponse(p, requestID)
+	if err != nil {
+		t.Fatal("Should be able to pause running response")
+	}
+	// traversal pauses after the next block is sent, which may be the block
+	// already read
+	nextBlock := 1
+	for paused := false; !paused; {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Should have notified peer of pause")
+		case sentResponse := <-sentResponses:
+			if nextBlock != 1 || sentResponse.link.(cidlink.Link).Cid != blks[nextBlock].Cid() {
+				t.Fatal("sent incorrect link")
+			}
+			nextBlock++
+		case <-pausedRequests:
+			paused = true
+		}
+	}
+
+	err = responseManager.UnpauseResponse(p, requestID)
+	if err != nil {
+		t.Fatal("Should be able to unpause response")
+	}
+	for i := nextBlock; i < 5; i++ {
+		select {
+		case <-ctx.Done():
+			t.Fatal("did not send responses")
+		case sentResponse := <-sentResponses:
+			if sentResponse.link.(cidlink.Link).Cid != blks[i].Cid() {
+				t.Fatal("resumed response from wrong place")
+			}
+		}
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have completed request but didn't")
+	case lastRequest := <-completedRequestChan:
+		if lastRequest.requestID != requestID || lastRequest.status != gsmsg.RequestCompletedFull {
+			t.Fatal("Request should have completed after unpausing")
+		}
+	}
+}
+
+func TestRequestUpdates(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blks := testutil.GenerateBlocksOfSize(5, 20)
+	loader := testbridge.NewMockLoader(blks)
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	completedRequestChan := make(chan completedRequest, 1)
+	sentResponses := make(chan sentResponse, len(blks))
+	sentExtensions := make(chan sentExtension, 1)
+	pausedRequests := make(chan gsmsg.GraphSyncRequestID, 1)
+	fprs := &fakePeerResponseSender{
+		lastCompletedRequest: completedRequestChan,
+		sentResponses:        sentResponses,
+		sentExtensions:       sentExtensions,
+		pausedRequests:       pausedRequests,
+	}
+	peerManager := &fakePeerManager{peerResponseSender: fprs}
+	queryQueue := &fakeQueryQueue{}
+	queryQueue.popWait.Add(1)
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(loader), ipldBridge, peerManager, queryQueue)
+	responseManager.Startup()
+
+	cids := make([]cid.Cid, 0, 5)
+	for _, block := range blks {
+		cids = append(cids, block.Cid())
+	}
+	selectorSpec := testbridge.NewMockSelectorSpec(cids)
+	selector, err := ipldBridge.EncodeNode(selectorSpec)
+	if err != nil {
+		t.Fatal("error encoding selector")
+	}
+	p := testutil.GeneratePeers(1)[0]
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	extensionName := gsmsg.GraphSyncExtensionName("graphsync/awesome")
+	updateData := testutil.RandomBytes(100)
+	responseData := testutil.RandomBytes(100)
+
+	responseManager.RegisterUpdateHook(func(hookPeer peer.ID, request gsmsg.GraphSyncRequest, update gsmsg.GraphSyncRequest, hookActions RequestUpdatedHookActions) {
+		data, has := update.Extension(extensionName)
+		if hookPeer == p && request.ID() == requestID && !request.IsUpdate() &&
+			has && reflect.DeepEqual(data, updateData) {
+			hookActions.SendExtensionData(gsmsg.GraphSyncExtension{Name: extensionName, Data: responseData})
+		}
+	})
+
+	requests := []gsmsg.GraphSyncRequest{
+		gsmsg.NewRequest(requestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32)),
+	}
+	responseManager.ProcessRequests(ctx, p, requests)
+
+	// update hooks see the original request and the update
+	responseManager.ProcessRequests(ctx, p, []gsmsg.GraphSyncRequest{
+		gsmsg.UpdateRequest(requestID, gsmsg.GraphSyncExtension{Name: extensionName, Data: updateData}),
+	})
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have sent extension data from update hook")
+	case receivedExtension := <-sentExtensions:
+		if receivedExtension.requestID != requestID ||
+			receivedExtension.extension.Name != extensionName ||
+			!reflect.DeepEqual(receivedExtension.extension.Data, responseData) {
+			t.Fatal("Sent incorrect extension data from update hook")
+		}
+	}
+
+	// pause with an update while still queued
+	responseManager.ProcessRequests(ctx, p, []gsmsg.GraphSyncRequest{
+		gsmsg.UpdateRequest(requestID, gsmsg.GraphSyncExtension{Name: gsmsg.ExtensionPause, Data: []byte{1}}),
+	})
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have notified peer of pause")
+	case pausedRequestID := <-pausedRequests:
+		if pausedRequestID != requestID {
+			t.Fatal("Paused wrong request")
+		}
+	}
+
+	queryQueue.popWait.Done()
+	responseManager.synchronize()
+	select {
+	case <-sentResponses:
+		t.Fatal("Paused response should not send responses")
+	default:
+	}
+
+	// unpause with an update
+	responseManager.ProcessRequests(ctx, p, []gsmsg.GraphSyncRequest{
+		gsmsg.UpdateRequest(requestID, gsmsg.GraphSyncExtension{Name: gsmsg.ExtensionPause, Data: []byte{0}}),
+	})
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have completed request but didn't")
+	case lastRequest := <-completedRequestChan:
+		if lastRequest.requestID != requestID || lastRequest.status != gsmsg.RequestCompletedFull {
+			t.Fatal("Request should have completed after unpausing")
+		}
+	}
+	if len(sentResponses) != len(blks) {
+		t.Fatal("Did not send all blocks after unpausing")
+	}
+}
+
+func TestDisconnectedPeerCancelsResponses(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blks := testutil.GenerateBlocksOfSize(5, 20)
+	loader := testbridge.NewMockLoader(blks)
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	completedRequestChan := make(chan completedRequest, 1)
+	sentResponses := make(chan sentResponse, len(blks))
+	fprs := &fakePeerResponseSender{lastCompletedRequest: completedRequestChan, sentResponses: sentResponses}
+	peerManager := &fakePeerManager{peerResponseSender: fprs}
+	queryQueue := &fakeQueryQueue{}
+	queryQueue.popWait.Add(1)
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(loader), ipldBridge, peerManager, queryQueue)
+	responseManager.Startup()
+
+	cids := make([]cid.Cid, 0, 5)
+	for _, block := range blks {
+		cids = append(cids, block.Cid())
+	}
+	selectorSpec := testbridge.NewMockSelectorSpec(cids)
+	selector, err := ipldBridge.EncodeNode(selectorSpec)
+	if err != nil {
+		t.Fatal("error encoding selector")
+	}
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	requests := []gsmsg.GraphSyncRequest{
+		gsmsg.NewRequest(requestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32)),
+	}
+	p := testutil.GeneratePeers(1)[0]
+	responseManager.ProcessRequests(ctx, p, requests)
+
+	responseManager.Disconnected(p)
+	err = responseManager.PauseResponse(p, requestID)
+	if err == nil {
+		t.Fatal("Response should have been removed when peer disconnected")
+	}
+
+	// unblock popping from queue
+	queryQueue.popWait.Done()
+	responseManager.synchronize()
+
+	select {
+	case <-sentResponses:
+		t.Fatal("should not send responses to a disconnected peer")
+	case <-completedRequestChan:
+		t.Fatal("should not complete responses to a disconnected peer")
+	default:
+	}
+}
+
+func TestBusyResponses(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blks := testutil.GenerateBlocksOfSize(5, 20)
+	loader := testbridge.NewMockLoader(blks)
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	completedRequestChan := make(chan completedRequest, 1)
+	sentResponses := make(chan sentResponse, 2*len(blks))
+	sentExtensions := make(chan sentExtension, 1)
+	fprs := &fakePeerResponseSender{lastCompletedRequest: completedRequestChan, sentResponses: sentResponses, sentExtensions: sentExtensions}
+	peerManager := &fakePeerManager{peerResponseSender: fprs}
+	queryQueue := &fakeQueryQueue{}
+	queryQueue.popWait.Add(1)
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(loader), ipldBridge, peerManager, queryQueue)
+	responseManager.Startup()
+	retryAfter := 2 * time.Second
+	responseManager.SetMaxQueuedResponses(1, retryAfter)
+
+	cids := make([]cid.Cid, 0, 5)
+	for _, block := range blks {
+		cids = append(cids, block.Cid())
+	}
+	selectorSpec := testbridge.NewMockSelectorSpec(cids)
+	selector, err := ipldBridge.EncodeNode(selectorSpec)
+	if err != nil {
+		t.Fatal("error encoding selector")
+	}
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	busyRequestID := requestID + 1
+	requests := []gsmsg.GraphSyncRequest{
+		gsmsg.NewRequest(requestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32)),
+		gsmsg.NewRequest(busyRequestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32)),
+	}
+	p := testutil.GeneratePeers(1)[0]
+	responseManager.ProcessRequests(ctx, p, requests)
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have sent retry after hint but didn't")
+	case sentExtension := <-sentExtensions:
+		if sentExtension.requestID != busyRequestID ||
+			!reflect.DeepEqual(sentExtension.extension, gsmsg.RetryAfterExtension(retryAfter)) {
+			t.Fatal("Sent incorrect retry after hint")
+		}
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have refused request but didn't")
+	case completedRequest := <-completedRequestChan:
+		if completedRequest.requestID != busyRequestID ||
+			completedRequest.status != gsmsg.RequestFailedBusy {
+			t.Fatal("Did not refuse request with busy status")
+		}
+	}
+
+	// unblock popping from queue
+	queryQueue.popWait.Done()
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have completed queued request but didn't")
+	case completedRequest := <-completedRequestChan:
+		if completedRequest.requestID != requestID ||
+			completedRequest.status != gsmsg.RequestCompletedFull {
+			t.Fatal("Did not complete queued request")
+		}
+	}
+}
+
+func TestCancelledQueuedResponsesDoNotCountAsBusy(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blks := testutil.GenerateBlocksOfSize(5, 20)
+	loader := testbridge.NewMockLoader(blks)
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	completedRequestChan := make(chan completedRequest, 1)
+	sentResponses := make(chan sentResponse, 2*len(blks))
+	sentExtensions := make(chan sentExtension, 1)
+	fprs := &fakePeerResponseSender{lastCompletedRequest: completedRequestChan, sentResponses: sentResponses, sentExtensions: sentExtensions}
+	peerManager := &fakePeerManager{peerResponseSender: fprs}
+	queryQueue := &fakeQueryQueue{}
+	queryQueue.popWait.Add(1)
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(loader), ipldBridge, peerManager, queryQueue)
+	responseManager.Startup()
+	responseManager.SetMaxQueuedResponses(1, 2*time.Second)
+
+	cids := make([]cid.Cid, 0, 5)
+	for _, block := range blks {
+		cids = append(cids, block.Cid())
+	}
+	selectorSpec := testbridge.NewMockSelectorSpec(cids)
+	selector, err := ipldBridge.EncodeNode(selectorSpec)
+	if err != nil {
+		t.Fatal("error encoding selector")
+	}
+	cancelledRequestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	requestID := cancelledRequestID + 1
+	p := testutil.GeneratePeers(1)[0]
+	responseManager.ProcessRequests(ctx, p, []gsmsg.GraphSyncRequest{
+		gsmsg.NewRequest(cancelledRequestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32)),
+	})
+	responseManager.ProcessRequests(ctx, p, []gsmsg.GraphSyncRequest{
+		gsmsg.CancelRequest(cancelledRequestID),
+	})
+	responseManager.ProcessRequests(ctx, p, []gsmsg.GraphSyncRequest{
+		gsmsg.NewRequest(requestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32)),
+	})
+
+	// unblock popping from queue
+	queryQueue.popWait.Done()
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have completed queued request but didn't")
+	case completedRequest := <-completedRequestChan:
+		if completedRequest.requestID != requestID ||
+			completedRequest.status != gsmsg.RequestCompletedFull {
+			t.Fatal("Refused request while only a cancelled request was queued")
+		}
+	}
+	select {
+	case <-sentExtensions:
+		t.Fatal("Should not have sent retry after hint")
+	default:
+	}
+}
+
+func TestTraversalBudgets(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blks := testutil.GenerateBlocksOfSize(5, 20)
+	blockLoader := testbridge.NewMockLoader(blks)
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	completedRequestChan := make(chan completedRequest, 1)
+	sentResponses := make(chan sentResponse, len(blks))
+	sentExtensions := make(chan sentExtension, 1)
+	fprs := &fakePeerResponseSender{lastCompletedRequest: completedRequestChan, sentResponses: sentResponses, sentExtensions: sentExtensions}
+	peerManager := &fakePeerManager{peerResponseSender: fprs}
+	queryQueue := &fakeQueryQueue{}
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(blockLoader), ipldBridge, peerManager, queryQueue, DefaultBudget(loader.Budget{MaxBlocks: 2}))
+	responseManager.Startup()
+
+	cids := make([]cid.Cid, 0, 5)
+	for _, block := range blks {
+		cids = append(cids, block.Cid())
+	}
+	selectorSpec := testbridge.NewMockSelectorSpec(cids)
+	selector, err := ipldBridge.EncodeNode(selectorSpec)
+	if err != nil {
+		t.Fatal("error encoding selector")
+	}
+	p := testutil.GeneratePeers(1)[0]
+	unlimitedExtension := gsmsg.GraphSyncExtension{
+		Name: gsmsg.GraphSyncExtensionName("graphsync/unlimited"),
+	}
+	responseManager.RegisterRequestHook(func(p peer.ID, request gsmsg.GraphSyncRequest, selectorSpec ipld.Node, hookActions RequestReceivedHookActions) {
+		if _, has := request.Extension(unlimitedExtension.Name); has {
+			hookActions.SetBudget(loader.Budget{})
+		}
+	})
+
+	sendRequest := func(extensions ...gsmsg.GraphSyncExtension) gsmsg.GraphSyncRequestID {
+		requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+		requests := []gsmsg.GraphSyncRequest{
+			gsmsg.NewRequest(requestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32), extensions...),
+		}
+		responseManager.ProcessRequests(ctx, p, requests)
+		return requestID
+	}
+	verifyResponses := func(count int) {
+		for i := 0; i < count; i++ {
+			select {
+			case <-ctx.Done():
+				t.Fatal("did not send enough responses")
+			case <-sentResponses:
+			}
+		}
+		select {
+		case <-sentResponses:
+			t.Fatal("sent more responses than the budget allows")
+		default:
+		}
+	}
+	verifyBudgetExceeded := func(requestID gsmsg.GraphSyncRequestID, limit loader.BudgetLimit) {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Should have sent exceeded budget limit but didn't")
+		case receivedExtension := <-sentExtensions:
+			if receivedExtension.requestID != requestID ||
+				!reflect.DeepEqual(receivedExtension.extension, gsmsg.BudgetExceededExtension(string(limit))) {
+				t.Fatal("Did not send correct exceeded budget limit")
+			}
+		}
+	}
+	verifyCompleted := func(requestID gsmsg.GraphSyncRequestID, status gsmsg.GraphSyncResponseStatusCode) {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Should have completed request but didn't")
+		case lastRequest := <-completedRequestChan:
+			if lastRequest.requestID != requestID || lastRequest.status != status {
+				t.Fatal("Request completed with incorrect status")
+			}
+		}
+	}
+
+	// default budget applies to peers without their own
+	requestID := sendRequest()
+	verifyBudgetExceeded(requestID, loader.BlocksLimit)
+	verifyCompleted(requestID, gsmsg.RequestCompletedPartial)
+	verifyResponses(2)
+
+	// peer default budget replaces the default
+	responseManager.SetPeerDefaultBudget(p, loader.Budget{MaxBytes: 70})
+	requestID = sendRequest()
+	verifyBudgetExceeded(requestID, loader.BytesLimit)
+	verifyCompleted(requestID, gsmsg.RequestCompletedPartial)
+	verifyResponses(3)
+
+	// request hooks override the peer's default budget
+	requestID = sendRequest(unlimitedExtension)
+	verifyCompleted(requestID, gsmsg.RequestCompletedFull)
+	verifyResponses(len(blks))
+	select {
+	case <-sentExtensions:
+		t.Fatal("Should not send exceeded budget limit for request within budget")
+	default:
+	}
+}
+
+func TestPeerBudgetSharedByResponses(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blks := testutil.GenerateBlocksOfSize(5, 20)
+	blockLoader := testbridge.NewMockLoader(blks)
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	completedRequestChan := make(chan completedRequest, 1)
+	sentResponses := make(chan sentResponse, len(blks))
+	sentExtensions := make(chan sentExtension, 1)
+	pausedRequests := make(chan gsmsg.GraphSyncRequestID, 1)
+	fprs := &fakePeerResponseSender{lastCompletedRequest: completedRequestChan, sentResponses: sentResponses, sentExtensions: sentExtensions, pausedRequests: pausedRequests}
+	peerManager := &fakePeerManager{peerResponseSender: fprs}
+	queryQueue := &fakeQueryQueue{}
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(blockLoader), ipldBridge, peerManager, queryQueue, DefaultPeerBudget(loader.Budget{MaxBlocks: 3}))
+	responseManager.Startup()
+
+	pausedRequestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	var pauseOnce sync.Once
+	responseManager.RegisterBlockHook(func(p peer.ID, requestID gsmsg.GraphSyncRequestID, link ipld.Link, blockSize uint64, hookActions OutgoingBlockHookActions) {
+		if requestID == pausedRequestID && link == (cidlink.Link{Cid: blks[1].Cid()}) {
+			pauseOnce.Do(hookActions.PauseResponse)
+		}
+	})
+	responseManager.synchronize()
+
+	cids := make([]cid.Cid, 0, 5)
+	for _, block := range blks {
+		cids = append(cids, block.Cid())
+	}
+	selector, err := ipldBridge.EncodeNode(testbridge.NewMockSelectorSpec(cids))
+	if err != nil {
+		t.Fatal("error encoding selector")
+	}
+	p := testutil.GeneratePeers(1)[0]
+	sendRequest := func(requestID gsmsg.GraphSyncRequestID) {
+		requests := []gsmsg.GraphSyncRequest{
+			gsmsg.NewRequest(requestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32)),
+		}
+		responseManager.ProcessRequests(ctx, p, requests)
+	}
+	verifyResponses := func(count int) {
+		for i := 0; i < count; i++ {
+			select {
+			case <-ctx.Done():
+				t.Fatal("did not send enough responses")
+			case <-sentResponses:
+			}
+		}
+	}
+	verifyPeerBudgetExceeded := func(requestID gsmsg.GraphSyncRequestID) {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Should have completed request but didn't")
+		case lastRequest := <-completedRequestChan:
+			if lastRequest.requestID != requestID || lastRequest.status != gsmsg.RequestCompletedPartial {
+				t.Fatal("Request completed with incorrect status")
+			}
+		}
+		select {
+		case receivedExtension := <-sentExtensions:
+			if receivedExtension.requestID != requestID ||
+				!reflect.DeepEqual(receivedExtension.extension, gsmsg.BudgetExceededExtension(string(loader.PeerBlocksLimit))) {
+				t.Fatal("Did not send peer budget limit")
+			}
+		default:
+			t.Fatal("Should have sent exceeded budget limit")
+		}
+		if len(sentResponses) != 0 {
+			t.Fatal("sent more responses than the peer budget allows")
+		}
+	}
+
+	// a paused response keeps what it spent of the peer's budget
+	sendRequest(pausedRequestID)
+	verifyResponses(2)
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have notified peer of pause")
+	case <-pausedRequests:
+	}
+
+	// so a second response to the peer gets what is left
+	requestID := pausedRequestID + 1
+	sendRequest(requestID)
+	verifyResponses(1)
+	verifyPeerBudgetExceeded(requestID)
+
+	// which the second response gave back when it finished
+	err = responseManager.UnpauseResponse(p, pausedRequestID)
+	if err != nil {
+		t.Fatal("Should be able to unpause response")
+	}
+	verifyResponses(1)
+	verifyPeerBudgetExceeded(pausedRequestID)
+
+	// all of it is given back once no responses are in progress
+	responseManager.SetPeerBudget(p, loader.Budget{MaxBlocks: 4})
+	requestID = pausedRequestID + 2
+	sendRequest(requestID)
+	verifyResponses(4)
+	verifyPeerBudgetExceeded(requestID)
+}
+
+// treeNode is a block in the DAG walked by treeTraversalBridge, at the given
+// path below the root
+type treeNode struct {
+	link     ipld.Link
+	path     string
+	children []treeNode
+}
+
+// treeTraversalBridge walks a fixed DAG, visiting only the children of links
+// the loader follows, where the mock bridge visits a flat list of links
+type treeTraversalBridge struct {
+	ipldbridge.IPLDBridge
+	root treeNode
+}
+
+func (ttb *treeTraversalBridge) Traverse(ctx context.Context, loader ipldbridge.Loader, root ipld.Node, s ipldbridge.Selector, fn ipldbridge.AdvVisitFn) error {
+	return ttb.traverseNode(loader, ttb.root)
+}
+
+func (ttb *treeTraversalBridge) traverseNode(loader ipldbridge.Loader, node treeNode) error {
+	_, err := loader(node.link, ipldbridge.LinkContext{LinkPath: ipld.ParsePath(node.path)})
+	if err == ipldbridge.ErrDoNotFollow() {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, child := range node.children {
+		err := ttb.traverseNode(loader, child)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestPauseAndUnpauseDepthLimitedResponse(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blks := testutil.GenerateBlocksOfSize(6, 20)
+	blockLoader := testbridge.NewMockLoader(blks)
+	links := make([]ipld.Link, 0, len(blks))
+	for _, block := range blks {
+		links = append(links, cidlink.Link{Cid: block.Cid()})
+	}
+	// the third block is too deep to load, so the fourth is never reached
+	ipldBridge := &treeTraversalBridge{
+		IPLDBridge: testbridge.NewMockIPLDBridge(),
+		root: treeNode{links[0], "", []treeNode{
+			{links[1], "Links/0/Hash", []treeNode{
+				{links[2], "Links/0/Hash/Links/0/Hash", []treeNode{
+					{links[3], "Links/0/Hash/Links/0/Hash/Links/0/Hash", nil},
+				}},
+			}},
+			{links[4], "Links/1/Hash", nil},
+			{links[5], "Links/2/Hash", nil},
+		}},
+	}
+	completedRequestChan := make(chan completedRequest, 1)
+	sentResponses := make(chan sentResponse, len(blks))
+	sentExtensions := make(chan sentExtension, 1)
+	pausedRequests := make(chan gsmsg.GraphSyncRequestID, 1)
+	fprs := &fakePeerResponseSender{lastCompletedRequest: completedRequestChan, sentResponses: sentResponses, sentExtensions: sentExtensions, pausedRequests: pausedRequests}
+	peerManager := &fakePeerManager{peerResponseSender: fprs}
+	queryQueue := &fakeQueryQueue{}
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(blockLoader), ipldBridge, peerManager, queryQueue, DefaultBudget(loader.Budget{MaxLinkDepth: 1}))
+	responseManager.Startup()
+
+	var pauseOnce sync.Once
+	responseManager.RegisterBlockHook(func(p peer.ID, requestID gsmsg.GraphSyncRequestID, link ipld.Link, blockSize uint64, hookActions OutgoingBlockHookActions) {
+		if link == links[4] {
+			pauseOnce.Do(hookActions.PauseResponse)
+		}
+	})
+	responseManager.synchronize()
+
+	selector, err := ipldBridge.EncodeNode(testbridge.NewMockSelectorSpec([]cid.Cid{blks[0].Cid()}))
+	if err != nil {
+		t.Fatal("error encoding selector")
+	}
+	p := testutil.GeneratePeers(1)[0]
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	requests := []gsmsg.GraphSyncRequest{
+		gsmsg.NewRequest(requestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32)),
+	}
+	responseManager.ProcessRequests(ctx, p, requests)
+
+	verifySent := func(expectedLinks ...ipld.Link) {
+		for _, expectedLink := range expectedLinks {
+			select {
+			case <-ctx.Done():
+				t.Fatal("did not send responses")
+			case sentResponse := <-sentResponses:
+				if sentResponse.link != expectedLink {
+					t.Fatal("sent incorrect link")
+				}
+			}
+		}
+	}
+
+	// pauses after the block following the link too deep to load
+	verifySent(links[0], links[1], links[4])
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have notified peer of pause")
+	case <-pausedRequests:
+	}
+
+	// resumes after the block it paused on, skipping the same links as before
+	err = responseManager.UnpauseResponse(p, requestID)
+	if err != nil {
+		t.Fatal("Should be able to unpause response")
+	}
+	verifySent(links[5])
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have completed request but didn't")
+	case lastRequest := <-completedRequestChan:
+		if lastRequest.requestID != requestID || lastRequest.status != gsmsg.RequestCompletedPartial {
+			t.Fatal("Request should have completed partially after skipping links")
+		}
+	}
+	select {
+	case <-sentResponses:
+		t.Fatal("sent more responses than the traversal reaches")
+	default:
+	}
+}
+
+func TestShutdownFailsResponses(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blks := testutil.GenerateBlocksOfSize(5, 20)
+	loader := testbridge.NewMockLoader(blks)
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	completedRequestChan := make(chan completedRequest, 1)
+	sentResponses := make(chan sentResponse, len(blks))
+	fprs := &fakePeerResponseSender{lastCompletedRequest: completedRequestChan, sentResponses: sentResponses}
+	peerManager := &fakePeerManager{peerResponseSender: fprs}
+	queryQueue := &fakeQueryQueue{}
+	queryQueue.popWait.Add(1)
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(loader), ipldBridge, peerManager, queryQueue)
+	responseManager.Startup()
+
+	cids := make([]cid.Cid, 0, 5)
+	for _, block := range blks {
+		cids = append(cids, block.Cid())
+	}
+	selectorSpec := testbridge.NewMockSelectorSpec(cids)
+	selector, err := ipldBridge.EncodeNode(selectorSpec)
+	if err != nil {
+		t.Fatal("error encoding selector")
+	}
+	requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+	requests := []gsmsg.GraphSyncRequest{
+		gsmsg.NewRequest(requestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32)),
+	}
+	p := testutil.GeneratePeers(1)[0]
+	responseManager.ProcessRequests(ctx, p, requests)
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- responseManager.Shutdown(ctx)
+	}()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("Should have failed queued request but didn't")
+	case completedRequest := <-completedRequestChan:
+		if completedRequest.requestID != requestID ||
+			completedRequest.status != gsmsg.RequestFailedUnknown {
+			t.Fatal("Did not fail queued request with unknown status")
+		}
+	}
+
+	// unblock popping from queue so workers can exit
+	queryQueue.popWait.Done()
+	select {
+	case <-ctx.Done():
+		t.Fatal("Shutdown did not complete")
+	case err := <-shutdownErr:
+		if err != nil {
+			t.Fatal("Shutdown should have completed without error")
+		}
+	}
+	if len(sentResponses) != 0 {
+		t.Fatal("Should not have sent responses for failed request")
+	}
+}
+
+func TestRequestHookChoosesLoader(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	blks := testutil.GenerateBlocksOfSize(5, 20)
+	publicLoader := testbridge.NewMockLoader(nil)
+	privateBlockLoader := testbridge.NewMockLoader(blks)
+	privateLoadPeers := make(chan peer.ID, len(blks))
+	privateLoader := func(ctx context.Context, lnk ipld.Link, lnkCtx ipldbridge.LinkContext) (io.Reader, error) {
+		requestPeer, _ := requestcontext.Peer(ctx)
+		privateLoadPeers <- requestPeer
+		return privateBlockLoader(lnk, lnkCtx)
+	}
+	ipldBridge := testbridge.NewMockIPLDBridge()
+	completedRequestChan := make(chan completedRequest, 1)
+	sentResponses := make(chan sentResponse, len(blks))
+	fprs := &fakePeerResponseSender{lastCompletedRequest: completedRequestChan, sentResponses: sentResponses}
+	peerManager := &fakePeerManager{peerResponseSender: fprs}
+	queryQueue := &fakeQueryQueue{}
+	responseManager := New(ctx, ipldbridge.LoaderWithContext(publicLoader), ipldBridge, peerManager, queryQueue)
+	responseManager.Startup()
+
+	cids := make([]cid.Cid, 0, 5)
+	for _, block := range blks {
+		cids = append(cids, block.Cid())
+	}
+	selectorSpec := testbridge.NewMockSelectorSpec(cids)
+	selector, err := ipldBridge.EncodeNode(selectorSpec)
+	if err != nil {
+		t.Fatal("error encoding selector")
+	}
+	p := testutil.GeneratePeers(1)[0]
+	privateExtension := gsmsg.GraphSyncExtension{
+		Name: gsmsg.GraphSyncExtensionName("graphsync/private"),
+	}
+	responseManager.RegisterRequestHook(func(p peer.ID, request gsmsg.GraphSyncRequest, selectorSpec ipld.Node, hookActions RequestReceivedHookActions) {
+		if _, has := request.Extension(privateExtension.Name); has {
+			hookActions.UseLoader(privateLoader)
+		}
+	})
+
+	sendRequest := func(extensions ...gsmsg.GraphSyncExtension) {
+		requestID := gsmsg.GraphSyncRequestID(rand.Int31())
+		requests := []gsmsg.GraphSyncRequest{
+			gsmsg.NewRequest(requestID, selector, gsmsg.GraphSyncPriority(math.MaxInt32), extensions...),
+		}
+		responseManager.ProcessRequests(ctx, p, requests)
+		select {
+		case <-ctx.Done():
+			t.Fatal("Should have completed request but didn't")
+		case <-completedRequestChan:
+		}
+	}
+	countBlocksSent := func() int {
+		blocksSent := 0
+		for i := 0; i < len(blks); i++ {
+			select {
+			case <-ctx.Done():
+				t.Fatal("did not send enough responses")
+			case response := <-sentResponses:
+				if response.data != nil {
+					blocksSent++
+				}
+			}
+		}
+		return blocksSent
+	}
+
+	sendRequest()
+	if countBlocksSent() != 0 {
+		t.Fatal("Should serve request from response manager's loader")
+	}
+	sendRequest(privateExtension)
+	if countBlocksSent() != len(blks) {
+		t.Fatal("Should serve request from loader chosen by hook")
+	}
+	for i := 0; i < len(blks); i++ {
+		if loadPeer := <-privateLoadPeers; loadPeer != p {
+			t.Fatal("Should pass request context to loader chosen by hook")
+		}
+	}
+}
@@ -82,7 +82,9 @@ func (mb *mockIPLDBridge) EncodeNode(node ipld.Node) ([]byte, error) {
 func (mb *mockIPLDBridge) DecodeNode(data []byte) (ipld.Node, error) {
 	var cidsVisited []cid.Cid
 	err := json.Unmarshal(data, &cidsVisited)
-	if err == nil {
+	// an empty list is more likely a regular node (such as empty metadata)
+	// than a selector that visits nothing
+	if err == nil && len(cidsVisited) > 0 {
 		return &mockSelectorSpec{cidsVisited, false, false}, nil
 	}
 	reader := bytes.NewReader(data)
@@ -110,6 +112,8 @@ func (mb *mockIPLDBridge) Traverse(ctx context.Context, loader ipldbridge.Loader
 				ipld.Path
 				ipld.Link
 			}{ipld.Path{}, cidlink.Link{Cid: lnk}}}, node, 0)
+		} else if err != ipldbridge.ErrDoNotFollow() {
+			return err
 		}
 		select {
 		case <-ctx.Done():